@@ -4,13 +4,19 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"time"
 
 	"github.com/Pramod-Devireddy/go-exprtk"
 	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/nomad/nomad/structs"
 	"github.com/mitchellh/mapstructure"
 )
 
 func decodeVariable(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if t == reflect.TypeOf(&NamePattern{}) {
+		return decodeToNamePattern(f, t, data)
+	}
+
 	if t != reflect.TypeOf(&exprtk.GoExprtk{}) {
 		return decodeToTimeDuration(f, t, data)
 	}
@@ -19,18 +25,7 @@ func decodeVariable(f reflect.Type, t reflect.Type, data interface{}) (interface
 		return nil, fmt.Errorf("wrong type in value for exprtk.GoExprtk")
 	}
 
-	exprtkObj := exprtk.NewExprtk()
-	exprtkObj.SetExpression(data.(string))
-	exprtkObj.AddDoubleVariable("totalnodes")
-	exprtkObj.AddDoubleVariable("busynodes")
-
-	lerr := exprtkObj.CompileExpression()
-	if lerr != nil {
-		exprtkObj.Delete()
-		return nil, fmt.Errorf("can't compile expression: %s", lerr)
-	}
-
-	return &exprtkObj, nil
+	return newAllowedFreexpr(data.(string))
 }
 
 func configParse(_cnfPath string, _opts *Config) error {
@@ -62,6 +57,14 @@ func configParse(_cnfPath string, _opts *Config) error {
 		lerr = decoder.Decode(m)
 	}
 
+	if lerr != nil { // блоки могли декодироваться не полностью, так что и умолчания ставить не во что
+		return lerr
+	}
+
+	if _opts.MaxNodes < 0 {
+		return fmt.Errorf("max_nodes must not be negative")
+	}
+
 	if len(_opts.StaleNomadApi) == 0 {
 		_opts.StaleNomadApi = []*StaleApiConfig{
 			{
@@ -71,6 +74,32 @@ func configParse(_cnfPath string, _opts *Config) error {
 		}
 	}
 
+	if len(_opts.Nomad) == 0 {
+		_opts.Nomad = []*NomadClientConfig{{}}
+	}
+
+	for _, lnomadcnf := range _opts.Nomad {
+		if lnomadcnf.TokenFilePeriod == 0 {
+			lnomadcnf.TokenFilePeriod = time.Minute
+		}
+	}
+
+	if len(_opts.Filter) == 0 {
+		_opts.Filter = []*FilterConfig{{}}
+	}
+
+	for _, lfiltercnf := range _opts.Filter {
+		if lfiltercnf.OptOutMeta == "" {
+			lfiltercnf.OptOutMeta = "ondemand-scaler.disabled"
+		}
+
+		for _, ljobType := range lfiltercnf.JobTypes {
+			if !containsInSlice([]string{structs.JobTypeService, structs.JobTypeBatch, structs.JobTypeSystem, structs.JobTypeSysBatch}, ljobType) {
+				return fmt.Errorf("unknown job type %q in filter", ljobType)
+			}
+		}
+	}
+
 	if len(_opts.HungPrevention) == 0 {
 		_opts.HungPrevention = []*HungPreventionConfig{
 			{
@@ -79,5 +108,88 @@ func configParse(_cnfPath string, _opts *Config) error {
 		}
 	}
 
-	return lerr
+	for _, lstatecnf := range _opts.State {
+		if lstatecnf.CheckpointPeriod == 0 {
+			lstatecnf.CheckpointPeriod = 30 * time.Second
+		}
+
+		if lstatecnf.Type == "nomad" && lstatecnf.Path == "" {
+			lstatecnf.Path = "nomad-ondemand-scaler/state"
+		}
+	}
+
+	for _, lleadercnf := range _opts.Leader {
+		if lleadercnf.TTL == 0 {
+			lleadercnf.TTL = 15 * time.Second
+		}
+
+		if lleadercnf.Type == "nomad" && lleadercnf.Path == "" {
+			lleadercnf.Path = "nomad-ondemand-scaler/leader"
+		}
+	}
+
+	for _, lhttpcnf := range _opts.HttpApi {
+		if lhttpcnf.BindAddr == "" {
+			lhttpcnf.BindAddr = "127.0.0.1:8080"
+		}
+	}
+
+	for _, ltelemetrycnf := range _opts.Telemetry {
+		for _, lpromcnf := range ltelemetrycnf.Prometheus {
+			if lpromcnf.BindAddr == "" {
+				lpromcnf.BindAddr = "127.0.0.1:9102"
+			}
+
+			// метрики с метками удаленных пулов и job не должны висеть вечно
+			if lpromcnf.Expiration == 0 {
+				lpromcnf.Expiration = 10 * time.Minute
+			}
+		}
+	}
+
+	for _, lgcconfig := range _opts.GC {
+		if lgcconfig.RemoveTimeout == 0 {
+			lgcconfig.RemoveTimeout = 10 * time.Minute
+		}
+
+		// 0 задают явно, чтобы nomad ждал миграции без ограничения, поэтому умолчание только для незаданного
+		if lgcconfig.DrainDeadline == nil {
+			ldeadline := time.Hour
+			lgcconfig.DrainDeadline = &ldeadline
+		} else if *lgcconfig.DrainDeadline < 0 {
+			return fmt.Errorf("gc drain_deadline must not be negative, use drain_force to stop allocations at once")
+		}
+
+		if len(lgcconfig.BusyJobTypes) == 0 {
+			lgcconfig.BusyJobTypes = []string{structs.JobTypeService, structs.JobTypeBatch}
+		}
+
+		for _, ljobType := range lgcconfig.BusyJobTypes {
+			if !containsInSlice([]string{structs.JobTypeService, structs.JobTypeBatch, structs.JobTypeSystem, structs.JobTypeSysBatch}, ljobType) {
+				return fmt.Errorf("unknown job type %q in gc busy_job_types", ljobType)
+			}
+		}
+
+		if lgcconfig.IdleMeta == "" {
+			lgcconfig.IdleMeta = "ondemand-scaler.gc.idle"
+		}
+
+		if lgcconfig.ConsolidateMaxNodes < 0 {
+			return fmt.Errorf("gc consolidate_max_nodes must not be negative")
+		}
+
+		if lgcconfig.ConsolidateMaxNodes == 0 {
+			lgcconfig.ConsolidateMaxNodes = 1
+		}
+
+		if lgcconfig.ConsolidateUtilization < 0 || lgcconfig.ConsolidateUtilization > 1 {
+			return fmt.Errorf("gc consolidate_utilization must be between 0 and 1")
+		}
+
+		if lgcconfig.ConsolidateUtilization == 0 {
+			lgcconfig.ConsolidateUtilization = 0.5
+		}
+	}
+
+	return nil
 }
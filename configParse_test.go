@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -63,3 +65,93 @@ func TestParseConfigAllowedFreexpr(t *testing.T) {
 	config.GC[0].AllowedFreexpr.SetDoubleVariableValue("totalnodes", float64(20))
 	t.Logf("result: %d", int(config.GC[0].AllowedFreexpr.GetEvaluatedValue())) // int(config.GC[0].AllowedFreexpr.GetEvaluatedValue())
 }
+
+func TestParseConfigHttpApi(t *testing.T) {
+	lconfigPath := filepath.Join(t.TempDir(), "config.hcl")
+	lerr := os.WriteFile(lconfigPath, []byte(`
+poolconfig = "./pools.yml"
+
+http {
+  bind_addr = "0.0.0.0:8080"
+  token = "secret"
+}
+`), 0644)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	var config Config
+	lerr = configParse(lconfigPath, &config)
+	if lerr != nil {
+		t.Fatalf("Can't parse config due: %s", lerr)
+	}
+
+	if len(config.HttpApi) != 1 || config.HttpApi[0].BindAddr != "0.0.0.0:8080" || config.HttpApi[0].Token != "secret" {
+		t.Fatalf("Wrong http config: %v", config.HttpApi)
+	}
+}
+
+func TestParseConfigPrometheus(t *testing.T) {
+	lconfigPath := filepath.Join(t.TempDir(), "config.hcl")
+	lerr := os.WriteFile(lconfigPath, []byte(`
+poolconfig = "./pools.yml"
+
+telemetry {
+  prometheus {
+  }
+
+  prometheus {
+    expiration = "-1s"
+  }
+}
+`), 0644)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	var config Config
+	lerr = configParse(lconfigPath, &config)
+	if lerr != nil {
+		t.Fatalf("Can't parse config due: %s", lerr)
+	}
+
+	lpromcnfs := config.Telemetry[0].Prometheus
+	if len(lpromcnfs) != 2 || lpromcnfs[0].Expiration != 10*time.Minute || lpromcnfs[1].Expiration >= 0 {
+		t.Fatalf("Wrong prometheus config: %+v %+v", lpromcnfs[0], lpromcnfs[1])
+	}
+}
+
+func TestParseConfigDrainDeadline(t *testing.T) {
+	for _, lcase := range []struct {
+		gc       string
+		deadline time.Duration
+		err      bool
+	}{
+		{"", time.Hour, false},
+		{"drain_deadline = \"0s\"", 0, false},
+		{"drain_deadline = \"5m\"", 5 * time.Minute, false},
+		{"drain_deadline = \"-1s\"", 0, true},
+	} {
+		var config Config
+		lerr := configParse(writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+gc {
+  `+lcase.gc+`
+}
+`), &config)
+		if lcase.err {
+			if lerr == nil {
+				t.Fatalf("error expected for %q", lcase.gc)
+			}
+			continue
+		}
+
+		if lerr != nil {
+			t.Fatalf("Can't parse config %q due: %s", lcase.gc, lerr)
+		}
+
+		if ldeadline := config.GC[0].DrainDeadline; ldeadline == nil || *ldeadline != lcase.deadline {
+			t.Fatalf("drain deadline %s expected for %q, got %v", lcase.deadline, lcase.gc, ldeadline)
+		}
+	}
+}
@@ -14,19 +14,20 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
-func dumpSateonSignal(_stat *StateStat, _pools map[string]*Pool) {
+func dumpSateonSignal(_stat *StateStat, _pools *PoolSet) {
 	sigchnl := make(chan os.Signal, 1)
 	signal.Notify(sigchnl, syscall.SIGUSR1)
 
 	for range sigchnl {
-		lreport := fmt.Sprintf("free scaling threads: %d(%d)\n", _stat.GetFreeScalingThreads(), _stat.GetTotalScalingThreads())
+		lreport := fmt.Sprintf("leader: %t\n", _stat.IsLeader())
+		lreport += fmt.Sprintf("free scaling threads: %d(%d)\n", _stat.GetFreeScalingThreads(), _stat.GetTotalScalingThreads())
 		lreport += fmt.Sprintf("free gc threads: %d(%d)\n", _stat.GetFreeGcThreads(), _stat.GetTotalGcThreads())
 		lreport += fmt.Sprintf("accepted evals: %d\n", _stat.GetAcceptedEvals())
 		lreport += fmt.Sprintf("accepted allocs: %d\n", _stat.GetAcceptedAllocs())
 		lreport += fmt.Sprintf("timeouted scalings: %d\n", _stat.GetScalingTimeouts())
 		lreport += fmt.Sprintf("nosuited scaling events: %d\n", _stat.GetNosuitedEvents())
 
-		for _, lpool := range _pools {
+		for _, lpool := range _pools.Pools() {
 			lpool.lock.Lock()
 
 			if len(lreport) > 0 {
@@ -6,6 +6,6 @@ import (
 	"github.com/hashicorp/go-hclog"
 )
 
-func dumpSateonSignal(_stat *StateStat, _pools map[string]*Pool) {
+func dumpSateonSignal(_stat *StateStat, _pools *PoolSet) {
 	hclog.L().Named("dumpState").Info("Not supported on windows")
 }
@@ -19,6 +19,9 @@ func dumpPoolSpectToYml(_v Variant, _newField string, depth int, _lastfield []st
 	case VariantTypeBool:
 		result += fmt.Sprintf("%v", *_v.GetBoolValue())
 
+	case VariantTypeFloat:
+		result += fmt.Sprintf("%v", *_v.GetFloatValue())
+
 	case VariantTypeSlice:
 		list := _v.GetSliceValue()
 		for _, lv := range list {
@@ -10,10 +10,9 @@ import (
 	"github.com/hashicorp/nomad/scheduler"
 )
 
-func estimateRequiredNodes(_pool *Pool, _en []*structs.Node, _ea []*structs.Allocation, _job *structs.Job, _tg *structs.TaskGroup, _unallocatedCount int) ([]*structs.Node, []*structs.Allocation) {
-	var lephemeralNodes []*structs.Node
-	var lephemeralAllocations []*structs.Allocation
-
+// newBinpacking creates nomad scheduler stack, which places allocations on nodes given to it, allocations in plan
+// are accounted as already placed
+func newBinpacking() (*structs.Plan, *scheduler.EvalContext, *scheduler.GenericStack) {
 	plan := &structs.Plan{
 		EvalID:          uuid.Generate(),
 		NodeUpdate:      make(map[string][]*structs.Allocation),
@@ -27,7 +26,57 @@ func estimateRequiredNodes(_pool *Pool, _en []*structs.Node, _ea []*structs.Allo
 	state, _ := state.NewStateStore(config)
 	evlCtx := scheduler.NewEvalContext(nil, state, plan, logger)
 
-	stack := scheduler.NewGenericStack(false, evlCtx)
+	return plan, evlCtx, scheduler.NewGenericStack(false, evlCtx)
+}
+
+// binpackedAlloc creates allocation of task group on node selected by scheduler stack and adds it to plan
+func binpackedAlloc(_plan *structs.Plan, _evlCtx *scheduler.EvalContext, _job *structs.Job, _tg *structs.TaskGroup, _rnode *scheduler.RankedNode, _index int, _deploymentId string) *structs.Allocation {
+	resources := &structs.AllocatedResources{
+		Tasks:          _rnode.TaskResources,
+		TaskLifecycles: _rnode.TaskLifecycles,
+		Shared: structs.AllocatedSharedResources{
+			DiskMB: int64(_tg.EphemeralDisk.SizeMB),
+		},
+	}
+	if _rnode.AllocResources != nil {
+		resources.Shared.Networks = _rnode.AllocResources.Networks
+		resources.Shared.Ports = _rnode.AllocResources.Ports
+	}
+
+	// Create an allocation for this
+	alloc := &structs.Allocation{
+		ID:                 uuid.Generate(),
+		Namespace:          _job.Namespace,
+		EvalID:             _plan.EvalID,
+		Name:               fmt.Sprintf("%s[%d]", _tg.Name, _index),
+		JobID:              _job.ID,
+		Job:                _job,
+		TaskGroup:          _tg.Name,
+		Metrics:            _evlCtx.Metrics(),
+		NodeID:             _rnode.Node.ID,
+		NodeName:           _rnode.Node.Name,
+		DeploymentID:       _deploymentId,
+		TaskResources:      resources.OldTaskResources(),
+		AllocatedResources: resources,
+		DesiredStatus:      structs.AllocDesiredStatusRun,
+		ClientStatus:       structs.AllocClientStatusPending,
+		// SharedResources is considered deprecated, will be removed in 0.11.
+		// It is only set for compat reasons.
+		SharedResources: &structs.Resources{
+			DiskMB:   _tg.EphemeralDisk.SizeMB,
+			Networks: resources.Shared.Networks,
+		},
+	}
+
+	_plan.AppendAlloc(alloc, nil)
+	return alloc
+}
+
+func estimateRequiredNodes(_pool *Pool, _en []*structs.Node, _ea []*structs.Allocation, _job *structs.Job, _tg *structs.TaskGroup, _unallocatedCount int) ([]*structs.Node, []*structs.Allocation) {
+	var lephemeralNodes []*structs.Node
+	var lephemeralAllocations []*structs.Allocation
+
+	plan, evlCtx, stack := newBinpacking()
 	ljob := _job.Copy()
 	ljob.Status = structs.JobStatusPending
 
@@ -53,6 +102,9 @@ func estimateRequiredNodes(_pool *Pool, _en []*structs.Node, _ea []*structs.Allo
 		plan.AppendAlloc(ephAlloc, nil)
 	}
 
+	// на каждой новой ноде nomad разместит system jobs, их ресурсы для нашей job недоступны
+	lsystemFootprint := _pool.systemFootprint
+
 	_pool.lock.Unlock()
 
 	deploymentId := uuid.Generate()
@@ -63,6 +115,7 @@ func estimateRequiredNodes(_pool *Pool, _en []*structs.Node, _ea []*structs.Allo
 
 		if rnode == nil {
 			lepheralNode := _pool.poolnodespec.GetNode(uuid.Generate())
+			reserveFootprint(lepheralNode, lsystemFootprint)
 			lephemeralNodes = append(lephemeralNodes, lepheralNode)
 
 			lnomadNodes = append(lnomadNodes, lepheralNode)
@@ -72,44 +125,7 @@ func estimateRequiredNodes(_pool *Pool, _en []*structs.Node, _ea []*structs.Allo
 		}
 
 		i += 1
-		resources := &structs.AllocatedResources{
-			Tasks:          rnode.TaskResources,
-			TaskLifecycles: rnode.TaskLifecycles,
-			Shared: structs.AllocatedSharedResources{
-				DiskMB: int64(_tg.EphemeralDisk.SizeMB),
-			},
-		}
-		if rnode.AllocResources != nil {
-			resources.Shared.Networks = rnode.AllocResources.Networks
-			resources.Shared.Ports = rnode.AllocResources.Ports
-		}
-
-		// Create an allocation for this
-		alloc := &structs.Allocation{
-			ID:                 uuid.Generate(),
-			Namespace:          ljob.Namespace,
-			EvalID:             plan.EvalID,
-			Name:               fmt.Sprintf("%s[%d]", _tg.Name, i),
-			JobID:              ljob.ID,
-			Job:                ljob,
-			TaskGroup:          _tg.Name,
-			Metrics:            evlCtx.Metrics(),
-			NodeID:             rnode.Node.ID,
-			NodeName:           rnode.Node.Name,
-			DeploymentID:       deploymentId,
-			TaskResources:      resources.OldTaskResources(),
-			AllocatedResources: resources,
-			DesiredStatus:      structs.AllocDesiredStatusRun,
-			ClientStatus:       structs.AllocClientStatusPending,
-			// SharedResources is considered deprecated, will be removed in 0.11.
-			// It is only set for compat reasons.
-			SharedResources: &structs.Resources{
-				DiskMB:   _tg.EphemeralDisk.SizeMB,
-				Networks: resources.Shared.Networks,
-			},
-		}
-
-		plan.AppendAlloc(alloc, nil)
+		alloc := binpackedAlloc(plan, evlCtx, ljob, _tg, rnode, i, deploymentId)
 		lephemeralAllocations = append(lephemeralAllocations, alloc)
 	}
 
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/helper/uuid"
 	"github.com/hashicorp/nomad/nomad/state"
@@ -9,6 +13,12 @@ import (
 )
 
 func feasiblePoolByConstraint(_pools []*PoolNodeSpec, _job *structs.Job) bool {
+	return len(_job.TaskGroups) > 0 && len(infeasibleTaskGroups(_pools, _job)) == 0
+}
+
+// infeasibleTaskGroups returns task groups that can't be placed on any of pools, with reason why every pool
+// not suited for task group
+func infeasibleTaskGroups(_pools []*PoolNodeSpec, _job *structs.Job) map[string][]string {
 	plan := &structs.Plan{
 		EvalID:          uuid.Generate(),
 		NodeUpdate:      make(map[string][]*structs.Allocation),
@@ -22,52 +32,77 @@ func feasiblePoolByConstraint(_pools []*PoolNodeSpec, _job *structs.Job) bool {
 	evlCtx := scheduler.NewEvalContext(nil, state, plan, logger)
 
 	lpoolNodes := make([]*structs.Node, 0, len(_pools))
+	lpoolNames := make([]string, 0, len(_pools))
+	ljobReasons := []string{}
+
 	constraintChecker := scheduler.NewConstraintChecker(evlCtx, _job.Constraints)
 	for _, lpool := range _pools {
 		lnode := lpool.GetNode("")
 
 		if !containsInSlice(_job.Datacenters, lnode.Datacenter) {
+			ljobReasons = append(ljobReasons, fmt.Sprintf("pool %s: datacenter %q not in job datacenters %v", lpool.GetFullName(), lnode.Datacenter, _job.Datacenters))
 			continue
 		}
 
+		evlCtx.Reset()
 		if constraintChecker.Feasible(lnode) {
 			lpoolNodes = append(lpoolNodes, lnode)
+			lpoolNames = append(lpoolNames, lpool.GetFullName())
+		} else {
+			ljobReasons = append(ljobReasons, fmt.Sprintf("pool %s: job %s", lpool.GetFullName(), filteredReason(evlCtx)))
 		}
 	}
 
-	feasible := false
-	if len(lpoolNodes) > 0 {
-		driversChecker := scheduler.NewDriverChecker(evlCtx, nil)
-		deviceChecker := scheduler.NewDeviceChecker(evlCtx)
+	linfeasible := map[string][]string{}
+	driversChecker := scheduler.NewDriverChecker(evlCtx, nil)
+	deviceChecker := scheduler.NewDeviceChecker(evlCtx)
 
-		for _, ltg := range _job.TaskGroups {
-			deviceChecker.SetTaskGroup(ltg)
+	for _, ltg := range _job.TaskGroups {
+		deviceChecker.SetTaskGroup(ltg)
 
-			constraints := make([]*structs.Constraint, 0, len(ltg.Constraints))
-			constraints = append(constraints, ltg.Constraints...)
-			drivers := make(map[string]struct{})
+		constraints := make([]*structs.Constraint, 0, len(ltg.Constraints))
+		constraints = append(constraints, ltg.Constraints...)
+		drivers := make(map[string]struct{})
 
-			for _, task := range ltg.Tasks {
-				drivers[task.Driver] = struct{}{}
-				constraints = append(constraints, task.Constraints...)
-			}
+		for _, task := range ltg.Tasks {
+			drivers[task.Driver] = struct{}{}
+			constraints = append(constraints, task.Constraints...)
+		}
 
-			constraintChecker.SetConstraints(constraints)
-			driversChecker.SetDrivers(drivers)
-			feasible = false
+		constraintChecker.SetConstraints(constraints)
+		driversChecker.SetDrivers(drivers)
 
-			for _, lpoolNode := range lpoolNodes {
-				feasible = constraintChecker.Feasible(lpoolNode) && driversChecker.Feasible(lpoolNode) && deviceChecker.Feasible(lpoolNode)
-				if feasible {
-					break
-				}
-			}
+		feasible := false
+		ltgReasons := append([]string{}, ljobReasons...)
 
-			if !feasible {
+		for li, lpoolNode := range lpoolNodes {
+			evlCtx.Reset()
+			feasible = constraintChecker.Feasible(lpoolNode) && driversChecker.Feasible(lpoolNode) && deviceChecker.Feasible(lpoolNode)
+			if feasible {
 				break
 			}
+
+			ltgReasons = append(ltgReasons, fmt.Sprintf("pool %s: task group %s", lpoolNames[li], filteredReason(evlCtx)))
 		}
+
+		if !feasible {
+			linfeasible[ltg.Name] = ltgReasons
+		}
+	}
+
+	return linfeasible
+}
+
+func filteredReason(_evlCtx *scheduler.EvalContext) string {
+	lconstraints := make([]string, 0, len(_evlCtx.Metrics().ConstraintFiltered))
+	for lconstraint := range _evlCtx.Metrics().ConstraintFiltered {
+		lconstraints = append(lconstraints, lconstraint)
+	}
+
+	if len(lconstraints) == 0 {
+		return "filtered"
 	}
 
-	return feasible
+	sort.Strings(lconstraints)
+	return fmt.Sprintf("filtered by %s", strings.Join(lconstraints, ", "))
 }
@@ -1,50 +1,289 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/Pramod-Devireddy/go-exprtk"
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-hclog"
 	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider"
 )
 
 type GCInfo struct {
-	poolName             string
-	seenEmptyCiclesCount int
-	Collecting           bool
+	PoolName             string `json:"poolname"`
+	SeenEmptyCiclesCount int    `json:"seenemptycicles"`
+	Collecting           bool   `json:"collecting"`
+	// нода не свободна, ее дренируют, чтобы переупаковать аллокации на другие ноды
+	Consolidating bool `json:"consolidating,omitempty"`
+	// метка дренирования, запущенного gc, пусто пока нода не дренируется
+	DrainId        string    `json:"drainid,omitempty"`
+	DrainStartedAt time.Time `json:"drainstartedat,omitempty"`
 }
 
-func gcAction(_state *StateStat, _gcconfig *GarbageCollectorConfig, _nc *nomad.Client, _pools map[string]*Pool) {
-	lnodesToGC := make(map[string]*GCInfo)
-	lticker := time.NewTicker(_gcconfig.CiclePeriod)
+// по этому ключу в meta дренирования gc узнает свое дренирование в node events
+const cGCDrainMetaKey = "ondemand-scaler.gc"
+
+// gcDrainStatus returns status of drain started by gc with _drainId, empty if nomad has not reported it yet
+func gcDrainStatus(_node *structs.Node, _drainId string) structs.DrainStatus {
+	if _node.LastDrain == nil || _node.LastDrain.Meta[cGCDrainMetaKey] != _drainId {
+		return ""
+	}
+
+	return _node.LastDrain.Status
+}
+
+// gcStartDrain marks node ineligible, so nothing new is placed on it, and then drains it, returns id of drain
+func gcStartDrain(_nc *nomad.Client, _gcconfig *GarbageCollectorConfig, _nodeId string) (string, error) {
+	_, lerr := _nc.Nodes().ToggleEligibility(_nodeId, false, nil)
+	if lerr != nil {
+		return "", fmt.Errorf("can't mark node ineligible due: %s", lerr)
+	}
+
+	ldrainId := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	ldrainOpts := &nomad.DrainOptions{
+		DrainSpec: &nomad.DrainSpec{
+			IgnoreSystemJobs: _gcconfig.DrainIgnoreSystemJobs,
+		},
+		Meta: map[string]string{cGCDrainMetaKey: ldrainId},
+	}
+
+	// у nomad отрицательный deadline - принудительный drain, нулевой - без ограничения
+	if _gcconfig.DrainForce {
+		ldrainOpts.DrainSpec.Deadline = -1
+	} else if _gcconfig.DrainDeadline != nil {
+		ldrainOpts.DrainSpec.Deadline = *_gcconfig.DrainDeadline
+	}
+
+	_, lerr = _nc.Nodes().UpdateDrainOpts(_nodeId, ldrainOpts, nil)
+	if lerr != nil {
+		return "", fmt.Errorf("can't drain node due: %s", lerr)
+	}
+
+	return ldrainId, nil
+}
+
+// gcStartRemove drains nodes that operator asked to remove and registers drains in _nodesToGC, so gc removes these
+// nodes after drain completes the same way as collected ones. Nodes of retired pool are removed the same way, such
+// pool is kept in _pools until gc removes its nodes
+func gcStartRemove(_logger hclog.Logger, _nc *nomad.Client, _gcconfig *GarbageCollectorConfig, _pools *PoolSet, _nodesToGC map[string]*GCInfo, _request *GCRemoveRequest) map[string]*GCRemoveResult {
+	lresults := make(map[string]*GCRemoveResult)
+
+	lreason := "requested by operator"
+	lpool, lok := _pools.Get(_request.Pool)
+	if _request.Retired != nil {
+		lreason = "of retired pool"
+		// пул должен получать обновления нод до начала дренирования, иначе gc не увидит его завершения
+		lpool, lok = _request.Retired, true
+		_pools.Retire(lpool)
+	}
+
+	if !lok {
+		for _, lnodeId := range _request.Nodes {
+			lresults[lnodeId] = &GCRemoveResult{Status: GCRemoveNotFound, Err: fmt.Errorf("pool %s not found", _request.Pool)}
+		}
+
+		return lresults
+	}
+
+	for _, lnodeId := range _request.Nodes {
+		lpool.lock.Lock()
+		_, lok := lpool.nomadNodes[lnodeId]
+		lpool.lock.Unlock()
+
+		// чужую ноду не дренируем
+		if !lok {
+			lresults[lnodeId] = &GCRemoveResult{Status: GCRemoveNotFound, Err: fmt.Errorf("node not in pool")}
+			continue
+		}
+
+		if lgcInfo := _nodesToGC[lnodeId]; lgcInfo != nil && lgcInfo.DrainId != "" {
+			lresults[lnodeId] = &GCRemoveResult{Status: GCRemoveDraining}
+			continue
+		}
+
+		if lpool.IsDryRun() {
+			_logger.Info(fmt.Sprintf("dry run: would drain node %s in pool %s %s", lnodeId, _request.Pool, lreason))
+			lresults[lnodeId] = &GCRemoveResult{Status: GCRemoveDryRun}
+			continue
+		}
+
+		ldrainId, lerr := gcStartDrain(_nc, _gcconfig, lnodeId)
+		if lerr != nil {
+			_logger.Error(fmt.Sprintf("can't start drain of node %s %s: %s", lnodeId, lreason, lerr))
+			lresults[lnodeId] = &GCRemoveResult{Status: GCRemoveFailed, Err: lerr}
+			continue
+		}
+
+		_logger.Info(fmt.Sprintf("draining node %s in pool %s %s", lnodeId, _request.Pool, lreason))
+		_nodesToGC[lnodeId] = &GCInfo{PoolName: _request.Pool, DrainId: ldrainId, DrainStartedAt: time.Now()}
+		lresults[lnodeId] = &GCRemoveResult{Status: GCRemoveDraining}
+		metrics.IncrCounterWithLabels([]string{"gc", "nodesdraining"}, 1, poolLabels(_request.Pool))
+	}
+
+	return lresults
+}
+
+func gcAction(_state *StateStat, _persist *PersistentState, _gcconfigs *atomic.Pointer[GarbageCollectorConfig], _nc *nomad.Client, _pools *PoolSet, _scalingQueue *Queue[*ScalingEvent], _forceCh <-chan struct{}, _removeCh <-chan *GCRemoveRequest) {
+	lnodesToGC := _persist.GetGC()
+	lciclePeriod := _gcconfigs.Load().CiclePeriod
+	lticker := time.NewTicker(lciclePeriod)
 	logger := hclog.L().Named("gc")
+	ljobs := NewGCJobCache(_nc)
+	lfreexprs := FreexprCache{}
+	// когда пул собирался последний раз, у пулов может быть свой период сборки
+	llastCicles := make(map[string]time.Time)
+
+	for {
+		lforced := false
+		select {
+		case <-lticker.C:
+		case <-_forceCh:
+			logger.Info("gc cycle forced by operator")
+			lforced = true
+		case lremoveRequest := <-_removeCh:
+			// ноды удалит обычный цикл gc, когда их дренирование завершится
+			lremoveRequest.Result <- gcStartRemove(logger, _nc, _gcconfigs.Load(), _pools, lnodesToGC, lremoveRequest)
+			_persist.SetGC(lnodesToGC)
+			continue
+		}
+
+		// конфиг и пулы могли быть перезагружены, в течении цикла используем одни и те же
+		lgcconfig := _gcconfigs.Load()
+		lpools := _pools.Pools()
+		lnow := time.Now()
+
+		lpoolConfigs := make(map[string]*GarbageCollectorConfig)
+		lusedFreexprs := make(map[*exprtk.GoExprtk]bool)
+		lnextPeriod := lgcconfig.CiclePeriod
+		for lpoolName := range lpools {
+			lpoolgcconfig, lerr := lgcconfig.ForPool(_pools.Spec(lpoolName), lfreexprs)
+			if lerr != nil {
+				logger.Error(fmt.Sprintf("wrong gc settings of pool %s, global ones are used: %s", lpoolName, lerr))
+			}
+
+			lpoolConfigs[lpoolName] = lpoolgcconfig
+			lusedFreexprs[lpoolgcconfig.AllowedFreexpr] = true
+			lnextPeriod = min(lnextPeriod, lpoolgcconfig.CiclePeriod)
+		}
+
+		// выражения пулов, которых уже нет или у которых выражение сменилось, больше не нужны
+		lfreexprs.Retain(lusedFreexprs)
 
-	for range lticker.C {
+		// цикл идет с периодом самого частого пула, остальные пулы пропускают лишние циклы
+		if lnextPeriod != lciclePeriod {
+			lciclePeriod = lnextPeriod
+			lticker.Reset(lciclePeriod)
+		}
+
+		lqueuedAllocs := queuedAllocsByPools(_scalingQueue)
+		lskippedPools := make(map[string]bool)
+
+		ljobs.Expire(lnow)
 		lnodesToGCCurrentCicle := make(map[string]*GCInfo)
 		_state.DecFreeGcThreads()
 
 		//TODO по идее каждый цикл сборки мусора нужно стопать и скейлинг, тее вводить stop the world паузу
 		allowedfreeByPools := make(map[string]int)
+		// сколько нод можно удалить из пула, не опустившись ниже его min, для пулов без min не задано
+		removableByPools := make(map[string]int)
+		// состояние дренирований, запущенных gc, по последним node events
+		ldrainStatuses := make(map[string]structs.DrainStatus)
+
+		// у убранных пулов только ждем завершения дренирований, пул без дренируемых нод больше не нужен
+		lretiredPools := _pools.Retired()
+		for lpoolName, lpool := range lretiredPools {
+			ldraining := false
 
-		for _, lpool := range _pools {
+			lpool.lock.Lock()
+			for _, lnode := range lpool.nomadNodes {
+				if lgcInfo := lnodesToGC[lnode.ID]; lgcInfo != nil && lgcInfo.DrainId != "" {
+					ldrainStatuses[lnode.ID] = gcDrainStatus(lnode, lgcInfo.DrainId)
+					lnodesToGCCurrentCicle[lnode.ID] = lgcInfo
+					ldraining = true
+				}
+			}
+			lpool.lock.Unlock()
+
+			if !ldraining {
+				logger.Info(fmt.Sprintf("retired pool %s has no more draining nodes, forget it", lpoolName))
+				_pools.Forget(lpoolName)
+			}
+		}
+
+		for _, lpool := range lpools {
 			lallocsByNodes := make(map[string]int)
 			lpoolTotalNodes := 0
 			lpoolBusyNodes := 0
 
+			lpoolgcconfig := lpoolConfigs[lpool.GetName()]
+			ldue := lforced || lnow.Sub(llastCicles[lpool.GetName()]) >= lpoolgcconfig.CiclePeriod-lciclePeriod/2
+			if ldue {
+				llastCicles[lpool.GetName()] = lnow
+			} else {
+				lskippedPools[lpool.GetName()] = true
+			}
+
 			lpool.lock.Lock()
 
 			for _, lnode := range lpool.nomadNodes {
+				// дренируемая нода уже уходит из пула, ни свободной ни занятой ее не считаем
+				if lgcInfo := lnodesToGC[lnode.ID]; lgcInfo != nil && lgcInfo.DrainId != "" {
+					ldrainStatuses[lnode.ID] = gcDrainStatus(lnode, lgcInfo.DrainId)
+					lnodesToGCCurrentCicle[lnode.ID] = lgcInfo
+					continue
+				}
+
+				// пул в этом цикле не собираем, его ноды остаются как были
+				if !ldue {
+					if lgcInfo := lnodesToGC[lnode.ID]; lgcInfo != nil {
+						lnodesToGCCurrentCicle[lnode.ID] = lgcInfo
+					}
+					continue
+				}
+
 				lallocsByNodes[lnode.ID] = 0
 				lpoolTotalNodes += 1
 			}
 
+			if !ldue {
+				lpool.lock.Unlock()
+				continue
+			}
+
+			lpoolAllocs := make([]*structs.Allocation, 0, len(lpool.nomadAllocs))
 			for _, lalloc := range lpool.nomadAllocs {
-				lallocsByNodes[lalloc.NodeID] += 1
+				if _, lok := lallocsByNodes[lalloc.NodeID]; lok {
+					lpoolAllocs = append(lpoolAllocs, lalloc)
+				}
 			}
 
+			lminNodes, lmaxNodes := lpool.minNodes, lpool.maxNodes
+			lpoolEphemeralNodes := len(lpool.ephemeralnomadNodes)
+			// аллокации скейлингов в процессе, которые еще ждут свои ноды
+			lpoolEphemeralAllocs := len(lpool.ephemeralnomadAllocs)
 			lpool.lock.Unlock()
 
+			// аллокации system jobs и прочих, что есть на каждой ноде, не делают ноду занятой
+			for _, lalloc := range lpoolAllocs {
+				if lreason := lgcconfig.AllocIdleReason(lalloc, ljobs); lreason != "" {
+					logger.Trace(fmt.Sprintf("alloc %s on node %s doesn't keep node busy: %s", lalloc.ID, lalloc.NodeID, lreason))
+					continue
+				}
+
+				lallocsByNodes[lalloc.NodeID] += 1
+			}
+
+			if lminNodes > 0 {
+				removableByPools[lpool.GetName()] = max(lpoolTotalNodes-lminNodes, 0)
+			}
+
 			for lnodeId, lnodeAllocCount := range lallocsByNodes {
 				if lnodeAllocCount == 0 {
 					lgcInfo := lnodesToGC[lnodeId]
@@ -53,8 +292,8 @@ func gcAction(_state *StateStat, _gcconfig *GarbageCollectorConfig, _nc *nomad.C
 						lnodesToGC[lnodeId] = lgcInfo
 					}
 
-					lgcInfo.poolName = lpool.GetName()
-					lgcInfo.seenEmptyCiclesCount += 1
+					lgcInfo.PoolName = lpool.GetName()
+					lgcInfo.SeenEmptyCiclesCount += 1
 
 					lnodesToGCCurrentCicle[lnodeId] = lgcInfo
 				} else {
@@ -62,18 +301,51 @@ func gcAction(_state *StateStat, _gcconfig *GarbageCollectorConfig, _nc *nomad.C
 				}
 			}
 
-			if _gcconfig.AllowedFreexpr != nil {
-				_gcconfig.AllowedFreexpr.SetDoubleVariableValue("totalnodes", float64(lpoolTotalNodes))
-				_gcconfig.AllowedFreexpr.SetDoubleVariableValue("busynodes", float64(lpoolBusyNodes))
+			lpoolSpec := _pools.Spec(lpool.GetName())
+
+			allowedFreenodes := 0
+			if lpoolgcconfig.AllowedFreexpr != nil {
+				lvars := &FreexprVariables{
+					TotalNodes:     lpoolTotalNodes,
+					BusyNodes:      lpoolBusyNodes,
+					EphemeralNodes: lpoolEphemeralNodes,
+					QueuedAllocs:   lqueuedAllocs[lpool.GetName()] + lpoolEphemeralAllocs,
+					ScaleUpRate:    lpool.ScaleUpRate(lnow),
+					Now:            lnow,
+				}
+
+				if lpoolSpec != nil {
+					lres := lpoolSpec.GetResources()
+					lvars.NodeCpu, lvars.NodeMem = lres.Cpu, lres.MemMB
+				}
+
+				allowedFreenodes = evalAllowedFreexpr(lpoolgcconfig.AllowedFreexpr, lvars)
+			}
+
+			// в активном окне прогрева держим не меньше свободных нод, чем задано окном
+			lwarmIdle := 0
+			if lpoolSpec != nil {
+				lwindows, _ := lpoolSpec.GetWarmWindows()
+				lwarmIdle = warmIdleNodes(lwindows, lnow)
+			}
+			allowedFreenodes = max(allowedFreenodes, lwarmIdle)
+
+			// пул больше max(например max уменьшили при перезагрузке конфига), лишние свободные ноды не держим
+			if lmaxNodes > 0 && lpoolTotalNodes > lmaxNodes {
+				allowedFreenodes = max(allowedFreenodes-(lpoolTotalNodes-lmaxNodes), 0)
+			}
+			allowedfreeByPools[lpool.GetName()] = allowedFreenodes
 
-				allowedFreenodes := int(_gcconfig.AllowedFreexpr.GetEvaluatedValue())
-				allowedfreeByPools[lpool.GetName()] = allowedFreenodes
+			nodesTolaunch := max(allowedFreenodes-(lpoolTotalNodes-lpoolBusyNodes), lminNodes-lpoolTotalNodes)
+			if lmaxNodes > 0 {
+				nodesTolaunch = min(nodesTolaunch, lmaxNodes-lpoolTotalNodes)
+			}
 
-				nodesTolaunch := allowedFreenodes - (lpoolTotalNodes - lpoolBusyNodes)
-				if nodesTolaunch > 0 {
-					go lpool.WarmUp(nodesTolaunch)
-					logger.Info(fmt.Sprintf("warming up pool %s allowered_free: %d, total_nodes: %d, busy_nodes: %d", lpool.GetName(), allowedFreenodes, lpoolTotalNodes, lpoolBusyNodes))
-					metrics.IncrCounter([]string{"gc", "nodestoadd"}, float32(nodesTolaunch))
+			if nodesTolaunch > 0 {
+				go lpool.WarmUp(nodesTolaunch)
+				logger.Info(fmt.Sprintf("warming up pool %s allowered_free: %d, warm_idle: %d, min_nodes: %d, total_nodes: %d, busy_nodes: %d", lpool.GetName(), allowedFreenodes, lwarmIdle, lminNodes, lpoolTotalNodes, lpoolBusyNodes))
+				if !lpool.IsDryRun() {
+					metrics.IncrCounterWithLabels([]string{"gc", "nodestoadd"}, float32(nodesTolaunch), poolLabels(lpool.GetName()))
 				}
 			}
 		}
@@ -94,32 +366,142 @@ func gcAction(_state *StateStat, _gcconfig *GarbageCollectorConfig, _nc *nomad.C
 		gcnodedesdeleted := make(map[string][]string)
 
 		for lnodeId, gcInfo := range lnodesToGC {
-			if gcInfo.seenEmptyCiclesCount >= _gcconfig.CiclesToGc && !gcInfo.Collecting {
-				if allowedfreeByPools[gcInfo.poolName] > 0 {
-					allowedfreeByPools[gcInfo.poolName] -= 1
+			if gcInfo.DrainId != "" {
+				if gcInfo.Collecting {
+					continue
+				}
+
+				// к провайдеру идем только когда nomad закончил миграцию аллокаций с ноды
+				switch ldrainStatuses[lnodeId] {
+				case structs.DrainStatusComplete:
+					logger.Info(fmt.Sprintf("node %s in pool %s drained in %s", lnodeId, gcInfo.PoolName, time.Since(gcInfo.DrainStartedAt).Round(time.Second)))
+					gcnodedesdeleted[gcInfo.PoolName] = append(gcnodedesdeleted[gcInfo.PoolName], lnodeId)
+					gcInfo.Collecting = true
+				case structs.DrainStatusCanceled:
+					// дренирование отменили руками, значит ноду трогать не хотят, начинаем отсчет заново
+					logger.Warn(fmt.Sprintf("drain of node %s in pool %s was canceled, node will not be removed", lnodeId, gcInfo.PoolName))
+					delete(lnodesToGC, lnodeId)
+				default:
+					logger.Debug(fmt.Sprintf("node %s in pool %s is still draining, started at %s", lnodeId, gcInfo.PoolName, gcInfo.DrainStartedAt))
+				}
+
+				continue
+			}
+
+			if lskippedPools[gcInfo.PoolName] {
+				continue
+			}
+
+			if gcInfo.SeenEmptyCiclesCount >= lpoolConfigs[gcInfo.PoolName].CiclesToGc && !gcInfo.Collecting {
+				if allowedfreeByPools[gcInfo.PoolName] > 0 {
+					allowedfreeByPools[gcInfo.PoolName] -= 1
 					continue
 				}
 
-				logger.Info(fmt.Sprintf("garbage colected node: %s in pool %s after %d gc cicles", lnodeId, gcInfo.poolName, gcInfo.seenEmptyCiclesCount))
+				if lremovable, lok := removableByPools[gcInfo.PoolName]; lok {
+					if lremovable <= 0 {
+						continue
+					}
+					removableByPools[gcInfo.PoolName] = lremovable - 1
+				}
+
+				logger.Info(fmt.Sprintf("garbage colected node: %s in pool %s after %d gc cicles", lnodeId, gcInfo.PoolName, gcInfo.SeenEmptyCiclesCount))
+
+				if lpools[gcInfo.PoolName].IsDryRun() {
+					logger.Info(fmt.Sprintf("dry run: would drain node %s", lnodeId))
+					gcnodedesdeleted[gcInfo.PoolName] = append(gcnodedesdeleted[gcInfo.PoolName], lnodeId)
+					gcInfo.Collecting = true
+					continue
+				}
 
-				ldrainSpec := &nomad.DrainSpec{}
-				_, lerr := _nc.Nodes().UpdateDrain(lnodeId, ldrainSpec, false, nil)
+				ldrainId, lerr := gcStartDrain(_nc, lgcconfig, lnodeId)
 				if lerr != nil {
-					logger.Error(fmt.Sprintf("can't drain node %s: %s", lnodeId, lerr))
+					// попробуем в следующем цикле gc
+					logger.Error(fmt.Sprintf("can't start drain of node %s: %s", lnodeId, lerr))
+					continue
+				}
+
+				gcInfo.DrainId = ldrainId
+				gcInfo.DrainStartedAt = time.Now()
+				metrics.IncrCounterWithLabels([]string{"gc", "nodesdraining"}, 1, poolLabels(gcInfo.PoolName))
+			}
+		}
+
+		// переупаковка: недогруженные ноды дренируем, nomad перенесет их аллокации на остальные ноды пула
+		if lgcconfig.Consolidate {
+			for lpoolName, lpool := range lpools {
+				if lskippedPools[lpoolName] {
+					continue
+				}
+
+				lmaxNodes := lgcconfig.ConsolidateMaxNodes
+				if lremovable, lok := removableByPools[lpoolName]; lok {
+					lmaxNodes = min(lmaxNodes, lremovable)
 				}
 
-				gcnodedesdeleted[gcInfo.poolName] = append(gcnodedesdeleted[gcInfo.poolName], lnodeId)
-				gcInfo.Collecting = true
+				for _, lnodeId := range consolidationCandidates(logger.With("pool", lpoolName), lpool, lgcconfig, ljobs, lnodesToGC, lmaxNodes) {
+					if lpool.IsDryRun() {
+						logger.Info(fmt.Sprintf("dry run: would drain node %s in pool %s to consolidate it", lnodeId, lpoolName))
+						continue
+					}
+
+					ldrainId, lerr := gcStartDrain(_nc, lgcconfig, lnodeId)
+					if lerr != nil {
+						logger.Error(fmt.Sprintf("can't start drain of node %s to consolidate it: %s", lnodeId, lerr))
+						continue
+					}
+
+					logger.Info(fmt.Sprintf("consolidating node %s in pool %s", lnodeId, lpoolName))
+					lnodesToGC[lnodeId] = &GCInfo{PoolName: lpoolName, Consolidating: true, DrainId: ldrainId, DrainStartedAt: time.Now()}
+					metrics.IncrCounterWithLabels([]string{"gc", "nodesconsolidated"}, 1, poolLabels(lpoolName))
+				}
 			}
 		}
 
 		//TODO здесь stop the world паузу можно уже отпускать
 
 		for lpoolName, lnodeIds := range gcnodedesdeleted {
-			_pools[lpoolName].RemoveNode(lnodeIds)
-			metrics.IncrCounter([]string{"gc", "nodestoremove"}, float32(len(lnodeIds)))
+			lpool, lok := lpools[lpoolName]
+			if !lok {
+				lpool = lretiredPools[lpoolName]
+			}
+
+			// в dry run пул только запишет, что удалил бы ноды, в метриках таких удалений быть не должно
+			ldryRun := lpool.IsDryRun()
+			if !ldryRun {
+				metrics.IncrCounterWithLabels([]string{"gc", "nodestoremove"}, float32(len(lnodeIds)), poolLabels(lpoolName))
+			}
+
+			lctx, lcancel := context.WithTimeout(context.Background(), lgcconfig.RemoveTimeout)
+			lresults := lpool.RemoveNode(lctx, lnodeIds)
+			lcancel()
+
+			for _, lnodeId := range lnodeIds {
+				lresult, lok := lresults[lnodeId]
+				if !lok {
+					lresult = &nodeprovider.RemoveNodeResult{Status: nodeprovider.RemoveNodeStatusFailedRetryable, Reason: fmt.Errorf("no result from pool")}
+				}
+
+				switch lresult.Status {
+				case nodeprovider.RemoveNodeStatusRemoved, nodeprovider.RemoveNodeStatusNotFound:
+					delete(lnodesToGC, lnodeId)
+					if !ldryRun {
+						metrics.IncrCounterWithLabels([]string{"gc", "nodesremoved"}, 1, poolLabels(lpoolName))
+					}
+				case nodeprovider.RemoveNodeStatusFailedRetryable:
+					// попробуем удалить в следующем цикле gc
+					lnodesToGC[lnodeId].Collecting = false
+					logger.Warn(fmt.Sprintf("removing node %s in pool %s failed, will retry: %s", lnodeId, lpoolName, lresult))
+					metrics.IncrCounterWithLabels([]string{"gc", "nodesremovefailed"}, 1, poolLabels(lpoolName))
+				default:
+					// оставляем Collecting, чтобы не пытаться удалять ноду снова и снова
+					logger.Error(fmt.Sprintf("removing node %s in pool %s failed permanently: %s", lnodeId, lpoolName, lresult))
+					metrics.IncrCounterWithLabels([]string{"gc", "nodesremovefailed"}, 1, poolLabels(lpoolName))
+				}
+			}
 		}
 
+		_persist.SetGC(lnodesToGC)
 		_state.IncFreeGcThreads()
 	}
 }
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Pramod-Devireddy/go-exprtk"
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
 )
 
 func TestExprtkGCMaxFreeExpression(t *testing.T) {
@@ -66,3 +74,145 @@ func TestExprtkIfExpression(t *testing.T) {
 	}
 	t.Logf("result: %d", result)
 }
+
+func TestGCStartDrain(t *testing.T) {
+	lrequests := []string{}
+	var ldrainRequest nomad.NodeUpdateDrainRequest
+
+	lnomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lrequests = append(lrequests, r.URL.Path)
+		if r.URL.Path == "/v1/node/node-1/drain" {
+			json.NewDecoder(r.Body).Decode(&ldrainRequest)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer lnomadServer.Close()
+
+	lnc, lerr := nomad.NewClient(&nomad.Config{Address: lnomadServer.URL})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	ldeadline := 5 * time.Minute
+	ldrainId, lerr := gcStartDrain(lnc, &GarbageCollectorConfig{DrainDeadline: &ldeadline, DrainIgnoreSystemJobs: true}, "node-1")
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if !reflect.DeepEqual(lrequests, []string{"/v1/node/node-1/eligibility", "/v1/node/node-1/drain"}) {
+		t.Fatalf("node must be marked ineligible before drain, got requests: %v", lrequests)
+	}
+
+	if ldrainRequest.DrainSpec == nil || ldrainRequest.DrainSpec.Deadline != 5*time.Minute || !ldrainRequest.DrainSpec.IgnoreSystemJobs || ldrainRequest.Meta[cGCDrainMetaKey] != ldrainId {
+		t.Fatalf("wrong drain request: %+v", ldrainRequest)
+	}
+
+	// nomad понимает отрицательный deadline как принудительный drain
+	if _, lerr := gcStartDrain(lnc, &GarbageCollectorConfig{DrainDeadline: &ldeadline, DrainForce: true}, "node-1"); lerr != nil || ldrainRequest.DrainSpec.Deadline >= 0 {
+		t.Fatalf("forced drain must have negative deadline, got %+v: %v", ldrainRequest.DrainSpec, lerr)
+	}
+
+	lnoDeadline := time.Duration(0)
+	if _, lerr := gcStartDrain(lnc, &GarbageCollectorConfig{DrainDeadline: &lnoDeadline}, "node-1"); lerr != nil || ldrainRequest.DrainSpec.Deadline != 0 {
+		t.Fatalf("drain without deadline must have zero deadline, got %+v: %v", ldrainRequest.DrainSpec, lerr)
+	}
+}
+
+func TestGCStartRemove(t *testing.T) {
+	ldrained := []string{}
+	lnomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lnodeId, lok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/node/"), "/drain"); lok {
+			ldrained = append(ldrained, lnodeId)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer lnomadServer.Close()
+
+	lnc, lerr := nomad.NewClient(&nomad.Config{Address: lnomadServer.URL})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lpool := &Pool{
+		logger:   hclog.L(),
+		fullName: "workers",
+		nomadNodes: map[string]*structs.Node{
+			"node-1": {ID: "node-1"},
+			"node-2": {ID: "node-2"},
+		},
+	}
+	lpools := NewPoolSet(map[string]*Pool{"workers": lpool}, nil)
+	lnodesToGC := map[string]*GCInfo{
+		"node-2": {PoolName: "workers", DrainId: "1"},
+	}
+
+	lresults := gcStartRemove(hclog.L(), lnc, &GarbageCollectorConfig{}, lpools, lnodesToGC, &GCRemoveRequest{Pool: "workers", Nodes: []string{"node-1", "node-2", "node-3"}})
+
+	for lnodeId, lstatus := range map[string]string{"node-1": GCRemoveDraining, "node-2": GCRemoveDraining, "node-3": GCRemoveNotFound} {
+		if lresults[lnodeId] == nil || lresults[lnodeId].Status != lstatus {
+			t.Fatalf("%s status expected for %s, got %+v", lstatus, lnodeId, lresults[lnodeId])
+		}
+	}
+
+	// чужую и уже дренируемую ноды не трогаем
+	if !reflect.DeepEqual(ldrained, []string{"node-1"}) {
+		t.Fatalf("only node-1 must be drained, got %v", ldrained)
+	}
+
+	if lgcInfo := lnodesToGC["node-1"]; lgcInfo == nil || lgcInfo.PoolName != "workers" || lgcInfo.DrainId == "" || lgcInfo.Consolidating {
+		t.Fatalf("drain of node-1 must be tracked by gc, got %+v", lgcInfo)
+	}
+
+	lresults = gcStartRemove(hclog.L(), lnc, &GarbageCollectorConfig{}, lpools, lnodesToGC, &GCRemoveRequest{Pool: "unknown", Nodes: []string{"node-1"}})
+	if lresults["node-1"] == nil || lresults["node-1"].Status != GCRemoveNotFound {
+		t.Fatalf("nodes of unknown pool must not be found, got %+v", lresults["node-1"])
+	}
+
+	// убранного пула нет в PoolSet, gc дренирует его ноды и держит пул, пока их не удалит
+	lretiredPool := &Pool{
+		logger:     hclog.L(),
+		fullName:   "retired",
+		nomadNodes: map[string]*structs.Node{"node-4": {ID: "node-4"}},
+	}
+
+	lresults = gcStartRemove(hclog.L(), lnc, &GarbageCollectorConfig{}, lpools, lnodesToGC, &GCRemoveRequest{Pool: "retired", Nodes: []string{"node-4"}, Retired: lretiredPool})
+	if lresults["node-4"] == nil || lresults["node-4"].Status != GCRemoveDraining {
+		t.Fatalf("node of retired pool must be draining, got %+v", lresults["node-4"])
+	}
+
+	if lgcInfo := lnodesToGC["node-4"]; lgcInfo == nil || lgcInfo.PoolName != "retired" || lgcInfo.DrainId == "" {
+		t.Fatalf("drain of node-4 must be tracked by gc, got %+v", lgcInfo)
+	}
+
+	if lpools.Retired()["retired"] != lretiredPool {
+		t.Fatalf("retired pool must be kept until gc removes its nodes")
+	}
+
+	lpools.Replace(map[string]*Pool{"workers": lpool, "retired": {fullName: "retired"}}, nil)
+	if len(lpools.Retired()) != 0 {
+		t.Fatalf("pool returned to config must not be retired anymore")
+	}
+}
+
+func TestGCDrainStatus(t *testing.T) {
+	lnode := apiNomadNodeToStructsNode(&nomad.Node{
+		ID: "node-1",
+		LastDrain: &nomad.DrainMetadata{
+			Status: nomad.DrainStatusComplete,
+			Meta:   map[string]string{cGCDrainMetaKey: "42"},
+		},
+	})
+
+	if lstatus := gcDrainStatus(lnode, "42"); lstatus != structs.DrainStatusComplete {
+		t.Fatalf("drain must be complete, got %q", lstatus)
+	}
+
+	// завершено чужое или прошлое дренирование
+	if lstatus := gcDrainStatus(lnode, "43"); lstatus != "" {
+		t.Fatalf("drain of other gc cycle must not be reported, got %q", lstatus)
+	}
+
+	if lstatus := gcDrainStatus(&structs.Node{ID: "node-2"}, "42"); lstatus != "" {
+		t.Fatalf("never drained node must have no drain status, got %q", lstatus)
+	}
+}
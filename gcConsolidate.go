@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/helper/uuid"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/hashicorp/nomad/scheduler"
+)
+
+// consolidationNode is pool node with its allocations, busy ones must be moved to other nodes if node is consolidated
+type consolidationNode struct {
+	node        *structs.Node
+	allocs      []*structs.Allocation
+	busyAllocs  []*structs.Allocation
+	utilization float64
+}
+
+// allocUnmovableReason returns empty string if nomad may move allocation of job to other node, when its node is
+// drained
+func allocUnmovableReason(_alloc *structs.Allocation, _job *structs.Job) string {
+	ltg := _job.LookupTaskGroup(_alloc.TaskGroup)
+	if ltg == nil {
+		return fmt.Sprintf("task group %s not found in job %s", _alloc.TaskGroup, _job.ID)
+	}
+
+	if ltg.EphemeralDisk != nil && ltg.EphemeralDisk.Sticky {
+		return fmt.Sprintf("task group %s of job %s has sticky ephemeral disk", ltg.Name, _job.ID)
+	}
+
+	switch _job.Type {
+	case structs.JobTypeService:
+		if ltg.Migrate == nil || ltg.Migrate.MaxParallel <= 0 {
+			return fmt.Sprintf("migrate policy of task group %s of job %s doesn't allow migration", ltg.Name, _job.ID)
+		}
+	case structs.JobTypeBatch:
+		if ltg.ReschedulePolicy == nil || (!ltg.ReschedulePolicy.Unlimited && ltg.ReschedulePolicy.Attempts <= 0) {
+			return fmt.Sprintf("reschedule policy of task group %s of job %s doesn't allow rescheduling", ltg.Name, _job.ID)
+		}
+	default:
+		return fmt.Sprintf("allocations of %s job %s are not moved", _job.Type, _job.ID)
+	}
+
+	return ""
+}
+
+// nodeUtilization returns max of cpu and memory share of node, that allocations use
+func nodeUtilization(_node *structs.Node, _allocs []*structs.Allocation) float64 {
+	lcapacity := _node.ComparableResources()
+	lcapacity.Subtract(_node.ComparableReservedResources())
+
+	lused := &structs.ComparableResources{}
+	for _, lalloc := range _allocs {
+		lused.Add(lalloc.ComparableResources())
+	}
+
+	lutilization := 0.0
+	if lcapacity.Flattened.Cpu.CpuShares > 0 {
+		lutilization = max(lutilization, float64(lused.Flattened.Cpu.CpuShares)/float64(lcapacity.Flattened.Cpu.CpuShares))
+	}
+	if lcapacity.Flattened.Memory.MemoryMB > 0 {
+		lutilization = max(lutilization, float64(lused.Flattened.Memory.MemoryMB)/float64(lcapacity.Flattened.Memory.MemoryMB))
+	}
+
+	return lutilization
+}
+
+// consolidationCandidates returns up to _maxNodes least utilized pool nodes, whose busy allocations, as nomad
+// scheduler simulation shows, fit on other busy nodes of pool. Nodes already collected by gc(_nodesToGC) are not
+// considered, and nothing is returned while pool is scaling or some its node is draining
+func consolidationCandidates(_logger hclog.Logger, _pool *Pool, _gcconfig *GarbageCollectorConfig, _jobs *GCJobCache, _nodesToGC map[string]*GCInfo, _maxNodes int) []string {
+	if _maxNodes <= 0 {
+		return nil
+	}
+
+	for _, lgcInfo := range _nodesToGC {
+		if lgcInfo.PoolName == _pool.GetName() && (lgcInfo.DrainId != "" || lgcInfo.Collecting) {
+			return nil
+		}
+	}
+
+	_pool.lock.Lock()
+	if len(_pool.ephemeralnomadNodes) > 0 {
+		_pool.lock.Unlock()
+		return nil
+	}
+
+	lnodes := map[string]*consolidationNode{}
+	for lnodeId, lnode := range _pool.nomadNodes {
+		if lnode.Status != structs.NodeStatusReady || lnode.SchedulingEligibility != structs.NodeSchedulingEligible || lnode.DrainStrategy != nil {
+			continue
+		}
+
+		if _, lok := _nodesToGC[lnodeId]; lok {
+			continue
+		}
+
+		lnodes[lnodeId] = &consolidationNode{node: lnode}
+	}
+
+	for _, lalloc := range _pool.nomadAllocs {
+		if lnode, lok := lnodes[lalloc.NodeID]; lok {
+			lnode.allocs = append(lnode.allocs, lalloc)
+		}
+	}
+	_pool.lock.Unlock()
+
+	lcandidates := []*consolidationNode{}
+	for lnodeId, lnode := range lnodes {
+		for _, lalloc := range lnode.allocs {
+			if _gcconfig.AllocIdleReason(lalloc, _jobs) == "" {
+				lnode.busyAllocs = append(lnode.busyAllocs, lalloc)
+			}
+		}
+
+		// на свободные ноды ничего не переносим, ими занимается обычная сборка мусора
+		if len(lnode.busyAllocs) == 0 {
+			delete(lnodes, lnodeId)
+			continue
+		}
+
+		lnode.utilization = nodeUtilization(lnode.node, lnode.allocs)
+		if lnode.utilization < _gcconfig.ConsolidateUtilization {
+			lcandidates = append(lcandidates, lnode)
+		}
+	}
+
+	sort.Slice(lcandidates, func(i, j int) bool {
+		if lcandidates[i].utilization != lcandidates[j].utilization {
+			return lcandidates[i].utilization < lcandidates[j].utilization
+		}
+		return lcandidates[i].node.ID < lcandidates[j].node.ID
+	})
+
+	lchosen := []string{}
+	// куда по симуляции переедут аллокации уже выбранных нод
+	lmoved := []*structs.Allocation{}
+
+	for _, lcandidate := range lcandidates {
+		if len(lchosen) >= _maxNodes {
+			break
+		}
+
+		ltoMove := []*structs.Allocation{}
+		lunmovable := ""
+		for _, lalloc := range lcandidate.busyAllocs {
+			ljob, lerr := _jobs.Get(lalloc)
+			if lerr != nil {
+				lunmovable = lerr.Error()
+				break
+			}
+
+			if lunmovable = allocUnmovableReason(lalloc, ljob.Job); lunmovable != "" {
+				break
+			}
+
+			lallocWithJob := lalloc.Copy()
+			lallocWithJob.Job = ljob.Job
+			ltoMove = append(ltoMove, lallocWithJob)
+		}
+
+		if lunmovable != "" {
+			_logger.Debug(fmt.Sprintf("node %s(utilization %.2f) can't be consolidated: %s", lcandidate.node.ID, lcandidate.utilization, lunmovable))
+			continue
+		}
+
+		plan, evlCtx, stack := newBinpacking()
+
+		ltargets := []*structs.Node{}
+		for lnodeId, lnode := range lnodes {
+			if lnodeId == lcandidate.node.ID || containsInSlice(lchosen, lnodeId) {
+				continue
+			}
+
+			ltargets = append(ltargets, lnode.node)
+			for _, lalloc := range lnode.allocs {
+				// AppendAlloc затирает job у аллокации, а аллокации пула трогать нельзя
+				plan.AppendAlloc(lalloc.CopySkipJob(), nil)
+			}
+		}
+
+		lstillMoved := []*structs.Allocation{}
+		for _, lalloc := range lmoved {
+			if lalloc.NodeID == lcandidate.node.ID {
+				// то, что по симуляции переехало на кандидата, придется переносить еще раз
+				ltoMove = append(ltoMove, lalloc)
+				continue
+			}
+
+			plan.AppendAlloc(lalloc.CopySkipJob(), nil)
+			lstillMoved = append(lstillMoved, lalloc)
+		}
+
+		if len(ltargets) == 0 {
+			break
+		}
+
+		stack.SetNodes(ltargets)
+		ldeploymentId := uuid.Generate()
+		lplaced := []*structs.Allocation{}
+		lfits := true
+
+		for li, lalloc := range ltoMove {
+			ljob := lalloc.Job.Copy()
+			ljob.Status = structs.JobStatusPending
+			ltg := ljob.LookupTaskGroup(lalloc.TaskGroup)
+
+			stack.SetJob(ljob)
+			lrnode := stack.Select(ltg, &scheduler.SelectOptions{})
+			if lrnode == nil {
+				lfits = false
+				break
+			}
+
+			lplacedAlloc := binpackedAlloc(plan, evlCtx, ljob, ltg, lrnode, li, ldeploymentId)
+			// job нужен, если аллокацию придется переносить еще раз
+			lplacedAlloc.Job = ljob
+			lplaced = append(lplaced, lplacedAlloc)
+		}
+
+		if !lfits {
+			_logger.Debug(fmt.Sprintf("node %s(utilization %.2f) can't be consolidated: its allocations don't fit on other nodes", lcandidate.node.ID, lcandidate.utilization))
+			continue
+		}
+
+		_logger.Info(fmt.Sprintf("node %s(utilization %.2f) can be consolidated, %d allocations fit on other nodes", lcandidate.node.ID, lcandidate.utilization, len(lplaced)))
+		lchosen = append(lchosen, lcandidate.node.ID)
+		lmoved = append(lstillMoved, lplaced...)
+	}
+
+	return lchosen
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestConsolidationCandidates(t *testing.T) {
+	lpoolSpecs, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 1000
+  drivers:
+    - docker
+  provider:
+    name: anynode
+`))
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lpool, lerr := NewPool(lpoolSpecs[0])
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lparseJob := func(_name string, _text string) *structs.Job {
+		lapiJob, lerr := parseJobFile(writeTestFile(t, _name, _text))
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+
+		return apiNomadJobToStructsJobV2(lapiJob)
+	}
+
+	lweb := lparseJob("web.nomad", `
+job "web" {
+  datacenters = ["test"]
+
+  group "app" {
+    count = 4
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "nginx"
+      }
+      resources {
+        cpu    = 300
+        memory = 100
+      }
+    }
+  }
+}
+`)
+	lreport := lparseJob("report.nomad", `
+job "report" {
+  datacenters = ["test"]
+  type        = "batch"
+
+  group "app" {
+    reschedule {
+      attempts  = 0
+      unlimited = false
+    }
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "report"
+      }
+      resources {
+        cpu    = 100
+        memory = 100
+      }
+    }
+  }
+}
+`)
+
+	lalloc := func(_id string, _nodeId string, _job *structs.Job) *structs.Allocation {
+		lresources := _job.TaskGroups[0].Tasks[0].Resources
+		return &structs.Allocation{
+			ID:            _id,
+			NodeID:        _nodeId,
+			Namespace:     _job.Namespace,
+			JobID:         _job.ID,
+			Job:           _job,
+			TaskGroup:     "app",
+			DesiredStatus: structs.AllocDesiredStatusRun,
+			ClientStatus:  structs.AllocClientStatusRunning,
+			AllocatedResources: &structs.AllocatedResources{
+				Tasks: map[string]*structs.AllocatedTaskResources{
+					"server": {
+						Cpu:    structs.AllocatedCpuResources{CpuShares: int64(lresources.CPU)},
+						Memory: structs.AllocatedMemoryResources{MemoryMB: int64(lresources.MemoryMB)},
+					},
+				},
+			},
+		}
+	}
+
+	for _, lnodeId := range []string{"node-1", "node-2", "node-3"} {
+		lpool.nomadNodes[lnodeId] = lpoolSpecs[0].GetNode(lnodeId)
+	}
+	lpool.nomadAllocs = map[string]*structs.Allocation{
+		"web-1": lalloc("web-1", "node-1", lweb),
+		"web-2": lalloc("web-2", "node-1", lweb),
+		"web-3": lalloc("web-3", "node-2", lweb),
+		"web-4": lalloc("web-4", "node-3", lweb),
+	}
+
+	lgcconfig := &GarbageCollectorConfig{BusyJobTypes: []string{structs.JobTypeService, structs.JobTypeBatch}, ConsolidateUtilization: 0.5}
+	ljobs := NewGCJobCache(nil)
+
+	// node-2 и node-3 загружены на 30%, но на node-1(60%) поместится аллокация только одной из них
+	lchosen := consolidationCandidates(hclog.L(), lpool, lgcconfig, ljobs, map[string]*GCInfo{}, 2)
+	if !reflect.DeepEqual(lchosen, []string{"node-2"}) {
+		t.Fatalf("only node-2 must be consolidated, got %v", lchosen)
+	}
+
+	// аллокацию batch job без перепланирования двигать нельзя
+	lpool.nomadAllocs["report-1"] = lalloc("report-1", "node-2", lreport)
+	lchosen = consolidationCandidates(hclog.L(), lpool, lgcconfig, ljobs, map[string]*GCInfo{}, 2)
+	if !reflect.DeepEqual(lchosen, []string{"node-3"}) {
+		t.Fatalf("only node-3 must be consolidated, got %v", lchosen)
+	}
+
+	if lchosen := consolidationCandidates(hclog.L(), lpool, lgcconfig, ljobs, map[string]*GCInfo{"node-4": {PoolName: lpool.GetName(), DrainId: "1"}}, 2); len(lchosen) != 0 {
+		t.Fatalf("nothing must be consolidated while pool node is draining, got %v", lchosen)
+	}
+
+	lpool.ephemeralnomadNodes = []*structs.Node{{ID: "ephemeral-node"}}
+	if lchosen := consolidationCandidates(hclog.L(), lpool, lgcconfig, ljobs, map[string]*GCInfo{}, 2); len(lchosen) != 0 {
+		t.Fatalf("nothing must be consolidated while pool is scaling, got %v", lchosen)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// как долго gc верит закешированным type и meta job, прежде чем перечитать
+const cGCJobInfoTTL = 5 * time.Minute
+
+// isNomadNotFound reports whether nomad api responded 404, api client returns only text of such errors
+func isNomadNotFound(_err error) bool {
+	return strings.HasPrefix(_err.Error(), "Unexpected response code: 404")
+}
+
+// GCJobInfo is part of job, that gc needs to decide whether job allocations keep node busy, and job itself to
+// simulate where its allocations would be placed
+type GCJobInfo struct {
+	Type string
+	Meta map[string]string
+	Job  *structs.Job
+	// job уже удален из nomad, Type, Meta и Job пустые
+	Gone bool
+
+	fetchedAt time.Time
+	err       error
+}
+
+// GCJobCache keeps type and meta of jobs for allocations that came from nomad event stream, nomad strips job from
+// such allocations
+type GCJobCache struct {
+	logger hclog.Logger
+	nc     *nomad.Client
+	jobs   map[string]*GCJobInfo
+}
+
+func NewGCJobCache(_nc *nomad.Client) *GCJobCache {
+	return &GCJobCache{
+		logger: hclog.L().Named("gc"),
+		nc:     _nc,
+		jobs:   map[string]*GCJobInfo{},
+	}
+}
+
+// Expire forgets jobs read earlier than cGCJobInfoTTL before _now, so changed meta is seen
+func (c *GCJobCache) Expire(_now time.Time) {
+	for lkey, ljob := range c.jobs {
+		if _now.Sub(ljob.fetchedAt) > cGCJobInfoTTL {
+			delete(c.jobs, lkey)
+		}
+	}
+}
+
+// Get returns job of allocation, nomad is asked only if allocation came without job. Jobs that nomad doesn't know
+// are returned as gone, failures to read job are cached too, so nomad is not asked again until cGCJobInfoTTL passes
+func (c *GCJobCache) Get(_alloc *structs.Allocation) (*GCJobInfo, error) {
+	if _alloc.Job != nil {
+		return &GCJobInfo{Type: _alloc.Job.Type, Meta: _alloc.Job.Meta, Job: _alloc.Job}, nil
+	}
+
+	lkey := _alloc.Namespace + "/" + _alloc.JobID
+	if ljob, lok := c.jobs[lkey]; lok {
+		if ljob.err != nil {
+			return nil, ljob.err
+		}
+
+		return ljob, nil
+	}
+
+	lapiJob, _, lerr := c.nc.Jobs().Info(_alloc.JobID, &nomad.QueryOptions{Namespace: _alloc.Namespace})
+	if lerr != nil {
+		if isNomadNotFound(lerr) {
+			c.logger.Debug(fmt.Sprintf("job %s of alloc %s not found in nomad", lkey, _alloc.ID))
+			ljob := &GCJobInfo{Gone: true, fetchedAt: time.Now()}
+			c.jobs[lkey] = ljob
+
+			return ljob, nil
+		}
+
+		lerr = fmt.Errorf("can't get job %s due: %s", lkey, lerr)
+		c.logger.Warn(fmt.Sprintf("%s, its allocations keep nodes busy during %s", lerr, cGCJobInfoTTL))
+		c.jobs[lkey] = &GCJobInfo{fetchedAt: time.Now(), err: lerr}
+
+		return nil, lerr
+	}
+
+	lapiJob.Canonicalize()
+	lstructsJob := apiNomadJobToStructsJobV2(lapiJob)
+
+	ljob := &GCJobInfo{Type: lstructsJob.Type, Meta: lstructsJob.Meta, Job: lstructsJob, fetchedAt: time.Now()}
+	c.jobs[lkey] = ljob
+
+	return ljob, nil
+}
+
+// AllocIdleReason returns empty string if allocation keeps its node busy, otherwise why allocation doesn't prevent
+// node from being garbage collected
+func (c *GarbageCollectorConfig) AllocIdleReason(_alloc *structs.Allocation, _jobs *GCJobCache) string {
+	if len(c.BusyNamespaces) > 0 && matchAnyPattern(c.BusyNamespaces, _alloc.Namespace) == nil {
+		return fmt.Sprintf("namespace %s not in busy namespaces", _alloc.Namespace)
+	}
+
+	if lpattern := matchAnyPattern(c.IdleNamespaces, _alloc.Namespace); lpattern != nil {
+		return fmt.Sprintf("namespace %s is idle by %s", _alloc.Namespace, lpattern)
+	}
+
+	ljob, lerr := _jobs.Get(_alloc)
+	if lerr != nil {
+		// не знаем что за job, ноду лучше не трогать
+		return ""
+	}
+
+	if ljob.Gone {
+		return fmt.Sprintf("job %s is gone", _alloc.JobID)
+	}
+
+	if len(c.BusyJobTypes) > 0 && !containsInSlice(c.BusyJobTypes, ljob.Type) {
+		return fmt.Sprintf("job type %s not in busy job types %v", ljob.Type, c.BusyJobTypes)
+	}
+
+	if c.IdleMeta != "" && strings.EqualFold(ljob.Meta[c.IdleMeta], "true") {
+		return fmt.Sprintf("job %s is idle by meta %s", _alloc.JobID, c.IdleMeta)
+	}
+
+	return ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestGCAllocIdleReason(t *testing.T) {
+	lrequests := 0
+	lnomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lrequests += 1
+		switch r.URL.Path {
+		case "/v1/job/node-exporter":
+			w.Write([]byte(`{"ID": "node-exporter", "Type": "system"}`))
+		case "/v1/job/web":
+			w.Write([]byte(`{"ID": "web", "Type": "service"}`))
+		case "/v1/job/broken":
+			http.Error(w, "rpc error", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer lnomadServer.Close()
+
+	lnc, lerr := nomad.NewClient(&nomad.Config{Address: lnomadServer.URL})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lpath := writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+gc {
+  cicles_to_gc = 3
+  idle_namespaces = ["monitoring"]
+}
+`)
+
+	var lconfig Config
+	lerr = configParse(lpath, &lconfig)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lgcconfig := lconfig.GC[0]
+	ljobs := NewGCJobCache(lnc)
+
+	for _, ltest := range []struct {
+		alloc *structs.Allocation
+		idle  bool
+	}{
+		// job есть в аллокации, в nomad не ходим
+		{&structs.Allocation{Namespace: "default", JobID: "batch", Job: &structs.Job{Type: structs.JobTypeBatch}}, false},
+		{&structs.Allocation{Namespace: "default", JobID: "logs", Job: &structs.Job{Type: structs.JobTypeSysBatch}}, true},
+		{&structs.Allocation{Namespace: "default", JobID: "cache", Job: &structs.Job{Type: structs.JobTypeService, Meta: map[string]string{"ondemand-scaler.gc.idle": "true"}}}, true},
+		{&structs.Allocation{Namespace: "monitoring", JobID: "grafana", Job: &structs.Job{Type: structs.JobTypeService}}, true},
+		// аллокации из event stream приходят без job
+		{&structs.Allocation{Namespace: "default", JobID: "node-exporter"}, true},
+		{&structs.Allocation{Namespace: "default", JobID: "web"}, false},
+		{&structs.Allocation{Namespace: "default", JobID: "node-exporter"}, true},
+		// job удалена из nomad, ее аллокации ноду не держат
+		{&structs.Allocation{Namespace: "default", JobID: "purged"}, true},
+		{&structs.Allocation{Namespace: "default", JobID: "purged"}, true},
+		// job не удалось прочитать, ноду не трогаем, и до истечения ttl nomad снова не спрашиваем
+		{&structs.Allocation{Namespace: "default", JobID: "broken"}, false},
+		{&structs.Allocation{Namespace: "default", JobID: "broken"}, false},
+	} {
+		if lreason := lgcconfig.AllocIdleReason(ltest.alloc, ljobs); (lreason != "") != ltest.idle {
+			t.Fatalf("alloc of %s/%s idle must be %v, got reason %q", ltest.alloc.Namespace, ltest.alloc.JobID, ltest.idle, lreason)
+		}
+	}
+
+	if lrequests != 4 {
+		t.Fatalf("jobs of allocations without job must be read from nomad once, got %d requests", lrequests)
+	}
+}
+
+func TestGCBusyJobTypesWrong(t *testing.T) {
+	lpath := writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+gc {
+  cicles_to_gc = 3
+  busy_job_types = ["service", "daemon"]
+}
+`)
+
+	var lconfig Config
+	if lerr := configParse(lpath, &lconfig); lerr == nil {
+		t.Fatalf("unknown job type in busy_job_types must be rejected")
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+type ApiStatus struct {
+	Leader              bool   `json:"leader"`
+	FreeScalingThreads  int    `json:"freescalingthreads"`
+	TotalScalingThreads int    `json:"totalscalingthreads"`
+	FreeGcThreads       int    `json:"freegcthreads"`
+	TotalGcThreads      int    `json:"totalgcthreads"`
+	AcceptedEvals       uint64 `json:"acceptedevals"`
+	AcceptedAllocs      uint64 `json:"acceptedallocs"`
+	ScalingTimeouts     uint64 `json:"scalingtimeouts"`
+	NosuitedEvents      uint64 `json:"nosuitedevents"`
+}
+
+type ApiPoolNode struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Allocs int    `json:"allocs"`
+}
+
+type ApiPool struct {
+	Name            string          `json:"name"`
+	Nodes           int             `json:"nodes"`
+	Allocs          int             `json:"allocs"`
+	EphemeralNodes  []string        `json:"ephemeralnodes"`
+	EphemeralAllocs int             `json:"ephemeralallocs"`
+	NodesList       []*ApiPoolNode  `json:"nodeslist,omitempty"`
+	DryRunActions   []*DryRunAction `json:"dryrunactions,omitempty"`
+}
+
+type ApiScalingTaskGroup struct {
+	Pool         string `json:"pool"`
+	UnAllocCount int    `json:"unalloccount"`
+}
+
+type ApiScalingEvent struct {
+	Id         string                          `json:"id"`
+	Job        string                          `json:"job"`
+	FireTime   time.Time                       `json:"firetime"`
+	TaskGroups map[string]*ApiScalingTaskGroup `json:"taskgroups"`
+}
+
+type ApiInflightPoolScaling struct {
+	EphemeralNodes  int `json:"ephemeralnodes"`
+	EphemeralAllocs int `json:"ephemeralallocs"`
+}
+
+type ApiInflightScaling struct {
+	Id       string                             `json:"id"`
+	FireTime time.Time                          `json:"firetime"`
+	Pools    map[string]*ApiInflightPoolScaling `json:"pools"`
+}
+
+type ApiScaling struct {
+	Queue    []*ApiScalingEvent    `json:"queue"`
+	Inflight []*ApiInflightScaling `json:"inflight"`
+}
+
+type ApiGCCandidate struct {
+	NodeId               string `json:"nodeid"`
+	Pool                 string `json:"pool"`
+	SeenEmptyCiclesCount int    `json:"seenemptycicles"`
+	Collecting           bool   `json:"collecting"`
+	Draining             bool   `json:"draining"`
+	Consolidating        bool   `json:"consolidating"`
+}
+
+type ApiWarmUpRequest struct {
+	Count int `json:"count"`
+}
+
+type ApiRemoveNodesRequest struct {
+	Nodes []string `json:"nodes"`
+}
+
+type ApiRemoveNodeResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ApiScalingCancelRequest struct {
+	Id string `json:"id"`
+}
+
+type ApiScalingCancelResult struct {
+	Id     string `json:"id"`
+	Result string `json:"result"`
+}
+
+// HttpApiControl is everything http api needs to act on pools, control endpoints are disabled without it
+type HttpApiControl struct {
+	Token           string
+	GCForceCh       chan<- struct{}
+	GCRemoveCh      chan<- *GCRemoveRequest
+	ScalingCancelCh chan<- *ScalingCancelRequest
+}
+
+// HttpApi exposes live scaler state as json, read endpoints are safe to run on standby replicas too, control
+// endpoints act only on leader
+type HttpApi struct {
+	logger hclog.Logger
+
+	stat         *StateStat
+	persist      *PersistentState
+	pools        *PoolSet
+	scalingQueue *Queue[*ScalingEvent]
+	control      *HttpApiControl
+}
+
+func NewHttpApi(_stat *StateStat, _persist *PersistentState, _pools *PoolSet, _scalingQueue *Queue[*ScalingEvent]) *HttpApi {
+	return &HttpApi{
+		logger:       hclog.L().Named("httpapi"),
+		stat:         _stat,
+		persist:      _persist,
+		pools:        _pools,
+		scalingQueue: _scalingQueue,
+	}
+}
+
+// SetControl enables control endpoints, requests to them must carry "Authorization: Bearer <token>" header
+func (a *HttpApi) SetControl(_control *HttpApiControl) {
+	a.control = _control
+}
+
+// Serve returns error only if it can't listen on _bindAddr, requests are served in background
+func (a *HttpApi) Serve(_bindAddr string) error {
+	llistener, lerr := net.Listen("tcp", _bindAddr)
+	if lerr != nil {
+		return fmt.Errorf("can't listen on %s due: %s", _bindAddr, lerr)
+	}
+
+	a.logger.Info(fmt.Sprintf("serving on %s", llistener.Addr()))
+
+	go func() {
+		lerr := http.Serve(llistener, a.Handler())
+		a.logger.Error(fmt.Sprintf("http api stopped due: %s", lerr))
+	}()
+
+	return nil
+}
+
+func (a *HttpApi) Handler() http.Handler {
+	lmux := http.NewServeMux()
+	lmux.HandleFunc("/v1/status", a.getOnly(a.handleStatus))
+	lmux.HandleFunc("/v1/pools", a.getOnly(a.handlePools))
+	lmux.HandleFunc("/v1/pool/", a.routePool)
+	lmux.HandleFunc("/v1/scaling", a.getOnly(a.handleScaling))
+	lmux.HandleFunc("/v1/scaling/cancel", a.controlOnly(a.handleScalingCancel))
+	lmux.HandleFunc("/v1/gc", a.getOnly(a.handleGC))
+	lmux.HandleFunc("/v1/gc/run", a.controlOnly(a.handleGCRun))
+
+	return lmux
+}
+
+func (a *HttpApi) getOnly(_handler func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		_handler(w, r)
+	}
+}
+
+func (a *HttpApi) controlOnly(_handler func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			a.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		if a.control == nil || a.control.Token == "" {
+			a.writeError(w, http.StatusForbidden, fmt.Errorf("control api disabled, set token in http config section"))
+			return
+		}
+
+		ltoken, lok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !lok || subtle.ConstantTimeCompare([]byte(ltoken), []byte(a.control.Token)) != 1 {
+			a.writeError(w, http.StatusUnauthorized, fmt.Errorf("wrong or missing token"))
+			return
+		}
+
+		if !a.stat.IsLeader() {
+			a.writeError(w, http.StatusConflict, fmt.Errorf("this replica is not leader"))
+			return
+		}
+
+		a.logger.Info(fmt.Sprintf("control request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr))
+		_handler(w, r)
+	}
+}
+
+func (a *HttpApi) readJson(w http.ResponseWriter, r *http.Request, _v interface{}) bool {
+	lerr := json.NewDecoder(r.Body).Decode(_v)
+	if lerr != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("can't decode request due: %s", lerr))
+		return false
+	}
+
+	return true
+}
+
+func (a *HttpApi) writeJson(w http.ResponseWriter, _status int, _v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(_status)
+
+	lerr := json.NewEncoder(w).Encode(_v)
+	if lerr != nil {
+		a.logger.Error(fmt.Sprintf("can't write response due: %s", lerr))
+	}
+}
+
+func (a *HttpApi) writeError(w http.ResponseWriter, _status int, _err error) {
+	a.writeJson(w, _status, map[string]string{"error": _err.Error()})
+}
+
+func (a *HttpApi) handleStatus(w http.ResponseWriter, r *http.Request) {
+	a.writeJson(w, http.StatusOK, &ApiStatus{
+		Leader:              a.stat.IsLeader(),
+		FreeScalingThreads:  a.stat.GetFreeScalingThreads(),
+		TotalScalingThreads: a.stat.GetTotalScalingThreads(),
+		FreeGcThreads:       a.stat.GetFreeGcThreads(),
+		TotalGcThreads:      a.stat.GetTotalGcThreads(),
+		AcceptedEvals:       a.stat.GetAcceptedEvals(),
+		AcceptedAllocs:      a.stat.GetAcceptedAllocs(),
+		ScalingTimeouts:     a.stat.GetScalingTimeouts(),
+		NosuitedEvents:      a.stat.GetNosuitedEvents(),
+	})
+}
+
+func (a *HttpApi) poolInfo(_pool *Pool, _withNodes bool) *ApiPool {
+	_pool.lock.Lock()
+	defer _pool.lock.Unlock()
+
+	lpoolInfo := &ApiPool{
+		Name:            _pool.GetName(),
+		Nodes:           len(_pool.nomadNodes),
+		Allocs:          len(_pool.nomadAllocs),
+		EphemeralNodes:  make([]string, 0, len(_pool.ephemeralnomadNodes)),
+		EphemeralAllocs: len(_pool.ephemeralnomadAllocs),
+	}
+
+	for _, lnode := range _pool.ephemeralnomadNodes {
+		lpoolInfo.EphemeralNodes = append(lpoolInfo.EphemeralNodes, lnode.ID)
+	}
+
+	if _withNodes {
+		lallocsByNodes := map[string]int{}
+		for _, lalloc := range _pool.nomadAllocs {
+			lallocsByNodes[lalloc.NodeID] += 1
+		}
+
+		lpoolInfo.NodesList = make([]*ApiPoolNode, 0, len(_pool.nomadNodes))
+		for _, lnode := range _pool.nomadNodes {
+			lpoolInfo.NodesList = append(lpoolInfo.NodesList, &ApiPoolNode{
+				Id:     lnode.ID,
+				Name:   lnode.Name,
+				Status: lnode.Status,
+				Allocs: lallocsByNodes[lnode.ID],
+			})
+		}
+
+		sort.Slice(lpoolInfo.NodesList, func(i, j int) bool {
+			return lpoolInfo.NodesList[i].Id < lpoolInfo.NodesList[j].Id
+		})
+
+		lpoolInfo.DryRunActions = append(lpoolInfo.DryRunActions, _pool.dryRunActions...)
+	}
+
+	return lpoolInfo
+}
+
+func (a *HttpApi) handlePools(w http.ResponseWriter, r *http.Request) {
+	lpoolsSnapshot := a.pools.Pools()
+	lpools := make([]*ApiPool, 0, len(lpoolsSnapshot))
+	for _, lpool := range lpoolsSnapshot {
+		lpools = append(lpools, a.poolInfo(lpool, false))
+	}
+
+	sort.Slice(lpools, func(i, j int) bool {
+		return lpools[i].Name < lpools[j].Name
+	})
+
+	a.writeJson(w, http.StatusOK, lpools)
+}
+
+// routePool serves /v1/pool/<pool name>[/<action>]
+func (a *HttpApi) routePool(w http.ResponseWriter, r *http.Request) {
+	_, laction, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/pool/"), "/")
+
+	switch laction {
+	case "":
+		a.getOnly(a.handlePool)(w, r)
+	case "warmup":
+		a.controlOnly(a.handlePoolWarmUp)(w, r)
+	case "remove":
+		a.controlOnly(a.handlePoolRemove)(w, r)
+	default:
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("unknown pool action %q", laction))
+	}
+}
+
+func (a *HttpApi) poolFromPath(w http.ResponseWriter, r *http.Request) *Pool {
+	lpoolName, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/pool/"), "/")
+
+	lpool, lok := a.pools.Get(lpoolName)
+	if !lok {
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("pool %q not found", lpoolName))
+		return nil
+	}
+
+	return lpool
+}
+
+func (a *HttpApi) handlePool(w http.ResponseWriter, r *http.Request) {
+	lpool := a.poolFromPath(w, r)
+	if lpool == nil {
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, a.poolInfo(lpool, true))
+}
+
+func (a *HttpApi) handlePoolWarmUp(w http.ResponseWriter, r *http.Request) {
+	lpool := a.poolFromPath(w, r)
+	if lpool == nil {
+		return
+	}
+
+	var lrequest ApiWarmUpRequest
+	if !a.readJson(w, r, &lrequest) {
+		return
+	}
+
+	if lrequest.Count <= 0 {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("count must be positive, got: %d", lrequest.Count))
+		return
+	}
+
+	// WarmUp ждет пока все ноды появятся в nomad, поэтому не держим запрос
+	go lpool.WarmUp(lrequest.Count)
+
+	a.writeJson(w, http.StatusAccepted, &lrequest)
+}
+
+func (a *HttpApi) handlePoolRemove(w http.ResponseWriter, r *http.Request) {
+	lpool := a.poolFromPath(w, r)
+	if lpool == nil {
+		return
+	}
+
+	var lrequest ApiRemoveNodesRequest
+	if !a.readJson(w, r, &lrequest) {
+		return
+	}
+
+	if len(lrequest.Nodes) == 0 {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("no nodes to remove"))
+		return
+	}
+
+	// дренирование и удаление ведет gc, так же как для собранных им нод, запрос ждет только старта дренирования
+	lremoveRequest := &GCRemoveRequest{Pool: lpool.GetName(), Nodes: lrequest.Nodes, Result: make(chan map[string]*GCRemoveResult, 1)}
+	select {
+	case a.control.GCRemoveCh <- lremoveRequest:
+	case <-r.Context().Done():
+		return
+	}
+
+	var lresults map[string]*GCRemoveResult
+	select {
+	case lresults = <-lremoveRequest.Result:
+	case <-r.Context().Done():
+		return
+	}
+
+	lapiResults := map[string]*ApiRemoveNodeResult{}
+	for _, lnodeId := range lrequest.Nodes {
+		lresult, lok := lresults[lnodeId]
+		if !lok {
+			lresult = &GCRemoveResult{Status: GCRemoveFailed, Err: fmt.Errorf("no result from gc")}
+		}
+
+		lapiResult := &ApiRemoveNodeResult{Status: lresult.Status}
+		if lresult.Err != nil {
+			lapiResult.Error = lresult.Err.Error()
+		}
+		lapiResults[lnodeId] = lapiResult
+	}
+
+	a.writeJson(w, http.StatusAccepted, lapiResults)
+}
+
+func (a *HttpApi) handleScaling(w http.ResponseWriter, r *http.Request) {
+	lscaling := &ApiScaling{
+		Queue:    []*ApiScalingEvent{},
+		Inflight: []*ApiInflightScaling{},
+	}
+
+	for _, lscalingEvent := range a.scalingQueue.Items() {
+		lapiEvent := &ApiScalingEvent{
+			Id:         lscalingEvent.Id,
+			FireTime:   lscalingEvent.FireTime,
+			TaskGroups: map[string]*ApiScalingTaskGroup{},
+		}
+
+		if lscalingEvent.Job != nil {
+			lapiEvent.Job = fmt.Sprintf("%s/%s", lscalingEvent.Job.Namespace, lscalingEvent.Job.ID)
+		}
+
+		for ltgName, ltgInfo := range lscalingEvent.UnAllocatedTg {
+			lapiEvent.TaskGroups[ltgName] = &ApiScalingTaskGroup{
+				Pool:         ltgInfo.PoolInfo.GetFullName(),
+				UnAllocCount: ltgInfo.UnAllocCount,
+			}
+		}
+
+		lscaling.Queue = append(lscaling.Queue, lapiEvent)
+	}
+
+	for _, linflight := range a.persist.GetScalings() {
+		lapiInflight := &ApiInflightScaling{
+			Id:       linflight.Id,
+			FireTime: linflight.FireTime,
+			Pools:    map[string]*ApiInflightPoolScaling{},
+		}
+
+		for lpoolName, lpoolScaling := range linflight.Pools {
+			lapiInflight.Pools[lpoolName] = &ApiInflightPoolScaling{
+				EphemeralNodes:  len(lpoolScaling.EphemeralNodes),
+				EphemeralAllocs: len(lpoolScaling.EphemeralAllocs),
+			}
+		}
+
+		lscaling.Inflight = append(lscaling.Inflight, lapiInflight)
+	}
+
+	sort.Slice(lscaling.Inflight, func(i, j int) bool {
+		return lscaling.Inflight[i].FireTime.Before(lscaling.Inflight[j].FireTime)
+	})
+
+	a.writeJson(w, http.StatusOK, lscaling)
+}
+
+func (a *HttpApi) handleGC(w http.ResponseWriter, r *http.Request) {
+	lcandidates := []*ApiGCCandidate{}
+	for lnodeId, lgcInfo := range a.persist.GetGC() {
+		lcandidates = append(lcandidates, &ApiGCCandidate{
+			NodeId:               lnodeId,
+			Pool:                 lgcInfo.PoolName,
+			SeenEmptyCiclesCount: lgcInfo.SeenEmptyCiclesCount,
+			Collecting:           lgcInfo.Collecting,
+			Draining:             lgcInfo.DrainId != "",
+			Consolidating:        lgcInfo.Consolidating,
+		})
+	}
+
+	sort.Slice(lcandidates, func(i, j int) bool {
+		return lcandidates[i].NodeId < lcandidates[j].NodeId
+	})
+
+	a.writeJson(w, http.StatusOK, lcandidates)
+}
+
+func (a *HttpApi) handleScalingCancel(w http.ResponseWriter, r *http.Request) {
+	var lrequest ApiScalingCancelRequest
+	if !a.readJson(w, r, &lrequest) {
+		return
+	}
+
+	if lrequest.Id == "" {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("no scaling event id"))
+		return
+	}
+
+	lcancelRequest := &ScalingCancelRequest{Id: lrequest.Id, Result: make(chan string, 1)}
+	select {
+	case a.control.ScalingCancelCh <- lcancelRequest:
+	case <-r.Context().Done():
+		return
+	}
+
+	var lresult string
+	select {
+	case lresult = <-lcancelRequest.Result:
+	case <-r.Context().Done():
+		return
+	}
+
+	lstatus := http.StatusOK
+	if lresult == ScalingCancelNotFound {
+		lstatus = http.StatusNotFound
+	}
+
+	a.writeJson(w, lstatus, &ApiScalingCancelResult{Id: lrequest.Id, Result: lresult})
+}
+
+func (a *HttpApi) handleGCRun(w http.ResponseWriter, r *http.Request) {
+	select {
+	case a.control.GCForceCh <- struct{}{}:
+	default: // внеочередной цикл уже запрошен
+	}
+
+	a.writeJson(w, http.StatusAccepted, map[string]bool{"forced": true})
+}
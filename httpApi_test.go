@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestHttpApi(t *testing.T) {
+	lpool := &Pool{
+		logger:   hclog.L(),
+		fullName: "workers",
+		nomadNodes: map[string]*structs.Node{
+			"node-1": {ID: "node-1", Name: "worker-1", Status: structs.NodeStatusReady},
+			"node-2": {ID: "node-2", Name: "worker-2", Status: structs.NodeStatusReady},
+		},
+		nomadAllocs: map[string]*structs.Allocation{
+			"alloc-1": {ID: "alloc-1", NodeID: "node-1"},
+		},
+		ephemeralnomadNodes: []*structs.Node{{ID: "ephemeral-node"}},
+	}
+
+	lstat := NewStateStat()
+	lstat.SetLeader(true)
+	lstat.IncAcceptedEvals()
+
+	lpersist := NewPersistentState(nil)
+	lpersist.SetGC(map[string]*GCInfo{"node-2": {PoolName: "workers", SeenEmptyCiclesCount: 2}})
+	lpersist.AddScaling(&InflightScaling{
+		Id:       "default/inflight",
+		FireTime: time.Now(),
+		Pools:    map[string]*InflightPoolScaling{"workers": {EphemeralNodes: []*structs.Node{{ID: "ephemeral-node"}}}},
+	})
+
+	lqueue := NewQueue[*ScalingEvent]()
+	lqueue.Enqueue(&ScalingEvent{Id: "default/queued", Job: &structs.Job{Namespace: "default", ID: "queued"}, FireTime: time.Now()}, "default/queued")
+
+	lserver := httptest.NewServer(NewHttpApi(lstat, lpersist, NewPoolSet(map[string]*Pool{"workers": lpool}, nil), lqueue).Handler())
+	defer lserver.Close()
+
+	getJson := func(_path string, _v interface{}) int {
+		lresp, lerr := http.Get(lserver.URL + _path)
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+		defer lresp.Body.Close()
+
+		if _v != nil {
+			lerr = json.NewDecoder(lresp.Body).Decode(_v)
+			if lerr != nil {
+				t.Fatalf("can't decode %s response due: %s", _path, lerr)
+			}
+		}
+
+		return lresp.StatusCode
+	}
+
+	var lstatus ApiStatus
+	getJson("/v1/status", &lstatus)
+	if !lstatus.Leader || lstatus.AcceptedEvals != 1 {
+		t.Fatalf("wrong status: %+v", lstatus)
+	}
+
+	var lpools []*ApiPool
+	getJson("/v1/pools", &lpools)
+	if len(lpools) != 1 || lpools[0].Nodes != 2 || lpools[0].Allocs != 1 || len(lpools[0].EphemeralNodes) != 1 {
+		t.Fatalf("wrong pools: %+v", lpools)
+	}
+
+	var lpoolInfo ApiPool
+	getJson("/v1/pool/workers", &lpoolInfo)
+	if len(lpoolInfo.NodesList) != 2 || lpoolInfo.NodesList[0].Allocs != 1 || lpoolInfo.NodesList[1].Allocs != 0 {
+		t.Fatalf("wrong pool info: %+v", lpoolInfo)
+	}
+
+	if lcode := getJson("/v1/pool/unknown", nil); lcode != http.StatusNotFound {
+		t.Fatalf("unknown pool must return 404, got: %d", lcode)
+	}
+
+	var lscaling ApiScaling
+	getJson("/v1/scaling", &lscaling)
+	if len(lscaling.Queue) != 1 || lscaling.Queue[0].Job != "default/queued" || len(lscaling.Inflight) != 1 || lscaling.Inflight[0].Pools["workers"].EphemeralNodes != 1 {
+		t.Fatalf("wrong scaling: %+v", lscaling)
+	}
+
+	var lgc []*ApiGCCandidate
+	getJson("/v1/gc", &lgc)
+	if len(lgc) != 1 || lgc[0].NodeId != "node-2" || lgc[0].SeenEmptyCiclesCount != 2 {
+		t.Fatalf("wrong gc candidates: %+v", lgc)
+	}
+}
+
+func TestHttpApiControl(t *testing.T) {
+	lpool := &Pool{
+		logger:      hclog.L(),
+		fullName:    "workers",
+		nomadNodes:  map[string]*structs.Node{},
+		nomadAllocs: map[string]*structs.Allocation{},
+	}
+
+	lstat := NewStateStat()
+	lapi := NewHttpApi(lstat, NewPersistentState(nil), NewPoolSet(map[string]*Pool{"workers": lpool}, nil), NewQueue[*ScalingEvent]())
+
+	lserver := httptest.NewServer(lapi.Handler())
+	defer lserver.Close()
+
+	postJson := func(_path string, _token string, _body string, _v interface{}) int {
+		lreq, lerr := http.NewRequest(http.MethodPost, lserver.URL+_path, strings.NewReader(_body))
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+
+		if _token != "" {
+			lreq.Header.Set("Authorization", "Bearer "+_token)
+		}
+
+		lresp, lerr := http.DefaultClient.Do(lreq)
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+		defer lresp.Body.Close()
+
+		if _v != nil {
+			lerr = json.NewDecoder(lresp.Body).Decode(_v)
+			if lerr != nil {
+				t.Fatalf("can't decode %s response due: %s", _path, lerr)
+			}
+		}
+
+		return lresp.StatusCode
+	}
+
+	if lcode := postJson("/v1/gc/run", "secret", "", nil); lcode != http.StatusForbidden {
+		t.Fatalf("control api without token configured must return 403, got: %d", lcode)
+	}
+
+	lgcForceCh := make(chan struct{}, 1)
+	lgcRemoveCh := make(chan *GCRemoveRequest)
+	lscalingCancelCh := make(chan *ScalingCancelRequest)
+	lapi.SetControl(&HttpApiControl{
+		Token:           "secret",
+		GCForceCh:       lgcForceCh,
+		GCRemoveCh:      lgcRemoveCh,
+		ScalingCancelCh: lscalingCancelCh,
+	})
+
+	if lcode := postJson("/v1/gc/run", "wrong", "", nil); lcode != http.StatusUnauthorized {
+		t.Fatalf("wrong token must return 401, got: %d", lcode)
+	}
+
+	if lcode := postJson("/v1/gc/run", "secret", "", nil); lcode != http.StatusConflict {
+		t.Fatalf("standby replica must return 409, got: %d", lcode)
+	}
+
+	lstat.SetLeader(true)
+
+	if lcode := postJson("/v1/gc/run", "secret", "", nil); lcode != http.StatusAccepted {
+		t.Fatalf("gc run must return 202, got: %d", lcode)
+	}
+	select {
+	case <-lgcForceCh:
+	default:
+		t.Fatalf("gc cycle was not forced")
+	}
+
+	if lcode := postJson("/v1/pool/workers/warmup", "secret", `{"count": 0}`, nil); lcode != http.StatusBadRequest {
+		t.Fatalf("warmup with zero count must return 400, got: %d", lcode)
+	}
+
+	go func() {
+		lremoveRequest := <-lgcRemoveCh
+		if lremoveRequest.Pool != "workers" {
+			t.Errorf("wrong pool in remove request: %s", lremoveRequest.Pool)
+		}
+		lremoveRequest.Result <- map[string]*GCRemoveResult{"unknown-node": {Status: GCRemoveNotFound, Err: fmt.Errorf("node not in pool")}}
+	}()
+
+	var lremoveResults map[string]*ApiRemoveNodeResult
+	if lcode := postJson("/v1/pool/workers/remove", "secret", `{"nodes": ["unknown-node"]}`, &lremoveResults); lcode != http.StatusAccepted {
+		t.Fatalf("remove must return 202, got: %d", lcode)
+	}
+	if lremoveResults["unknown-node"] == nil || lremoveResults["unknown-node"].Status != GCRemoveNotFound {
+		t.Fatalf("wrong remove results: %+v", lremoveResults)
+	}
+
+	go func() {
+		lcancelRequest := <-lscalingCancelCh
+		lcancelRequest.Result <- ScalingCancelDequeued
+	}()
+
+	var lcancelResult ApiScalingCancelResult
+	postJson("/v1/scaling/cancel", "secret", `{"id": "default/job"}`, &lcancelResult)
+	if lcancelResult.Id != "default/job" || lcancelResult.Result != ScalingCancelDequeued {
+		t.Fatalf("wrong cancel result: %+v", lcancelResult)
+	}
+}
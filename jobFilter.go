@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+const cNamePatternRegexPrefix = "regex:"
+
+// NamePattern is glob(only * and ? are special) or, with "regex:" prefix, regular expression. Both must match
+// whole name
+type NamePattern struct {
+	text string
+	re   *regexp.Regexp
+}
+
+func NewNamePattern(_text string) (*NamePattern, error) {
+	lexpr, lisRegex := strings.CutPrefix(_text, cNamePatternRegexPrefix)
+	if !lisRegex {
+		lexpr = regexp.QuoteMeta(_text)
+		lexpr = strings.ReplaceAll(lexpr, `\*`, ".*")
+		lexpr = strings.ReplaceAll(lexpr, `\?`, ".")
+	}
+
+	lre, lerr := regexp.Compile("^(?:" + lexpr + ")$")
+	if lerr != nil {
+		return nil, fmt.Errorf("wrong pattern %q: %s", _text, lerr)
+	}
+
+	return &NamePattern{text: _text, re: lre}, nil
+}
+
+func (p *NamePattern) Match(_name string) bool {
+	return p.re.MatchString(_name)
+}
+
+func (p *NamePattern) String() string {
+	return p.text
+}
+
+func decodeToNamePattern(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String {
+		return nil, fmt.Errorf("wrong type in value for pattern")
+	}
+
+	return NewNamePattern(data.(string))
+}
+
+func matchAnyPattern(_patterns []*NamePattern, _name string) *NamePattern {
+	for _, lpattern := range _patterns {
+		if lpattern.Match(_name) {
+			return lpattern
+		}
+	}
+
+	return nil
+}
+
+// NamespaceFilteredReason returns empty string if jobs of namespace may trigger scaling
+func (c *FilterConfig) NamespaceFilteredReason(_namespace string) string {
+	if len(c.Namespaces) > 0 && matchAnyPattern(c.Namespaces, _namespace) == nil {
+		return fmt.Sprintf("namespace %s not in allowed namespaces", _namespace)
+	}
+
+	if lpattern := matchAnyPattern(c.ExcludeNamespaces, _namespace); lpattern != nil {
+		return fmt.Sprintf("namespace %s excluded by %s", _namespace, lpattern)
+	}
+
+	return ""
+}
+
+func (c *FilterConfig) filteredReason(_namespace string, _jobId string, _jobType string) string {
+	if lreason := c.NamespaceFilteredReason(_namespace); lreason != "" {
+		return lreason
+	}
+
+	if len(c.Jobs) > 0 && matchAnyPattern(c.Jobs, _jobId) == nil {
+		return fmt.Sprintf("job %s not in allowed jobs", _jobId)
+	}
+
+	if lpattern := matchAnyPattern(c.ExcludeJobs, _jobId); lpattern != nil {
+		return fmt.Sprintf("job %s excluded by %s", _jobId, lpattern)
+	}
+
+	if len(c.JobTypes) > 0 && !containsInSlice(c.JobTypes, _jobType) {
+		return fmt.Sprintf("job type %s not in allowed job types %v", _jobType, c.JobTypes)
+	}
+
+	return ""
+}
+
+// EvalFilteredReason checks what can be checked without job, returns empty string if eval may trigger scaling
+func (c *FilterConfig) EvalFilteredReason(_eval *nomad.Evaluation) string {
+	return c.filteredReason(_eval.Namespace, _eval.JobID, _eval.Type)
+}
+
+// JobFilteredReason returns empty string if job may trigger scaling
+func (c *FilterConfig) JobFilteredReason(_job *structs.Job) string {
+	if lreason := c.filteredReason(_job.Namespace, _job.ID, _job.Type); lreason != "" {
+		return lreason
+	}
+
+	if c.OptOutMeta != "" && strings.EqualFold(_job.Meta[c.OptOutMeta], "true") {
+		return fmt.Sprintf("job %s opted out by meta %s", _job.ID, c.OptOutMeta)
+	}
+
+	return ""
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestFilterConfig(t *testing.T) {
+	lpath := writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+filter {
+  namespaces = ["default", "team-*"]
+  exclude_namespaces = ["team-experimental"]
+  exclude_jobs = ["regex:^canary-[0-9]+$", "debug-?"]
+  job_types = ["service", "batch"]
+}
+`)
+
+	var lconfig Config
+	lerr := configParse(lpath, &lconfig)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lfilter := lconfig.Filter[0]
+	for _, ltest := range []struct {
+		namespace string
+		jobId     string
+		jobType   string
+		meta      map[string]string
+		filtered  string
+	}{
+		{"default", "web", "service", nil, ""},
+		{"team-a", "canary-web", "batch", nil, ""},
+		{"other", "web", "service", nil, "not in allowed namespaces"},
+		{"team-experimental", "web", "service", nil, "excluded by team-experimental"},
+		{"default", "canary-12", "service", nil, "excluded by regex:"},
+		{"default", "debug-1", "service", nil, "excluded by debug-?"},
+		{"default", "web", "system", nil, "job type system"},
+		{"default", "web", "service", map[string]string{"ondemand-scaler.disabled": "true"}, "opted out"},
+	} {
+		ljob := &structs.Job{Namespace: ltest.namespace, ID: ltest.jobId, Type: ltest.jobType, Meta: ltest.meta}
+		lreason := lfilter.JobFilteredReason(ljob)
+		if (ltest.filtered == "") != (lreason == "") || !strings.Contains(lreason, ltest.filtered) {
+			t.Fatalf("job %s/%s(%s): expected filtered %q, got %q", ltest.namespace, ltest.jobId, ltest.jobType, ltest.filtered, lreason)
+		}
+
+		// meta видна только у job
+		if ltest.meta == nil && lfilter.EvalFilteredReason(&nomad.Evaluation{Namespace: ltest.namespace, JobID: ltest.jobId, Type: ltest.jobType}) != lreason {
+			t.Fatalf("eval of job %s/%s must be filtered as job", ltest.namespace, ltest.jobId)
+		}
+	}
+
+	lpath = writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+filter {
+  job_types = ["servise"]
+}
+`)
+	lerr = configParse(lpath, &Config{})
+	if lerr == nil || !strings.Contains(lerr.Error(), "servise") {
+		t.Fatalf("unknown job type must fail, got: %v", lerr)
+	}
+
+	lpath = writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+filter {
+  jobs = ["regex:web-("]
+}
+`)
+	lerrors, _ := validateConfigFile(lpath)
+	checkValidationErrors(t, lerrors, []string{"config.hcl:4: wrong value of \"jobs\" in filter"})
+}
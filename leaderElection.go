@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/uuid"
+)
+
+// ILeaderLock guarantees that only one of scaler replicas scales and garbage collects pools
+type ILeaderLock interface {
+	Acquire(_ctx context.Context) error // blocks until lock acquired
+	Lost() <-chan struct{}              // closed when lock lost
+	Release() error
+}
+
+func NewLeaderLock(_cnf *LeaderElectionConfig, _nc *nomad.Client) (ILeaderLock, error) {
+	switch _cnf.Type {
+	case "nomad":
+		return NewNomadLeaderLock(_nc, _cnf.Namespace, _cnf.Path, _cnf.TTL), nil
+
+	case "file":
+		if _cnf.Path == "" {
+			return nil, fmt.Errorf("path must be set for file leader lock")
+		}
+
+		return NewFileLeaderLock(_cnf.Path), nil
+	}
+
+	return nil, fmt.Errorf("unknown leader lock type %q, valid types: nomad, file", _cnf.Type)
+}
+
+func leaderHolderId() string {
+	lhostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", lhostname, os.Getpid(), uuid.Generate()[:8])
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// FileLeaderLock is flock on file in shared storage, lock is held until process exits or Release called
+type FileLeaderLock struct {
+	path string
+	file *os.File
+}
+
+func NewFileLeaderLock(_path string) *FileLeaderLock {
+	return &FileLeaderLock{path: _path}
+}
+
+func (l *FileLeaderLock) Acquire(_ctx context.Context) error {
+	for {
+		lfile, lerr := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0600)
+		if lerr != nil {
+			return fmt.Errorf("can't open lock file %s due: %s", l.path, lerr)
+		}
+
+		lerr = syscall.Flock(int(lfile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if lerr == nil {
+			// только для информации, кто держит лок
+			lfile.Truncate(0)
+			lfile.WriteAt([]byte(leaderHolderId()), 0)
+
+			l.file = lfile
+			return nil
+		}
+
+		lfile.Close()
+		if lerr != syscall.EWOULDBLOCK {
+			return fmt.Errorf("can't lock file %s due: %s", l.path, lerr)
+		}
+
+		select {
+		case <-_ctx.Done():
+			return _ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Lost returns nil channel, because flock can't be lost while process alive
+func (l *FileLeaderLock) Lost() <-chan struct{} {
+	return nil
+}
+
+func (l *FileLeaderLock) Release() error {
+	if l.file == nil {
+		return nil
+	}
+
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	lerr := l.file.Close()
+	l.file = nil
+
+	return lerr
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLeaderLock(t *testing.T) {
+	lpath := filepath.Join(t.TempDir(), "leader.lock")
+
+	lleader := NewFileLeaderLock(lpath)
+	lerr := lleader.Acquire(context.Background())
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lstandby := NewFileLeaderLock(lpath)
+	lctx, lcancel := context.WithTimeout(context.Background(), 2*time.Second)
+	lerr = lstandby.Acquire(lctx)
+	lcancel()
+	if lerr != context.DeadlineExceeded {
+		t.Fatalf("standby must not acquire lock while leader holds it, got: %v", lerr)
+	}
+
+	lerr = lleader.Release()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lctx, lcancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer lcancel()
+	lerr = lstandby.Acquire(lctx)
+	if lerr != nil {
+		t.Fatalf("standby must acquire lock after leader released it, got: %v", lerr)
+	}
+	lstandby.Release()
+}
@@ -0,0 +1,28 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+type FileLeaderLock struct {
+	path string
+}
+
+func NewFileLeaderLock(_path string) *FileLeaderLock {
+	return &FileLeaderLock{path: _path}
+}
+
+func (l *FileLeaderLock) Acquire(_ctx context.Context) error {
+	return fmt.Errorf("file leader lock not supported on windows")
+}
+
+func (l *FileLeaderLock) Lost() <-chan struct{} {
+	return nil
+}
+
+func (l *FileLeaderLock) Release() error {
+	return nil
+}
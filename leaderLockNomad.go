@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+)
+
+const (
+	cNomadLeaderLockHolderItem  = "holder"
+	cNomadLeaderLockExpiresItem = "expires"
+)
+
+// NomadLeaderLock is lease stored in nomad variable, all changes of lease made with check-and-set, so only one
+// replica can take it. Lease holder renews it every ttl/6 and steps down if lease was not renewed during ttl*2/3,
+// so remaining ttl/3 covers clock skew between replicas. Other replicas take lease only after it expired
+type NomadLeaderLock struct {
+	client    *nomad.Client
+	namespace string
+	path      string
+	ttl       time.Duration
+	holder    string
+
+	lock      sync.Mutex
+	variable  *nomad.Variable
+	renewedAt time.Time // когда записана последняя лиза, она истекает не раньше renewedAt+ttl
+	lost      chan struct{}
+	stopRenew chan struct{}
+	stopOnce  sync.Once
+}
+
+func NewNomadLeaderLock(_nc *nomad.Client, _namespace string, _path string, _ttl time.Duration) *NomadLeaderLock {
+	return &NomadLeaderLock{
+		client:    _nc,
+		namespace: _namespace,
+		path:      _path,
+		ttl:       _ttl,
+		holder:    leaderHolderId(),
+		lost:      make(chan struct{}),
+		stopRenew: make(chan struct{}),
+	}
+}
+
+func (l *NomadLeaderLock) leaseItems() nomad.VariableItems {
+	return nomad.VariableItems{
+		cNomadLeaderLockHolderItem:  l.holder,
+		cNomadLeaderLockExpiresItem: time.Now().Add(l.ttl).Format(time.RFC3339Nano),
+	}
+}
+
+func (l *NomadLeaderLock) tryAcquire() (bool, error) {
+	lwopts := &nomad.WriteOptions{Namespace: l.namespace}
+	lacquireAt := time.Now()
+
+	lvar, _, lerr := l.client.Variables().Peek(l.path, &nomad.QueryOptions{Namespace: l.namespace})
+	if lerr != nil {
+		return false, fmt.Errorf("can't read nomad variable %s due: %s", l.path, lerr)
+	}
+
+	if lvar == nil {
+		lvar, _, lerr = l.client.Variables().CheckedCreate(&nomad.Variable{Namespace: l.namespace, Path: l.path, Items: l.leaseItems()}, lwopts)
+	} else {
+		if lvar.Items[cNomadLeaderLockHolderItem] != l.holder {
+			lexpires, lerr := time.Parse(time.RFC3339Nano, lvar.Items[cNomadLeaderLockExpiresItem])
+			if lerr == nil && time.Now().Before(lexpires) {
+				return false, nil
+			}
+		}
+
+		lvar.Items = l.leaseItems()
+		lvar, _, lerr = l.client.Variables().CheckedUpdate(lvar, lwopts)
+	}
+
+	if lerr != nil {
+		var lcasErr nomad.ErrCASConflict
+		if errors.As(lerr, &lcasErr) { // другая реплика успела раньше
+			return false, nil
+		}
+
+		return false, fmt.Errorf("can't write nomad variable %s due: %s", l.path, lerr)
+	}
+
+	l.lock.Lock()
+	l.variable = lvar
+	l.renewedAt = lacquireAt
+	l.lock.Unlock()
+
+	return true, nil
+}
+
+func (l *NomadLeaderLock) Acquire(_ctx context.Context) error {
+	logger := hclog.L().Named("leader")
+
+	for {
+		lacquired, lerr := l.tryAcquire()
+		if lerr != nil {
+			logger.Error(fmt.Sprintf("can't acquire leader lock due: %s", lerr))
+		}
+
+		if lacquired {
+			go l.renew()
+			return nil
+		}
+
+		select {
+		case <-_ctx.Done():
+			return _ctx.Err()
+		case <-time.After(l.ttl / 3):
+		}
+	}
+}
+
+// stepDownAfter is how long after lease was written leader may act without renewing it, lease written at that moment
+// expires only after ttl, rest of ttl is left for clock skew between replicas
+func (l *NomadLeaderLock) stepDownAfter() time.Duration {
+	return l.ttl * 2 / 3
+}
+
+func (l *NomadLeaderLock) renew() {
+	logger := hclog.L().Named("leader")
+	lticker := time.NewTicker(l.ttl / 6)
+	defer lticker.Stop()
+
+	l.lock.Lock()
+	lstepDownAt := l.renewedAt.Add(l.stepDownAfter())
+	l.lock.Unlock()
+
+	lstepDown := time.NewTimer(time.Until(lstepDownAt))
+	defer lstepDown.Stop()
+
+	for {
+		select {
+		case <-l.stopRenew:
+			return
+		case <-lstepDown.C:
+			logger.Error(fmt.Sprintf("leader lock not renewed during %s, step down before it expires", l.stepDownAfter()))
+			close(l.lost)
+			return
+		case <-lticker.C:
+		}
+
+		l.lock.Lock()
+		if l.variable == nil {
+			l.lock.Unlock()
+			return
+		}
+
+		// время берем до записи: expires в лизе не раньше, чем lrenewAt+ttl
+		lrenewAt := time.Now()
+		lvar := *l.variable
+		lvar.Items = l.leaseItems()
+
+		// зависший запрос не должен держать нас лидером дольше положенного
+		lctx, lcancel := context.WithDeadline(context.Background(), lstepDownAt)
+		lnewVar, _, lerr := l.client.Variables().CheckedUpdate(&lvar, (&nomad.WriteOptions{Namespace: l.namespace}).WithContext(lctx))
+		lcancel()
+		if lerr == nil {
+			l.variable = lnewVar
+			l.renewedAt = lrenewAt
+		}
+		l.lock.Unlock()
+
+		if lerr == nil {
+			if !lstepDown.Stop() {
+				select {
+				case <-lstepDown.C:
+				default:
+				}
+			}
+
+			lstepDownAt = lrenewAt.Add(l.stepDownAfter())
+			lstepDown.Reset(time.Until(lstepDownAt))
+			continue
+		}
+
+		var lcasErr nomad.ErrCASConflict
+		if errors.As(lerr, &lcasErr) {
+			logger.Error("leader lock was taken by other replica")
+			close(l.lost)
+			return
+		}
+
+		logger.Error(fmt.Sprintf("can't renew leader lock due: %s", lerr))
+	}
+}
+
+func (l *NomadLeaderLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *NomadLeaderLock) Release() error {
+	l.stopOnce.Do(func() {
+		close(l.stopRenew)
+	})
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.variable == nil {
+		return nil
+	}
+
+	_, lerr := l.client.Variables().CheckedDelete(l.path, l.variable.ModifyIndex, &nomad.WriteOptions{Namespace: l.namespace})
+	l.variable = nil
+
+	return lerr
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+)
+
+func TestNomadLeaderLockStepDown(t *testing.T) {
+	lnomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			http.NotFound(w, r)
+		case r.URL.Query().Get("cas") == "0": // создание лизы
+			w.Write([]byte(`{"Namespace": "default", "Path": "ondemand-scaler/leader", "ModifyIndex": 1}`))
+		default: // продлить лизу не удается
+			http.Error(w, "no cluster leader", http.StatusInternalServerError)
+		}
+	}))
+	defer lnomadServer.Close()
+
+	lnc, lerr := nomad.NewClient(&nomad.Config{Address: lnomadServer.URL})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lttl := 600 * time.Millisecond
+	llock := NewNomadLeaderLock(lnc, "default", "ondemand-scaler/leader", lttl)
+	defer llock.Release()
+
+	lacquiredAt := time.Now()
+	if lerr := llock.Acquire(context.Background()); lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	select {
+	case <-llock.Lost():
+		if lheld := time.Since(lacquiredAt); lheld >= lttl {
+			t.Fatalf("leader must step down before lease expired, held %s", lheld)
+		}
+	case <-time.After(2 * lttl):
+		t.Fatalf("leader must step down when lease is not renewed")
+	}
+}
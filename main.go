@@ -4,27 +4,52 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-hclog"
 	nomad "github.com/hashicorp/nomad/api"
 	"github.com/jessevdk/go-flags"
 )
 
-func processNodes(_pools map[string]*Pool, nodeCh <-chan *nomad.Node) {
+// сколько ждем node provider, проверяющего принадлежность ноды пулу, прежде чем перейти к следующему пулу
+const cNodeCheckTimeout = time.Minute
+
+func processNodes(_ctx context.Context, _pools *PoolSet, nodeCh <-chan *nomad.Node) {
 	for _node := range nodeCh {
-		for _, pool := range _pools {
-			if pool.tryNomadNode(_node) {
+		// ноды убранного пула остаются в нем, пока gc их дренирует, новые ноды такой пул не забирает
+		lretired := false
+		for _, pool := range _pools.Retired() {
+			if pool.hasNomadNode(_node.ID) {
+				pool.tryNomadNode(_ctx, _node)
+				lretired = true
+				break
+			}
+		}
+
+		if lretired {
+			continue
+		}
+
+		for _, pool := range _pools.Pools() {
+			// у каждого пула свой таймаут, медленный провайдер одного пула не отнимает время у остальных
+			lctx, lcancel := context.WithTimeout(_ctx, cNodeCheckTimeout)
+			lfound := pool.tryNomadNode(lctx, _node)
+			lcancel()
+
+			if lfound {
 				break
 			}
 		}
 	}
 }
 
-func processAllocs(_pools map[string]*Pool, allocsCh <-chan *nomad.Allocation) {
+func processAllocs(_pools *PoolSet, allocsCh <-chan *nomad.Allocation) {
 	for _alloc := range allocsCh {
-		for _, pool := range _pools {
+		for _, pool := range _pools.Pools() {
 			if pool.tryNomadAllocation(_alloc) {
 				break
 			}
@@ -32,6 +57,48 @@ func processAllocs(_pools map[string]*Pool, allocsCh <-chan *nomad.Allocation) {
 	}
 }
 
+// exitOnSignal gives a chance to save state and release leadership before exit
+func exitOnSignal(_onExit func()) {
+	lsigCh := make(chan os.Signal, 1)
+	signal.Notify(lsigCh, os.Interrupt, syscall.SIGTERM)
+
+	lsig := <-lsigCh
+	hclog.L().Info(fmt.Sprintf("got signal %s, exiting", lsig))
+
+	_onExit()
+	os.Exit(0)
+}
+
+// reloadOnSignal reloads pools and gc settings on SIGHUP
+func reloadOnSignal(_reloader *ConfigReloader) {
+	lsigCh := make(chan os.Signal, 1)
+	signal.Notify(lsigCh, syscall.SIGHUP)
+
+	for range lsigCh {
+		hclog.L().Info("got SIGHUP, reloading config")
+
+		lerr := _reloader.Reload()
+		if lerr != nil {
+			hclog.L().Error(fmt.Sprintf("can't reload config, so continue with previous one, due: %s", lerr))
+		}
+	}
+}
+
+func setVerbosity(_verbose []bool) {
+	switch len(_verbose) {
+	case 0:
+		hclog.L().SetLevel(hclog.Warn)
+	case 1:
+		hclog.L().SetLevel(hclog.Info)
+	case 2:
+		fallthrough
+	case 3:
+		hclog.L().SetLevel(hclog.Debug)
+	default:
+		hclog.L().SetLevel(hclog.Trace)
+	}
+}
+
 func main() {
 	appLogger := hclog.New(&hclog.LoggerOptions{
 		Name:       "nomad-ondemand-scaler",
@@ -46,7 +113,12 @@ func main() {
 	hclog.SetDefault(appLogger)
 	var opts Opts
 
-	_, err := flags.Parse(&opts)
+	lparser := flags.NewParser(&opts, flags.Default)
+	lparser.SubcommandsOptional = true
+	lparser.AddCommand("plan", "Show pools and new nodes that job would need", "Offline shows for every task group of job file which pool scaler would choose(or why none of pools is feasible) and how many new nodes it would request, if pool had no free space", &PlanCommand{opts: &opts})
+	lparser.AddCommand("validate", "Validate config and pool yaml", "Fully checks scaler config and pool yaml it refers to, without starting scaler, every found error is printed with file and line", &ValidateCommand{opts: &opts})
+
+	_, err := lparser.Parse()
 	if err != nil {
 		if lperr, ok := err.(*flags.Error); ok {
 			switch lperr.Type {
@@ -64,19 +136,12 @@ func main() {
 		}
 	}
 
-	switch len(opts.Verbose) {
-	case 0:
-		appLogger.SetLevel(hclog.Warn)
-	case 1:
-		appLogger.SetLevel(hclog.Info)
-	case 2:
-		fallthrough
-	case 3:
-		appLogger.SetLevel(hclog.Debug)
-	default:
-		appLogger.SetLevel(hclog.Trace)
+	if lparser.Active != nil { // subcommand already done its work
+		return
 	}
 
+	setVerbosity(opts.Verbose)
+
 	var config Config
 	lerr := configParse(opts.ConfigPath, &config)
 	if lerr != nil {
@@ -88,63 +153,231 @@ func main() {
 		log.Fatalf("[ERROR] can't parce pool yaml due: %s", lerr)
 	}
 
+	lerr = checkDuplicatePools(poolSpecs)
+	if lerr != nil {
+		log.Fatalf("[ERROR] wrong pool yaml: %s", lerr)
+	}
+
+	for _, loverlap := range findPoolOverlaps(poolSpecs) {
+		hclog.L().Warn(loverlap.Msg)
+	}
+
 	lstateStat := NewStateStat() // объект статистической инфы
 
 	if config.Telemetry != nil {
-		l_metricsConfig := metrics.DefaultConfig(config.Telemetry[0].Prefix)
-		l_metricsConfig.EnableHostname = false
-		l_metricsConfig.EnableRuntimeMetrics = false
-
-		lstatsSink, lerr := metrics.NewStatsiteSink(config.Telemetry[0].StatSiteAddr)
+		lerr = setupTelemetry(config.Telemetry[0])
 		if lerr != nil {
-			log.Fatalf("[ERROR] can't init statsite sink due: %s", lerr)
+			log.Fatalf("[ERROR] can't init telemetry due: %s", lerr)
 		}
-		metrics.NewGlobal(l_metricsConfig, lstatsSink)
-		go sendStats(lstateStat)
 	}
 
-	cnf := nomad.DefaultConfig()
-	nclient, lerr := nomad.NewClient(cnf)
+	nclient, lerr := NewNomadClient(config.Nomad[0])
 	if lerr != nil {
 		log.Fatalf("[ERROR] can't init nomad client due: %s", lerr)
 	}
 
-	lpools, lnomadLastIndex, lerr := createPools(config.StaleNomadApi[0], nclient, poolSpecs)
+	var lstateStore IStateStore
+	var lrestoredState *ScalerState
+	if len(config.State) > 0 {
+		lstateStore, lerr = NewStateStore(config.State[0], nclient)
+		if lerr != nil {
+			log.Fatalf("[ERROR] can't init state store due: %s", lerr)
+		}
+
+		lrestoredState, lerr = LoadScalerState(lstateStore)
+		if lerr != nil {
+			hclog.L().Error(fmt.Sprintf("can't restore saved state, so start from scratch, due: %s", lerr))
+		}
+	}
+	lpersist := NewPersistentState(lrestoredState)
+
+	lcreatedPools, lnomadLastIndex, lerr := createPools(config.StaleNomadApi[0], nclient, poolSpecs)
 	if lerr != nil {
 		log.Fatalf("[ERROR] can't create pools due: %s", lerr)
 	}
 
+	if opts.DryRun {
+		hclog.L().Warn("dry run mode, node providers will not be called to add or remove nodes")
+		for _, lpool := range lcreatedPools {
+			lpool.SetDryRun(true)
+		}
+	}
+
+	lpools := NewPoolSet(lcreatedPools, poolSpecs)
+	lpools.SetMaxNodes(config.MaxNodes)
+	lgcconfigs := &atomic.Pointer[GarbageCollectorConfig]{}
+	lgcconfigs.Store(config.GC[0])
+	lfilters := &atomic.Pointer[FilterConfig]{}
+	lfilters.Store(config.Filter[0])
+
+	// продолжаем читать события с места остановки, чтобы не пропустить то что случилось пока нас не было
+	if lrestoredIndex := lpersist.GetNomadLastIndex(); lrestoredIndex > 0 && lrestoredIndex < lnomadLastIndex {
+		hclog.L().Info(fmt.Sprintf("resume nomad event stream from index %d", lrestoredIndex))
+		lnomadLastIndex = lrestoredIndex
+	}
+	lpersist.SetNomadLastIndex(lnomadLastIndex)
+
+	if config.Telemetry != nil {
+		go sendStats(lstateStat, lpools)
+	}
+
 	scalingRequireCh := NewQueue[*ScalingEvent]()
 	scalingDoneCh := make(chan string, 10)
 
+	restoredEventsCh := make(chan *RestoredScalingEvents)
+	scalingCancelCh := make(chan *ScalingCancelRequest)
+	gcForceCh := make(chan struct{}, 1)
+	gcRemoveCh := make(chan *GCRemoveRequest)
+
 	evalCh := make(chan *nomad.Evaluation)
-	go processEvals(lstateStat, config.StaleNomadApi[0], config.HungPrevention[0], evalCh, scalingRequireCh, scalingDoneCh, poolSpecs)
+	go processEvals(lstateStat, nclient, config.StaleNomadApi[0], config.HungPrevention[0], evalCh, scalingRequireCh, scalingDoneCh, restoredEventsCh, scalingCancelCh, lpools, lfilters)
+
+	if len(config.HttpApi) > 0 {
+		lhttpApi := NewHttpApi(lstateStat, lpersist, lpools, scalingRequireCh)
+		if config.HttpApi[0].Token != "" {
+			lhttpApi.SetControl(&HttpApiControl{
+				Token:           config.HttpApi[0].Token,
+				GCForceCh:       gcForceCh,
+				GCRemoveCh:      gcRemoveCh,
+				ScalingCancelCh: scalingCancelCh,
+			})
+		}
+
+		lerr = lhttpApi.Serve(config.HttpApi[0].BindAddr)
+		if lerr != nil {
+			log.Fatalf("[ERROR] can't start http api due: %s", lerr)
+		}
+	}
 
-	lstateStat.SetTotalScalingThreads(opts.ScaleThreads)
-	for i := 0; i < opts.ScaleThreads; i++ {
-		hclog.L().Info(fmt.Sprintf("Start scale thread %d", i+1))
-		lstateStat.IncFreeScalingThreads()
-		go scalingAction(lstateStat, lpools, scalingRequireCh, scalingDoneCh)
+	var lleaderLock ILeaderLock
+	if len(config.Leader) > 0 {
+		lleaderLock, lerr = NewLeaderLock(config.Leader[0], nclient)
+		if lerr != nil {
+			log.Fatalf("[ERROR] can't init leader lock due: %s", lerr)
+		}
 	}
 
-	if opts.ScaleThreads > 0 {
-		hclog.L().Info("Start gc thread")
-		lstateStat.SetTotalGcThreads(1)
-		lstateStat.IncFreeGcThreads()
-		go gcAction(lstateStat, config.GC[0], nclient, lpools)
+	// только лидер скейлит и собирает мусор, standby реплики лишь поддерживают пулы в актуальном состоянии по событиям nomad
+	lbecomeLeader := func() {
+		lstateStat.SetLeader(true)
+
+		if lleaderLock != nil && lstateStore != nil {
+			// пока мы были standby, состояние сохранял прошлый лидер
+			lrestoredState, lerr := LoadScalerState(lstateStore)
+			if lerr != nil {
+				hclog.L().Error(fmt.Sprintf("can't restore state saved by previous leader due: %s", lerr))
+			}
+			lpersist.Restore(lrestoredState)
+		}
+
+		lpersist.RestoreProviders(lpools.Pools())
+
+		lrestoredEvents := &RestoredScalingEvents{
+			Events: resumeScalings(lpersist, lpools.Pools(), config.HungPrevention[0], scalingDoneCh),
+			Done:   make(chan struct{}),
+		}
+		restoredEventsCh <- lrestoredEvents
+		<-lrestoredEvents.Done
+
+		lstateStat.SetTotalScalingThreads(opts.ScaleThreads)
+		for i := 0; i < opts.ScaleThreads; i++ {
+			hclog.L().Info(fmt.Sprintf("Start scale thread %d", i+1))
+			lstateStat.IncFreeScalingThreads()
+			go scalingAction(lstateStat, lpersist, lpools, scalingRequireCh, scalingDoneCh)
+		}
+
+		if opts.ScaleThreads > 0 {
+			hclog.L().Info("Start system jobs watch thread")
+			go watchSystemJobs(config.StaleNomadApi[0], nclient, config.Nomad[0].Namespace, lpools)
+
+			hclog.L().Info("Start gc thread")
+			lstateStat.SetTotalGcThreads(1)
+			lstateStat.IncFreeGcThreads()
+			go gcAction(lstateStat, lpersist, lgcconfigs, nclient, lpools, scalingRequireCh, gcForceCh, gcRemoveCh)
+		}
+
+		if lstateStore != nil {
+			hclog.L().Info("Start state checkpoint thread")
+			go checkpointState(lpersist, lstateStore, config.State[0].CheckpointPeriod, lpools)
+		}
+	}
+
+	if lleaderLock != nil {
+		go func() {
+			hclog.L().Info("Waiting for leadership")
+			lerr := lleaderLock.Acquire(context.Background())
+			if lerr != nil {
+				log.Fatalf("[ERROR] can't acquire leader lock due: %s", lerr)
+			}
+
+			hclog.L().Info("Became leader")
+			lbecomeLeader()
+
+			<-lleaderLock.Lost()
+			log.Fatalf("[ERROR] leadership lost, exit so only one replica acts on pools")
+		}()
+	} else {
+		lbecomeLeader()
+	}
+
+	// прерывает проверки нод, которые идут в node provider, когда scaler завершается
+	lshutdownCtx, lshutdownFn := context.WithCancel(context.Background())
+	defer lshutdownFn()
+
+	if lstateStore != nil || lleaderLock != nil {
+		go exitOnSignal(func() {
+			lshutdownFn()
+
+			if !lstateStat.IsLeader() {
+				return
+			}
+
+			if lstateStore != nil {
+				lerr := lpersist.Checkpoint(lstateStore, lpools.Pools())
+				if lerr != nil {
+					hclog.L().Error(fmt.Sprintf("can't checkpoint state due: %s", lerr))
+				}
+				lstateStore.Close()
+			}
+
+			if lleaderLock != nil {
+				lerr := lleaderLock.Release()
+				if lerr != nil {
+					hclog.L().Error(fmt.Sprintf("can't release leader lock due: %s", lerr))
+				}
+			}
+		})
 	}
 
 	nodeCh := make(chan *nomad.Node)
-	go processNodes(lpools, nodeCh)
+	go processNodes(lshutdownCtx, lpools, nodeCh)
 
 	allocCh := make(chan *nomad.Allocation)
 	go processAllocs(lpools, allocCh)
 
 	go dumpSateonSignal(lstateStat, lpools)
 
+	// без потоков скейлинга gc не запускается, ноды убранных пулов дренировать некому
+	var lretiredRemoveCh chan<- *GCRemoveRequest
+	if opts.ScaleThreads > 0 {
+		lretiredRemoveCh = gcRemoveCh
+	}
+
+	lreloader := NewConfigReloader(opts.ConfigPath, config.StaleNomadApi[0], nclient, lstateStat, lpools, lgcconfigs, lfilters, opts.DryRun, lretiredRemoveCh)
+	go reloadOnSignal(lreloader)
+
 	//в nomad 1.1.x evals не поддерживают зведочку в качестве wildcard для всех неймспейсов, в 1.3 это уже поправлено, и этот код можно будет упростить
 	namespcpaces, _, _ := nclient.Namespaces().List(nil)
+	if config.Nomad[0].Namespace != "" { // следим только за заданным namespace
+		namespcpaces = []*nomad.Namespace{{Name: config.Nomad[0].Namespace}}
+	}
+
 	for _, namespace := range namespcpaces {
+		if lreason := config.Filter[0].NamespaceFilteredReason(namespace.Name); lreason != "" {
+			hclog.L().Info(fmt.Sprintf("skip evals listing: %s", lreason))
+			continue
+		}
+
 		lnqoptions := nomad.QueryOptions{Namespace: namespace.Name, AllowStale: config.StaleNomadApi[0].Allow}
 		evals, _, lerr := nclient.Evaluations().List(&lnqoptions)
 		if lerr != nil {
@@ -190,6 +423,7 @@ func main() {
 			}
 
 			lnomadLastIndex = lei.Index
+			lpersist.SetNomadLastIndex(lnomadLastIndex)
 
 			for _, le := range lei.Events {
 				switch le.Topic {
@@ -200,6 +434,10 @@ func main() {
 						continue
 					}
 
+					if config.Nomad[0].Namespace != "" && lEval.Namespace != config.Nomad[0].Namespace {
+						continue
+					}
+
 					if hclog.L().GetLevel() == hclog.Trace {
 						hclog.L().Trace(fmt.Sprintf("eval: %s, status: %s", lEval.ID, lEval.Status))
 					}
@@ -13,21 +13,30 @@ type AnyNodeProvider struct {
 	logger hclog.Logger
 }
 
+func init() {
+	RegisterProvider("anynode", &ParamSchema{Type: ParamTypeAny}, func(_ interface{}, _ *ProviderResources) (INodeProvider, error) {
+		return NewAnyNodeProvider()
+	})
+	RegisterProviderIdentity("anynode", func(_ interface{}) string {
+		return "anynode" // claims any node
+	})
+}
+
 func NewAnyNodeProvider() (INodeProvider, error) {
 	return &AnyNodeProvider{
 		logger: hclog.L().Named("AnyNodeProvider"),
 	}, nil
 }
 
-func (c *AnyNodeProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
+func (c *AnyNodeProvider) IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error) {
 	lastTime := _nomadNode.Events[len(_nomadNode.Events)-1].Timestamp
 	c.logger.Debug(fmt.Sprintf("IsNodeExists for nomad node: %s with laststevent time: %s", _nomadNode.ID, lastTime))
 
-	return true
+	return true, nil
 }
 
-func (c *AnyNodeProvider) RemoveNode(_nomadNode []*nomad.Node) error {
-	return fmt.Errorf("RemoveNode not possible for AnyNodeProvider")
+func (c *AnyNodeProvider) RemoveNode(_ctx context.Context, _nomadNodes []*nomad.Node) RemoveNodeResults {
+	return NewRemoveNodeResults(_nomadNodes, RemoveNodeStatusFailedPermanent, fmt.Errorf("RemoveNode not possible for AnyNodeProvider"))
 }
 
 func (c *AnyNodeProvider) UpdateNode(_ctx context.Context, _nodes []*structs.Node, _totalcount int32) error {
@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	asgtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/smithy-go"
@@ -84,7 +85,7 @@ func NewAwsAutoscaleGroupProvider(_asgName string) (INodeProvider, error) {
 	}, nil
 }
 
-func (c *AwsAutoscaleGroupProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
+func (c *AwsAutoscaleGroupProvider) IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error) {
 	lloger := c.logger.Named("IsNodeExists")
 	llastregisterevnt := GetLastRegisterEvent(_nomadNode.Events)
 	lastTime := llastregisterevnt.Timestamp
@@ -98,14 +99,16 @@ func (c *AwsAutoscaleGroupProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
 		newstate := map[string]bool{}
 
 		for {
-			_, lerr := updateStateFromAws(context.TODO(), c.asgClient, c.asgName, newstate)
+			_, lerr := updateStateFromAws(_ctx, c.asgClient, c.asgName, newstate)
 			if lerr == nil {
 				lloger.Debug(fmt.Sprintf("successed updated state when check insatnceId: %s(nomadnodeid: %s)", instanceId, _nomadNode.ID))
 				break
 			}
 
 			lloger.Error(fmt.Sprintf("can't update state due: %s", lerr))
-			time.Sleep(10 * time.Second)
+			if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+				return false, fmt.Errorf("can't update state due: %s", lerr)
+			}
 		}
 
 		c.lock.Lock()
@@ -124,7 +127,7 @@ func (c *AwsAutoscaleGroupProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
 	}
 	c.lock.Unlock()
 
-	return lNodeExists
+	return lNodeExists, nil
 }
 
 func extractInstanceIDs(input string) []string {
@@ -143,8 +146,19 @@ func extractInstanceIDs(input string) []string {
 	return instanceIDs
 }
 
-func (c *AwsAutoscaleGroupProvider) _removeNode(lloger hclog.Logger, instncesIds []string) error {
-	cfg, _ := config.LoadDefaultConfig(context.TODO())
+// _removeNode returns results by instance id, on context cancelation all not yet removed instances reported as retryable failures
+func (c *AwsAutoscaleGroupProvider) _removeNode(_ctx context.Context, lloger hclog.Logger, instncesIds []string) map[string]*RemoveNodeResult {
+	lresults := map[string]*RemoveNodeResult{}
+	// инстансы, о которых уже известен результат(например что их нет в группе), не перезаписываем
+	markInstances := func(_instncesIds []string, _status RemoveNodeStatus, _reason error) {
+		for _, linstanceId := range _instncesIds {
+			if _, lok := lresults[linstanceId]; !lok {
+				lresults[linstanceId] = &RemoveNodeResult{Status: _status, Reason: _reason}
+			}
+		}
+	}
+
+	cfg, _ := config.LoadDefaultConfig(_ctx)
 	ec2Client := ec2.NewFromConfig(cfg)
 
 	// https://docs.aws.amazon.com/cli/latest/reference/autoscaling/detach-instances.html#options
@@ -154,7 +168,7 @@ func (c *AwsAutoscaleGroupProvider) _removeNode(lloger hclog.Logger, instncesIds
 
 		// Датач экземпляра из Auto Scaling группы
 		for {
-			_, lerr := c.asgClient.DetachInstances(context.TODO(), &autoscaling.DetachInstancesInput{
+			_, lerr := c.asgClient.DetachInstances(_ctx, &autoscaling.DetachInstancesInput{
 				InstanceIds:                    instncesIdsBatch,
 				AutoScalingGroupName:           aws.String(c.asgName),
 				ShouldDecrementDesiredCapacity: aws.Bool(true),
@@ -168,6 +182,7 @@ func (c *AwsAutoscaleGroupProvider) _removeNode(lloger hclog.Logger, instncesIds
 			if errors.As(lerr, &validationErr) {
 				if validationErr.ErrorCode() == "ValidationError" {
 					notexistentInstances := extractInstanceIDs(validationErr.ErrorMessage())
+					markInstances(notexistentInstances, RemoveNodeStatusNotFound, fmt.Errorf("instance is not part of autoscale group %s", c.asgName))
 					instncesIdsBatch = RemoveSliceElements(instncesIdsBatch, notexistentInstances)
 				}
 			}
@@ -177,7 +192,10 @@ func (c *AwsAutoscaleGroupProvider) _removeNode(lloger hclog.Logger, instncesIds
 			}
 
 			lloger.Error(fmt.Sprintf("failed to detach instance from Auto Scaling group: %v", lerr))
-			time.Sleep(10 * time.Second)
+			if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+				markInstances(instncesIds[i:], RemoveNodeStatusFailedRetryable, fmt.Errorf("can't detach instances due: %s", lerr))
+				return lresults
+			}
 		}
 
 		if len(instncesIdsBatch) == 0 {
@@ -189,45 +207,46 @@ func (c *AwsAutoscaleGroupProvider) _removeNode(lloger hclog.Logger, instncesIds
 		for {
 			updatetime := time.Now()
 			newstate = map[string]bool{}
-			_, lerr := updateStateFromAws(context.TODO(), c.asgClient, c.asgName, newstate)
-			if lerr != nil {
-				lloger.Error(fmt.Sprintf("can't update state due: %s", lerr))
-				time.Sleep(10 * time.Second)
-
-				continue
-			}
-
-			var someInstancesExists bool
-			for _, instanceId := range instncesIds {
-				if _, lok := newstate[instanceId]; lok {
-					someInstancesExists = true
-					break
+			_, lerr := updateStateFromAws(_ctx, c.asgClient, c.asgName, newstate)
+			if lerr == nil {
+				var someInstancesExists bool
+				for _, instanceId := range instncesIdsBatch {
+					if _, lok := newstate[instanceId]; lok {
+						someInstancesExists = true
+						break
+					}
 				}
-			}
 
-			if !someInstancesExists {
-				c.lock.Lock()
+				if !someInstancesExists {
+					c.lock.Lock()
 
-				for linstanceid := range newstate {
-					if seenbypool, lok := c.state[linstanceid]; lok {
-						newstate[linstanceid] = seenbypool
+					for linstanceid := range newstate {
+						if seenbypool, lok := c.state[linstanceid]; lok {
+							newstate[linstanceid] = seenbypool
+						}
 					}
-				}
 
-				c.state = newstate
-				c.lastUpdatetime = updatetime
+					c.state = newstate
+					c.lastUpdatetime = updatetime
 
-				c.lock.Unlock()
+					c.lock.Unlock()
 
-				break
+					break
+				}
+			} else {
+				lloger.Error(fmt.Sprintf("can't update state due: %s", lerr))
 			}
 
-			time.Sleep(5 * time.Second)
+			if lerr := sleepWithContext(_ctx, 5*time.Second); lerr != nil {
+				markInstances(instncesIdsBatch, RemoveNodeStatusFailedRetryable, fmt.Errorf("can't wait instances detach due: %s", lerr))
+				markInstances(instncesIds[Min(i+20, len(instncesIds)):], RemoveNodeStatusFailedRetryable, lerr)
+				return lresults
+			}
 		}
 
 		// терминирование инстансов
 		for {
-			_, lerr := ec2Client.TerminateInstances(context.TODO(), &ec2.TerminateInstancesInput{
+			_, lerr := ec2Client.TerminateInstances(_ctx, &ec2.TerminateInstancesInput{
 				InstanceIds: instncesIdsBatch,
 			})
 			if lerr == nil {
@@ -235,51 +254,71 @@ func (c *AwsAutoscaleGroupProvider) _removeNode(lloger hclog.Logger, instncesIds
 			}
 
 			lloger.Error(fmt.Sprintf("failed to terminate instance due: %s", lerr))
-			time.Sleep(10 * time.Second)
+			if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+				markInstances(instncesIdsBatch, RemoveNodeStatusFailedRetryable, fmt.Errorf("can't terminate detached instances due: %s", lerr))
+				markInstances(instncesIds[Min(i+20, len(instncesIds)):], RemoveNodeStatusFailedRetryable, lerr)
+				return lresults
+			}
 		}
 
 		// ожидание завершения терминирования
 		for {
-			resp, lerr := ec2Client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
+			resp, lerr := ec2Client.DescribeInstances(_ctx, &ec2.DescribeInstancesInput{
 				InstanceIds: instncesIdsBatch,
 			})
-			if lerr != nil {
-				lloger.Error(fmt.Sprintf("failed to describe instances due: %s", lerr))
-				time.Sleep(10 * time.Second)
-				continue
-			}
-
-			allTerminated := true
-			for _, reservation := range resp.Reservations {
-				for _, instance := range reservation.Instances {
-					if instance.State.Name != ec2types.InstanceStateNameTerminated {
-						allTerminated = false
-						break
+			if lerr == nil {
+				allTerminated := true
+				for _, reservation := range resp.Reservations {
+					for _, instance := range reservation.Instances {
+						if instance.State.Name != ec2types.InstanceStateNameTerminated {
+							allTerminated = false
+							break
+						}
 					}
 				}
-			}
 
-			if allTerminated {
-				break
+				if allTerminated {
+					break
+				}
+			} else {
+				lloger.Error(fmt.Sprintf("failed to describe instances due: %s", lerr))
 			}
 
-			time.Sleep(10 * time.Second)
+			if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+				markInstances(instncesIdsBatch, RemoveNodeStatusFailedRetryable, fmt.Errorf("can't wait instances termination due: %s", lerr))
+				markInstances(instncesIds[Min(i+20, len(instncesIds)):], RemoveNodeStatusFailedRetryable, lerr)
+				return lresults
+			}
 		}
+
+		markInstances(instncesIdsBatch, RemoveNodeStatusRemoved, nil)
 	}
 
-	return nil
+	return lresults
 }
 
-func (c *AwsAutoscaleGroupProvider) RemoveNode(_nomadNodes []*nomad.Node) error {
+func (c *AwsAutoscaleGroupProvider) RemoveNode(_ctx context.Context, _nomadNodes []*nomad.Node) RemoveNodeResults {
 	lloger := c.logger.Named("RemoveNode")
+	lresults := RemoveNodeResults{}
+	lnodesByInstances := map[string]string{}
 	var instncesIds []string
 
 	for _, lnode := range _nomadNodes {
-		instanceId := lnode.Attributes["unique.platform.aws.instance-id"]
+		instanceId, lok := lnode.Attributes["unique.platform.aws.instance-id"]
+		if !lok {
+			lresults[lnode.ID] = &RemoveNodeResult{Status: RemoveNodeStatusFailedPermanent, Reason: fmt.Errorf("node have no aws instance-id attribute")}
+			continue
+		}
+
+		lnodesByInstances[instanceId] = lnode.ID
 		instncesIds = append(instncesIds, instanceId)
 	}
 
-	return c._removeNode(lloger, instncesIds)
+	for linstanceId, lresult := range c._removeNode(_ctx, lloger, instncesIds) {
+		lresults[lnodesByInstances[linstanceId]] = lresult
+	}
+
+	return lresults
 }
 
 func (c *AwsAutoscaleGroupProvider) UpdateNode(_ctx context.Context, _nodes []*structs.Node, _totalcount int32) error {
@@ -308,7 +347,7 @@ func (c *AwsAutoscaleGroupProvider) UpdateNode(_ctx context.Context, _nodes []*s
 	//обнаружили рассинхрон, сначала пытаемся просто обновить стейт
 	if len(instancetoremove) > 0 {
 		lloger.Warn(fmt.Sprintf("pool reported about differense in nodes %d(my) -> %d(pool oppinion), so, remove unexisten: %v", lmynodescount, len(_nodes), instancetoremove))
-		c._removeNode(lloger, instancetoremove)
+		c._removeNode(_ctx, lloger, instancetoremove)
 	}
 
 	for {
@@ -326,8 +365,34 @@ func (c *AwsAutoscaleGroupProvider) UpdateNode(_ctx context.Context, _nodes []*s
 		}
 
 		lloger.Error(fmt.Sprintf("can't set asg disiresize size to: %d due: %s", _totalcount, lerr))
-		time.Sleep(10 * time.Second)
+		if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+			return lerr
+		}
 	}
 
 	return nil
 }
+
+// InsufficientCapacity looks for failed scaling activities of asg started after _since, asg retries them itself, so
+// it never reaches desired size while aws have no capacity
+func (c *AwsAutoscaleGroupProvider) InsufficientCapacity(_ctx context.Context, _since time.Time) (string, error) {
+	lactivities, lerr := c.asgClient.DescribeScalingActivities(_ctx, &autoscaling.DescribeScalingActivitiesInput{
+		AutoScalingGroupName: aws.String(c.asgName),
+		MaxRecords:           aws.Int32(20),
+	})
+	if lerr != nil {
+		return "", fmt.Errorf("can't describe scaling activities of asg %s due: %s", c.asgName, lerr)
+	}
+
+	for _, lactivity := range lactivities.Activities {
+		if lactivity.StartTime == nil || lactivity.StartTime.Before(_since) {
+			continue
+		}
+
+		if lactivity.StatusCode == asgtypes.ScalingActivityStatusCodeFailed && lactivity.StatusMessage != nil {
+			return *lactivity.StatusMessage, nil
+		}
+	}
+
+	return "", nil
+}
@@ -5,7 +5,19 @@ import (
 	"reflect"
 )
 
-func Createawsautoscalegroupv2(_params interface{}) (INodeProvider, error) {
+func init() {
+	RegisterProvider("awsautoscale", &ParamSchema{Type: ParamTypeList, Required: true}, Createawsautoscalegroupv2)
+	RegisterProviderIdentity("awsautoscale", func(_params interface{}) string {
+		lparams := _params.([]interface{})
+		if len(lparams) == 0 {
+			return ""
+		}
+
+		return fmt.Sprintf("asg %v", lparams[0])
+	})
+}
+
+func Createawsautoscalegroupv2(_params interface{}, _ *ProviderResources) (INodeProvider, error) {
 	params, lok := _params.([]interface{})
 	if !lok {
 		return nil, fmt.Errorf("params is not []string")
@@ -2,13 +2,77 @@ package nodeprovider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	nomad "github.com/hashicorp/nomad/api"
 	"github.com/hashicorp/nomad/nomad/structs"
 )
 
+type RemoveNodeStatus int
+
+const (
+	RemoveNodeStatusRemoved RemoveNodeStatus = iota
+	RemoveNodeStatusNotFound
+	RemoveNodeStatusFailedRetryable
+	RemoveNodeStatusFailedPermanent
+)
+
+func (s RemoveNodeStatus) String() string {
+	switch s {
+	case RemoveNodeStatusRemoved:
+		return "removed"
+	case RemoveNodeStatusNotFound:
+		return "notfound"
+	case RemoveNodeStatusFailedRetryable:
+		return "failed(retryable)"
+	case RemoveNodeStatusFailedPermanent:
+		return "failed(permanent)"
+	}
+
+	return "unknown"
+}
+
+type RemoveNodeResult struct {
+	Status RemoveNodeStatus
+	Reason error
+}
+
+func (r *RemoveNodeResult) String() string {
+	if r.Reason != nil {
+		return fmt.Sprintf("%s: %s", r.Status, r.Reason)
+	}
+
+	return r.Status.String()
+}
+
+// RemoveNodeResults is result of RemoveNode by nomad node id
+type RemoveNodeResults map[string]*RemoveNodeResult
+
+func NewRemoveNodeResults(_nomadNodes []*nomad.Node, _status RemoveNodeStatus, _reason error) RemoveNodeResults {
+	lresults := RemoveNodeResults{}
+	for _, lnomadNode := range _nomadNodes {
+		lresults[lnomadNode.ID] = &RemoveNodeResult{Status: _status, Reason: _reason}
+	}
+
+	return lresults
+}
+
 type INodeProvider interface {
-	IsNodeExists(_nomadNode *nomad.Node) bool
-	RemoveNode(_nomadNode []*nomad.Node) error //TODO возможно добавить передачу контекста, чтобы была возможность отмены
+	IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error)
+	RemoveNode(_ctx context.Context, _nomadNode []*nomad.Node) RemoveNodeResults
 	UpdateNode(_сtx context.Context, _nodes []*structs.Node, _totalcount int32) error
 }
+
+// ICapacityNodeProvider is optionally implemented by providers that can tell that cloud has no capacity for requested
+// nodes, so scaler can fall back to other pool without waiting
+type ICapacityNodeProvider interface {
+	// InsufficientCapacity returns reason why nodes requested after _since can't be added, empty if there is no such reason
+	InsufficientCapacity(_ctx context.Context, _since time.Time) (string, error)
+}
+
+// IStatefulNodeProvider is optionally implemented by providers that keep in memory state, which must survive scaler restart
+type IStatefulNodeProvider interface {
+	SaveState() ([]byte, error)
+	RestoreState(_state []byte) error
+}
@@ -2,6 +2,7 @@ package nodeprovider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,11 +17,7 @@ import (
 	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider/karpenterprovidergrpc"
 )
 
-type K8sKapenterProviderResources struct {
-	Cpu    int
-	MemMB  int
-	DiskMB int
-}
+type K8sKapenterProviderResources = ProviderResources
 
 type K8sKapenterProviderPLuginSingleton struct {
 	once      sync.Once
@@ -66,6 +63,15 @@ func getK8sKapenterProviderPLuginSingleton() (plugin.ClientProtocol, error) {
 	return gK8sKapenterProviderPluginSingleton.rpcClient, gK8sKapenterProviderPluginSingleton.err
 }
 
+// if scaler restarted while instances were adding, we don't know how much of them karpenter actualy created,
+// so restored increments are counted only limited time, after that pool state from karpenter is trusted
+const cKarpenterRestoredIncTTL = 10 * time.Minute
+
+type karpenterIncEphemeral struct {
+	Count int32     `json:"count"`
+	Time  time.Time `json:"time"`
+}
+
 type K8sKapenterProvider struct {
 	lock   sync.Mutex
 	logger hclog.Logger
@@ -75,14 +81,18 @@ type K8sKapenterProvider struct {
 
 	name           string
 	state          map[string]bool
-	incephemeral   map[string]int32
+	incephemeral   map[string]*karpenterIncEphemeral
 	lastUpdatetime time.Time
+
+	// последняя причина, по которой karpenter добавил не все инстансы
+	lastAddFailure     string
+	lastAddFailureTime time.Time
 }
 
-func updateStateFromKapenterPlugin(_poolName string, _k K8sKapenterProviderPluginInterface, _state map[string]bool) (int32, error) {
+func updateStateFromKapenterPlugin(_ctx context.Context, _poolName string, _k K8sKapenterProviderPluginInterface, _state map[string]bool) (int32, error) {
 	var desiredCapacity int32
 
-	linstances, lerr := _k.ListInstances(_poolName)
+	linstances, lerr := _k.ListInstances(_ctx, _poolName)
 	if lerr != nil {
 		return 0, lerr
 	}
@@ -108,7 +118,7 @@ func NewK8sKapenterProvider(_name string, _ami map[string]string, _securityGroup
 	newstate := map[string]bool{}
 	svc := raw.(K8sKapenterProviderPluginInterface)
 
-	_, lerr = updateStateFromKapenterPlugin(_name, svc, newstate)
+	_, lerr = updateStateFromKapenterPlugin(context.TODO(), _name, svc, newstate)
 	if lerr != nil {
 		return nil, lerr
 	}
@@ -141,12 +151,12 @@ func NewK8sKapenterProvider(_name string, _ami map[string]string, _securityGroup
 			Resources:       lres,
 		},
 		state:          newstate,
-		incephemeral:   map[string]int32{},
+		incephemeral:   map[string]*karpenterIncEphemeral{},
 		lastUpdatetime: time.Now(),
 	}, nil
 }
 
-func (p *K8sKapenterProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
+func (p *K8sKapenterProvider) IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error) {
 	lloger := p.logger.Named("IsNodeExists")
 	llastregisterevnt := GetLastRegisterEvent(_nomadNode.Events)
 	lastTime := llastregisterevnt.Timestamp
@@ -160,14 +170,16 @@ func (p *K8sKapenterProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
 		newstate := map[string]bool{}
 
 		for {
-			_, lerr := updateStateFromKapenterPlugin(p.name, p.plugin, newstate)
+			_, lerr := updateStateFromKapenterPlugin(_ctx, p.name, p.plugin, newstate)
 			if lerr == nil {
 				lloger.Debug(fmt.Sprintf("successed updated state when check insatnceId: %s(nomadnodeid: %s)", instanceId, _nomadNode.ID))
 				break
 			}
 
 			lloger.Error(fmt.Sprintf("can't update state due: %s", lerr))
-			time.Sleep(10 * time.Second)
+			if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+				return false, fmt.Errorf("can't update state due: %s", lerr)
+			}
 		}
 
 		p.lock.Lock()
@@ -186,10 +198,13 @@ func (p *K8sKapenterProvider) IsNodeExists(_nomadNode *nomad.Node) bool {
 	}
 	p.lock.Unlock()
 
-	return lNodeExists
+	return lNodeExists, nil
 }
 
-func (p *K8sKapenterProvider) _removeNode(lloger hclog.Logger, instncesIds []string) error {
+// _removeNode returns results by instance id, on context cancelation all not yet removed instances reported as retryable failures
+func (p *K8sKapenterProvider) _removeNode(_ctx context.Context, lloger hclog.Logger, instncesIds []string) map[string]*RemoveNodeResult {
+	lresults := map[string]*RemoveNodeResult{}
+
 	for i := 0; i < len(instncesIds); i += 20 {
 		instncesIdsBatch := instncesIds[i:Min(i+20, len(instncesIds))]
 
@@ -197,35 +212,57 @@ func (p *K8sKapenterProvider) _removeNode(lloger hclog.Logger, instncesIds []str
 		// потому как удалить срузу пачку иснтансов из стейта до удаления, выглядит как то ненадежно, по одному то тоже не очень,
 		//но для этого провайдера это не страшно, так как инстанс поднимется в любом случае
 		p.lock.Lock()
-		for _, linstanceId := range instncesIds {
+		for _, linstanceId := range instncesIdsBatch {
 			delete(p.state, linstanceId)
 		}
 		p.lock.Unlock()
 
 		for {
-			lerr := p.plugin.RemoveInstances(p.name, instncesIdsBatch)
+			lerr := p.plugin.RemoveInstances(_ctx, p.name, instncesIdsBatch)
 			if lerr == nil {
 				break
 			}
 
 			lloger.Error(fmt.Sprintf("failed to remove instanses by karpenter due: %s", lerr))
-			time.Sleep(10 * time.Second)
+			if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+				for _, linstanceId := range instncesIds[i:] {
+					lresults[linstanceId] = &RemoveNodeResult{Status: RemoveNodeStatusFailedRetryable, Reason: fmt.Errorf("can't remove instances due: %s", lerr)}
+				}
+
+				return lresults
+			}
+		}
+
+		for _, linstanceId := range instncesIdsBatch {
+			lresults[linstanceId] = &RemoveNodeResult{Status: RemoveNodeStatusRemoved}
 		}
 	}
 
-	return nil
+	return lresults
 }
 
-func (p *K8sKapenterProvider) RemoveNode(_nomadNodes []*nomad.Node) error {
+func (p *K8sKapenterProvider) RemoveNode(_ctx context.Context, _nomadNodes []*nomad.Node) RemoveNodeResults {
 	lloger := p.logger.Named("RemoveNode")
+	lresults := RemoveNodeResults{}
+	lnodesByInstances := map[string]string{}
 	var instncesIds []string
 
 	for _, lnode := range _nomadNodes {
-		instanceId := lnode.Attributes["unique.platform.aws.instance-id"]
+		instanceId, lok := lnode.Attributes["unique.platform.aws.instance-id"]
+		if !lok {
+			lresults[lnode.ID] = &RemoveNodeResult{Status: RemoveNodeStatusFailedPermanent, Reason: fmt.Errorf("node have no aws instance-id attribute")}
+			continue
+		}
+
+		lnodesByInstances[instanceId] = lnode.ID
 		instncesIds = append(instncesIds, instanceId)
 	}
 
-	return p._removeNode(lloger, instncesIds)
+	for linstanceId, lresult := range p._removeNode(_ctx, lloger, instncesIds) {
+		lresults[lnodesByInstances[linstanceId]] = lresult
+	}
+
+	return lresults
 }
 
 func (p *K8sKapenterProvider) UpdateNode(_ctx context.Context, _nodes []*structs.Node, _totalcount int32) error {
@@ -253,7 +290,7 @@ func (p *K8sKapenterProvider) UpdateNode(_ctx context.Context, _nodes []*structs
 
 	if len(instancetoremove) > 0 {
 		lloger.Warn(fmt.Sprintf("pool reported about differense in nodes %d(my) -> %d(pool oppinion), so, remove unexisten", lmynodescount, len(_nodes)))
-		p._removeNode(lloger, instancetoremove)
+		p._removeNode(_ctx, lloger, instancetoremove)
 		lmynodescount -= len(instancetoremove)
 	}
 
@@ -262,14 +299,14 @@ func (p *K8sKapenterProvider) UpdateNode(_ctx context.Context, _nodes []*structs
 
 	var laditinc int32 = 0
 	for _, linc := range p.incephemeral {
-		laditinc += linc
+		laditinc += linc.Count
 	}
 
 	inccount := _totalcount - int32(lmynodescount) - laditinc
 
 	if inccount > 0 {
 		linckey := generateRandomString(19)
-		p.incephemeral[linckey] = inccount
+		p.incephemeral[linckey] = &karpenterIncEphemeral{Count: inccount, Time: time.Now()}
 
 		go func(_ctx context.Context, _inccount int32, _p *K8sKapenterProvider) {
 			for {
@@ -286,6 +323,13 @@ func (p *K8sKapenterProvider) UpdateNode(_ctx context.Context, _nodes []*structs
 					lloger.Error(fmt.Sprintf("can't set karpenter disiresize to: %d(inc: %d), add only: %d due: %s", _totalcount, _inccount, 0, lerr))
 				} else {
 					lloger.Error(fmt.Sprintf("can't set karpenter disiresize to: %d(inc: %d), add only: %d due: %s", _totalcount, _inccount, len(instances), lreason))
+
+					if lreason != "" {
+						_p.lock.Lock()
+						_p.lastAddFailure = lreason
+						_p.lastAddFailureTime = time.Now()
+						_p.lock.Unlock()
+					}
 				}
 
 				time.Sleep(10 * time.Second)
@@ -304,3 +348,52 @@ func (p *K8sKapenterProvider) UpdateNode(_ctx context.Context, _nodes []*structs
 
 	return nil
 }
+
+// InsufficientCapacity reports reason why karpenter added less instances than requested
+func (p *K8sKapenterProvider) InsufficientCapacity(_ctx context.Context, _since time.Time) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.lastAddFailureTime.After(_since) {
+		return p.lastAddFailure, nil
+	}
+
+	return "", nil
+}
+
+func (p *K8sKapenterProvider) SaveState() ([]byte, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return json.Marshal(p.incephemeral)
+}
+
+func (p *K8sKapenterProvider) RestoreState(_state []byte) error {
+	lincephemeral := map[string]*karpenterIncEphemeral{}
+	lerr := json.Unmarshal(_state, &lincephemeral)
+	if lerr != nil {
+		return fmt.Errorf("can't decode state due: %s", lerr)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for linckey, linc := range lincephemeral {
+		lttl := cKarpenterRestoredIncTTL - time.Since(linc.Time)
+		if lttl <= 0 {
+			continue
+		}
+
+		p.incephemeral[linckey] = linc
+		p.logger.Info(fmt.Sprintf("restored increment %s on %d instances, it will be forgotten after %s", linckey, linc.Count, lttl))
+
+		linckey := linckey
+		time.AfterFunc(lttl, func() {
+			p.lock.Lock()
+			delete(p.incephemeral, linckey)
+			p.lock.Unlock()
+		})
+	}
+
+	return nil
+}
@@ -8,6 +8,26 @@ import (
 	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider/karpenterprovidergrpc"
 )
 
+func init() {
+	RegisterProvider("karpenter", &ParamSchema{
+		Type:     ParamTypeMap,
+		Required: true,
+		Fields: map[string]*ParamSchema{
+			"name":           {Type: ParamTypeString, Required: true},
+			"freqPerCpuCore": {Type: ParamTypeInt, Required: true},
+			"ami":            {Type: ParamTypeMap},
+			"securitygroups": {Type: ParamTypeMap},
+			"subnets":        {Type: ParamTypeMap},
+			"profile":        {Type: ParamTypeString},
+			"launchtemplate": {Type: ParamTypeString},
+			"reqs":           {Type: ParamTypeList, Required: true},
+		},
+	}, Createkarpenterprovider)
+	RegisterProviderIdentity("karpenter", func(_params interface{}) string {
+		return fmt.Sprintf("karpenter %v", _params.(map[string]interface{})["name"])
+	})
+}
+
 func Createkarpenterprovider(_params interface{}, _res *K8sKapenterProviderResources) (INodeProvider, error) {
 	params, lok := _params.(map[string]interface{})
 	if !lok {
@@ -27,7 +47,7 @@ func Createkarpenterprovider(_params interface{}, _res *K8sKapenterProviderResou
 		argValues = append(argValues, reflect.ValueOf(lname))
 	}
 
-	if lfreqPerCpuCoreIntf, lok := params["freqPerCpuCore"]; _res != nil && !lok {
+	if lfreqPerCpuCoreIntf, lok := params["freqPerCpuCore"]; !lok {
 		return nil, fmt.Errorf("params have no freqPerCpuCore attribute")
 	} else {
 		lfreqPerCpuCore, lerr := cast.ToIntE(lfreqPerCpuCoreIntf)
@@ -35,6 +55,10 @@ func Createkarpenterprovider(_params interface{}, _res *K8sKapenterProviderResou
 			return nil, fmt.Errorf("param freqPerCpuCore of wrong type")
 		}
 
+		if lfreqPerCpuCore <= 0 {
+			return nil, fmt.Errorf("param freqPerCpuCore must be positive")
+		}
+
 		if _res != nil {
 			_res.Cpu /= lfreqPerCpuCore
 		}
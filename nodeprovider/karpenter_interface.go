@@ -10,9 +10,9 @@ import (
 )
 
 type K8sKapenterProviderPluginInterface interface {
-	ListInstances(string) ([]string, error)
+	ListInstances(context.Context, string) ([]string, error)
 	AddInstances(context.Context, string, int, *karpenterprovidergrpc.AddInstancesSpec) ([]string, string, error)
-	RemoveInstances(string, []string) error
+	RemoveInstances(context.Context, string, []string) error
 }
 
 type K8sKapenterProviderPlugin struct {
@@ -35,8 +35,8 @@ type K8sKapenterProviderClient struct {
 	client karpenterprovidergrpc.KarpenterServiceClient
 }
 
-func (k *K8sKapenterProviderClient) ListInstances(_poolName string) ([]string, error) {
-	resp, lerr := k.client.ListInstances(context.Background(), &karpenterprovidergrpc.ListInstancesRequest{
+func (k *K8sKapenterProviderClient) ListInstances(_ctx context.Context, _poolName string) ([]string, error) {
+	resp, lerr := k.client.ListInstances(_ctx, &karpenterprovidergrpc.ListInstancesRequest{
 		PoolName: _poolName,
 	})
 	if lerr != nil {
@@ -59,8 +59,8 @@ func (k *K8sKapenterProviderClient) AddInstances(_ctx context.Context, _poolName
 	return lresp.Instanseids, lresp.Reason, nil
 }
 
-func (k *K8sKapenterProviderClient) RemoveInstances(_poolName string, _instanses []string) error {
-	_, lerr := k.client.RemoveInstances(context.Background(), &karpenterprovidergrpc.DeleteInstancesRequest{
+func (k *K8sKapenterProviderClient) RemoveInstances(_ctx context.Context, _poolName string, _instanses []string) error {
+	_, lerr := k.client.RemoveInstances(_ctx, &karpenterprovidergrpc.DeleteInstancesRequest{
 		PoolName:    _poolName,
 		Instanseids: _instanses,
 	})
@@ -3,7 +3,9 @@ package nodeprovider
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider/karpenterprovidergrpc"
@@ -23,3 +25,76 @@ func TestListInstances(t *testing.T) {
 
 	t.Logf("instances: %v", linstancesresp.Instanseids)
 }
+
+func TestK8sKapenterProviderStateRestore(t *testing.T) {
+	lsaved := &K8sKapenterProvider{
+		logger: hclog.L(),
+		incephemeral: map[string]*karpenterIncEphemeral{
+			"fresh": {Count: 3, Time: time.Now()},
+			"stale": {Count: 5, Time: time.Now().Add(-2 * cKarpenterRestoredIncTTL)},
+		},
+	}
+
+	lstate, lerr := lsaved.SaveState()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lrestored := &K8sKapenterProvider{logger: hclog.L(), incephemeral: map[string]*karpenterIncEphemeral{}}
+	lerr = lrestored.RestoreState(lstate)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if len(lrestored.incephemeral) != 1 || lrestored.incephemeral["fresh"] == nil || lrestored.incephemeral["fresh"].Count != 3 {
+		t.Fatalf("only fresh increment must be restored, got: %v", lrestored.incephemeral)
+	}
+}
+
+type noCapacityKarpenterPlugin struct{}
+
+func (p *noCapacityKarpenterPlugin) ListInstances(_ctx context.Context, _poolName string) ([]string, error) {
+	return nil, nil
+}
+
+func (p *noCapacityKarpenterPlugin) AddInstances(_ctx context.Context, _poolName string, _count int, _spec *karpenterprovidergrpc.AddInstancesSpec) ([]string, string, error) {
+	return nil, "InsufficientInstanceCapacity", nil
+}
+
+func (p *noCapacityKarpenterPlugin) RemoveInstances(_ctx context.Context, _poolName string, _instanses []string) error {
+	return nil
+}
+
+func TestK8sKapenterProviderInsufficientCapacity(t *testing.T) {
+	lprovider := &K8sKapenterProvider{
+		logger:       hclog.L(),
+		plugin:       &noCapacityKarpenterPlugin{},
+		state:        map[string]bool{},
+		incephemeral: map[string]*karpenterIncEphemeral{},
+	}
+
+	lsince := time.Now()
+	lctx, lcancel := context.WithCancel(context.Background())
+	defer lcancel()
+
+	lerr := lprovider.UpdateNode(lctx, nil, 2)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	for li := 0; li < 100; li++ {
+		lreason, _ := lprovider.InsufficientCapacity(context.Background(), lsince)
+		if lreason == "InsufficientInstanceCapacity" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if lreason, _ := lprovider.InsufficientCapacity(context.Background(), lsince); lreason != "InsufficientInstanceCapacity" {
+		t.Fatalf("wrong insufficient capacity reason: %q", lreason)
+	}
+
+	if lreason, _ := lprovider.InsufficientCapacity(context.Background(), time.Now()); lreason != "" {
+		t.Fatalf("failures before since must not be reported: %q", lreason)
+	}
+}
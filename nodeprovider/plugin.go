@@ -0,0 +1,212 @@
+package nodeprovider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider/pluginprovidergrpc"
+)
+
+type nodeProviderPluginClients struct {
+	lock    sync.Mutex
+	clients map[string]plugin.ClientProtocol
+}
+
+// one plugin process per binary(and its args), it can serve any amount of pools
+var gNodeProviderPluginClients *nodeProviderPluginClients = &nodeProviderPluginClients{clients: map[string]plugin.ClientProtocol{}}
+
+func getNodeProviderPluginClient(_path string, _args []string) (plugin.ClientProtocol, error) {
+	if !filepath.IsAbs(_path) {
+		ex, lerr := os.Executable()
+		if lerr != nil {
+			return nil, lerr
+		}
+
+		_path = filepath.Join(filepath.Dir(ex), _path)
+	}
+
+	lkey := strings.Join(append([]string{_path}, _args...), " ")
+
+	gNodeProviderPluginClients.lock.Lock()
+	defer gNodeProviderPluginClients.lock.Unlock()
+
+	if rpcClient, lok := gNodeProviderPluginClients.clients[lkey]; lok {
+		return rpcClient, nil
+	}
+
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig: NodeProviderPluginHandshake,
+		Plugins: map[string]plugin.Plugin{
+			"nodeprovider": &NodeProviderPlugin{},
+		},
+		Cmd: exec.Command(_path, _args...),
+		AllowedProtocols: []plugin.Protocol{
+			plugin.ProtocolGRPC,
+		},
+		Logger: hclog.L().Named("nodeprovider_plugin").With("plugin", filepath.Base(_path)),
+	})
+
+	rpcClient, lerr := client.Client()
+	if lerr != nil {
+		client.Kill()
+		return nil, lerr
+	}
+
+	gNodeProviderPluginClients.clients[lkey] = rpcClient
+	return rpcClient, nil
+}
+
+func nomadNodeToPluginNode(_nomadNode *nomad.Node) *pluginprovidergrpc.Node {
+	return &pluginprovidergrpc.Node{
+		Id:         _nomadNode.ID,
+		Name:       _nomadNode.Name,
+		Datacenter: _nomadNode.Datacenter,
+		NodeClass:  _nomadNode.NodeClass,
+		Status:     _nomadNode.Status,
+		Attributes: _nomadNode.Attributes,
+		Meta:       _nomadNode.Meta,
+	}
+}
+
+func structsNodeToPluginNode(_node *structs.Node) *pluginprovidergrpc.Node {
+	return &pluginprovidergrpc.Node{
+		Id:         _node.ID,
+		Name:       _node.Name,
+		Datacenter: _node.Datacenter,
+		NodeClass:  _node.NodeClass,
+		Status:     _node.Status,
+		Attributes: _node.Attributes,
+		Meta:       _node.Meta,
+	}
+}
+
+type PluginProvider struct {
+	logger hclog.Logger
+
+	plugin NodeProviderPluginInterface
+	name   string
+}
+
+func newPluginProvider(_name string, _plugin NodeProviderPluginInterface, _params []byte, _res *ProviderResources) (INodeProvider, error) {
+	lerr := _plugin.Configure(_name, _params, _res)
+	if lerr != nil {
+		return nil, fmt.Errorf("can't configure plugin due: %s", lerr)
+	}
+
+	linstances, ldesiredCount, lerr := _plugin.ListNodes(context.TODO(), _name)
+	if lerr != nil {
+		return nil, fmt.Errorf("can't list plugin nodes due: %s", lerr)
+	}
+
+	llogger := hclog.L().Named("PluginProvider").With("name", _name)
+	llogger.Info(fmt.Sprintf("plugin reported %d instances, desired count: %d", len(linstances), ldesiredCount))
+
+	return &PluginProvider{
+		logger: llogger,
+		plugin: _plugin,
+		name:   _name,
+	}, nil
+}
+
+func NewPluginProvider(_name string, _path string, _args []string, _params []byte, _res *ProviderResources) (INodeProvider, error) {
+	rpcClient, lerr := getNodeProviderPluginClient(_path, _args)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	raw, lerr := rpcClient.Dispense("nodeprovider")
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return newPluginProvider(_name, raw.(NodeProviderPluginInterface), _params, _res)
+}
+
+func (p *PluginProvider) ListNodes(_ctx context.Context) ([]string, int32, error) {
+	return p.plugin.ListNodes(_ctx, p.name)
+}
+
+func (p *PluginProvider) IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error) {
+	lloger := p.logger.Named("IsNodeExists")
+	lnode := nomadNodeToPluginNode(_nomadNode)
+
+	for {
+		lNodeExists, lerr := p.plugin.IsNodeExists(_ctx, p.name, lnode)
+		if lerr == nil {
+			return lNodeExists, nil
+		}
+
+		lloger.Error(fmt.Sprintf("can't check nomad node %s due: %s", _nomadNode.ID, lerr))
+		if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+			return false, fmt.Errorf("can't check nomad node %s due: %s", _nomadNode.ID, lerr)
+		}
+	}
+}
+
+func (p *PluginProvider) RemoveNode(_ctx context.Context, _nomadNodes []*nomad.Node) RemoveNodeResults {
+	lloger := p.logger.Named("RemoveNode")
+
+	lnodes := make([]*pluginprovidergrpc.Node, 0, len(_nomadNodes))
+	for _, lnomadNode := range _nomadNodes {
+		lnodes = append(lnodes, nomadNodeToPluginNode(lnomadNode))
+	}
+
+	var lpluginResults RemoveNodeResults
+	for {
+		var lerr error
+		lpluginResults, lerr = p.plugin.RemoveNode(_ctx, p.name, lnodes)
+		if lerr == nil {
+			break
+		}
+
+		lloger.Error(fmt.Sprintf("failed to remove nodes by plugin due: %s", lerr))
+		if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+			return NewRemoveNodeResults(_nomadNodes, RemoveNodeStatusFailedRetryable, fmt.Errorf("can't remove nodes due: %s", lerr))
+		}
+	}
+
+	lresults := RemoveNodeResults{}
+	for _, lnomadNode := range _nomadNodes {
+		if lresult, lok := lpluginResults[lnomadNode.ID]; lok {
+			lresults[lnomadNode.ID] = lresult
+		} else {
+			lresults[lnomadNode.ID] = &RemoveNodeResult{Status: RemoveNodeStatusFailedRetryable, Reason: fmt.Errorf("plugin reported nothing about node")}
+		}
+	}
+
+	return lresults
+}
+
+func (p *PluginProvider) UpdateNode(_ctx context.Context, _nodes []*structs.Node, _totalcount int32) error {
+	lloger := p.logger.Named("UpdateNode")
+
+	lnodes := make([]*pluginprovidergrpc.Node, 0, len(_nodes))
+	for _, lnode := range _nodes {
+		lnodes = append(lnodes, structsNodeToPluginNode(lnode))
+	}
+
+	for {
+		lerr := p.plugin.UpdateNode(_ctx, p.name, lnodes, _totalcount)
+		if lerr == nil {
+			lloger.Info(fmt.Sprintf("Set plugin desired size to: %d", _totalcount))
+			break
+		}
+
+		lloger.Error(fmt.Sprintf("can't set plugin desired size to: %d due: %s", _totalcount, lerr))
+		if lerr := sleepWithContext(_ctx, 10*time.Second); lerr != nil {
+			return fmt.Errorf("can't set plugin desired size to: %d due: %s", _totalcount, lerr)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package nodeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cast"
+)
+
+func init() {
+	RegisterProvider("plugin", &ParamSchema{
+		Type:     ParamTypeMap,
+		Required: true,
+		Fields: map[string]*ParamSchema{
+			"name":   {Type: ParamTypeString, Required: true},
+			"path":   {Type: ParamTypeString, Required: true},
+			"args":   {Type: ParamTypeList},
+			"config": {Type: ParamTypeAny},
+		},
+	}, Createpluginprovider)
+}
+
+func Createpluginprovider(_params interface{}, _res *ProviderResources) (INodeProvider, error) {
+	params, lok := _params.(map[string]interface{})
+	if !lok {
+		return nil, fmt.Errorf("params is not map[string]interface{}")
+	}
+
+	lname, lerr := cast.ToStringE(params["name"])
+	if lerr != nil {
+		return nil, fmt.Errorf("param name of wrong type")
+	}
+
+	lpath, lerr := cast.ToStringE(params["path"])
+	if lerr != nil {
+		return nil, fmt.Errorf("param path of wrong type")
+	}
+
+	var largs []string
+	if largsIntf, lok := params["args"]; lok {
+		largs, lerr = cast.ToStringSliceE(largsIntf)
+		if lerr != nil {
+			return nil, fmt.Errorf("param args of wrong type")
+		}
+	}
+
+	// config is opaque for scaler, plugin receives it as json
+	var lconfig []byte
+	if lconfigIntf, lok := params["config"]; lok {
+		lconfig, lerr = json.Marshal(lconfigIntf)
+		if lerr != nil {
+			return nil, fmt.Errorf("can't encode param config due: %s", lerr)
+		}
+	}
+
+	lprovider, lerr := NewPluginProvider(lname, lpath, largs, lconfig, _res)
+	if lerr != nil {
+		return nil, fmt.Errorf("plugin provider returned error: %s", lerr)
+	}
+
+	return lprovider, nil
+}
@@ -0,0 +1,240 @@
+package nodeprovider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider/pluginprovidergrpc"
+	"google.golang.org/grpc"
+)
+
+// NodeProviderPluginInterface must be implemented by external node provider plugin, all calls carry pool name,
+// so one plugin process can serve several pools
+type NodeProviderPluginInterface interface {
+	Configure(_poolName string, _params []byte, _res *ProviderResources) error
+	ListNodes(_ctx context.Context, _poolName string) ([]string, int32, error)
+	IsNodeExists(_ctx context.Context, _poolName string, _node *pluginprovidergrpc.Node) (bool, error)
+	UpdateNode(_ctx context.Context, _poolName string, _nodes []*pluginprovidergrpc.Node, _totalcount int32) error
+	RemoveNode(_ctx context.Context, _poolName string, _nodes []*pluginprovidergrpc.Node) (RemoveNodeResults, error)
+}
+
+// removeNodeStatusToPlugin converts status of node removal to its value in plugin protocol
+func removeNodeStatusToPlugin(_status RemoveNodeStatus) pluginprovidergrpc.RemoveNodeStatus {
+	switch _status {
+	case RemoveNodeStatusRemoved:
+		return pluginprovidergrpc.RemoveNodeStatus_REMOVED
+	case RemoveNodeStatusNotFound:
+		return pluginprovidergrpc.RemoveNodeStatus_NOT_FOUND
+	case RemoveNodeStatusFailedPermanent:
+		return pluginprovidergrpc.RemoveNodeStatus_FAILED_PERMANENT
+	default:
+		return pluginprovidergrpc.RemoveNodeStatus_FAILED_RETRYABLE
+	}
+}
+
+// removeNodeStatusFromPlugin converts status of node removal reported by plugin, false if plugin left status unset
+// or reported unknown one, then node must not be considered removed
+func removeNodeStatusFromPlugin(_status pluginprovidergrpc.RemoveNodeStatus) (RemoveNodeStatus, bool) {
+	switch _status {
+	case pluginprovidergrpc.RemoveNodeStatus_REMOVED:
+		return RemoveNodeStatusRemoved, true
+	case pluginprovidergrpc.RemoveNodeStatus_NOT_FOUND:
+		return RemoveNodeStatusNotFound, true
+	case pluginprovidergrpc.RemoveNodeStatus_FAILED_RETRYABLE:
+		return RemoveNodeStatusFailedRetryable, true
+	case pluginprovidergrpc.RemoveNodeStatus_FAILED_PERMANENT:
+		return RemoveNodeStatusFailedPermanent, true
+	default:
+		return RemoveNodeStatusFailedRetryable, false
+	}
+}
+
+var NodeProviderPluginHandshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "NOMAD_ONDEMAND_SCALER_PLUGIN",
+	MagicCookieValue: "nodeprovider",
+}
+
+type NodeProviderPlugin struct {
+	plugin.Plugin
+
+	Impl NodeProviderPluginInterface
+}
+
+func (p *NodeProviderPlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	pluginprovidergrpc.RegisterNodeProviderServiceServer(s, &NodeProviderServer{impl: p.Impl})
+	return nil
+}
+
+func (p *NodeProviderPlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &NodeProviderClient{
+		client: pluginprovidergrpc.NewNodeProviderServiceClient(c),
+	}, nil
+}
+
+// ServeNodeProviderPlugin must be called from main of plugin binary
+func ServeNodeProviderPlugin(_impl NodeProviderPluginInterface) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: NodeProviderPluginHandshake,
+		Plugins: map[string]plugin.Plugin{
+			"nodeprovider": &NodeProviderPlugin{Impl: _impl},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+}
+
+// ----------------------------------------------------------------------------
+type NodeProviderClient struct {
+	client pluginprovidergrpc.NodeProviderServiceClient
+}
+
+func (k *NodeProviderClient) Configure(_poolName string, _params []byte, _res *ProviderResources) error {
+	lreq := &pluginprovidergrpc.ConfigureRequest{
+		PoolName: _poolName,
+		Params:   _params,
+	}
+
+	if _res != nil {
+		lreq.Resources = &pluginprovidergrpc.Resources{
+			Cpu:    int32(_res.Cpu),
+			MemMB:  int32(_res.MemMB),
+			DiskMB: int32(_res.DiskMB),
+		}
+	}
+
+	_, lerr := k.client.Configure(context.Background(), lreq)
+	return lerr
+}
+
+func (k *NodeProviderClient) ListNodes(_ctx context.Context, _poolName string) ([]string, int32, error) {
+	lresp, lerr := k.client.ListNodes(_ctx, &pluginprovidergrpc.ListNodesRequest{
+		PoolName: _poolName,
+	})
+	if lerr != nil {
+		return nil, 0, lerr
+	}
+
+	return lresp.Instanceids, lresp.Desiredcount, nil
+}
+
+func (k *NodeProviderClient) IsNodeExists(_ctx context.Context, _poolName string, _node *pluginprovidergrpc.Node) (bool, error) {
+	lresp, lerr := k.client.IsNodeExists(_ctx, &pluginprovidergrpc.IsNodeExistsRequest{
+		PoolName: _poolName,
+		Node:     _node,
+	})
+	if lerr != nil {
+		return false, lerr
+	}
+
+	return lresp.Exists, nil
+}
+
+func (k *NodeProviderClient) UpdateNode(_ctx context.Context, _poolName string, _nodes []*pluginprovidergrpc.Node, _totalcount int32) error {
+	_, lerr := k.client.UpdateNode(_ctx, &pluginprovidergrpc.UpdateNodeRequest{
+		PoolName:   _poolName,
+		Nodes:      _nodes,
+		Totalcount: _totalcount,
+	})
+
+	return lerr
+}
+
+func (k *NodeProviderClient) RemoveNode(_ctx context.Context, _poolName string, _nodes []*pluginprovidergrpc.Node) (RemoveNodeResults, error) {
+	lresp, lerr := k.client.RemoveNode(_ctx, &pluginprovidergrpc.RemoveNodeRequest{
+		PoolName: _poolName,
+		Nodes:    _nodes,
+	})
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	lresults := RemoveNodeResults{}
+	for _, lresult := range lresp.Results {
+		lstatus, lok := removeNodeStatusFromPlugin(lresult.Status)
+		lremoveResult := &RemoveNodeResult{Status: lstatus}
+		if !lok {
+			lremoveResult.Reason = fmt.Errorf("plugin reported %s status of node removal: %s", lresult.Status, lresult.Reason)
+		} else if lresult.Reason != "" {
+			lremoveResult.Reason = fmt.Errorf("%s", lresult.Reason)
+		}
+
+		lresults[lresult.NodeId] = lremoveResult
+	}
+
+	return lresults, nil
+}
+
+// ----------------------------------------------------------------------------
+type NodeProviderServer struct {
+	pluginprovidergrpc.UnimplementedNodeProviderServiceServer
+
+	impl NodeProviderPluginInterface
+}
+
+func (s *NodeProviderServer) Configure(_ctx context.Context, _req *pluginprovidergrpc.ConfigureRequest) (*pluginprovidergrpc.ConfigureResponse, error) {
+	var lres *ProviderResources
+	if _req.Resources != nil {
+		lres = &ProviderResources{
+			Cpu:    int(_req.Resources.Cpu),
+			MemMB:  int(_req.Resources.MemMB),
+			DiskMB: int(_req.Resources.DiskMB),
+		}
+	}
+
+	lerr := s.impl.Configure(_req.PoolName, _req.Params, lres)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return &pluginprovidergrpc.ConfigureResponse{}, nil
+}
+
+func (s *NodeProviderServer) ListNodes(_ctx context.Context, _req *pluginprovidergrpc.ListNodesRequest) (*pluginprovidergrpc.ListNodesResponse, error) {
+	linstances, ldesiredCount, lerr := s.impl.ListNodes(_ctx, _req.PoolName)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return &pluginprovidergrpc.ListNodesResponse{Instanceids: linstances, Desiredcount: ldesiredCount}, nil
+}
+
+func (s *NodeProviderServer) IsNodeExists(_ctx context.Context, _req *pluginprovidergrpc.IsNodeExistsRequest) (*pluginprovidergrpc.IsNodeExistsResponse, error) {
+	lexists, lerr := s.impl.IsNodeExists(_ctx, _req.PoolName, _req.Node)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return &pluginprovidergrpc.IsNodeExistsResponse{Exists: lexists}, nil
+}
+
+func (s *NodeProviderServer) UpdateNode(_ctx context.Context, _req *pluginprovidergrpc.UpdateNodeRequest) (*pluginprovidergrpc.UpdateNodeResponse, error) {
+	lerr := s.impl.UpdateNode(_ctx, _req.PoolName, _req.Nodes, _req.Totalcount)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return &pluginprovidergrpc.UpdateNodeResponse{}, nil
+}
+
+func (s *NodeProviderServer) RemoveNode(_ctx context.Context, _req *pluginprovidergrpc.RemoveNodeRequest) (*pluginprovidergrpc.RemoveNodeResponse, error) {
+	lresults, lerr := s.impl.RemoveNode(_ctx, _req.PoolName, _req.Nodes)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	lresp := &pluginprovidergrpc.RemoveNodeResponse{}
+	for lnodeId, lresult := range lresults {
+		lpluginResult := &pluginprovidergrpc.RemoveNodeResult{
+			NodeId: lnodeId,
+			Status: removeNodeStatusToPlugin(lresult.Status),
+		}
+		if lresult.Reason != nil {
+			lpluginResult.Reason = lresult.Reason.Error()
+		}
+
+		lresp.Results = append(lresp.Results, lpluginResult)
+	}
+
+	return lresp, nil
+}
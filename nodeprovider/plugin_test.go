@@ -0,0 +1,119 @@
+package nodeprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-plugin"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider/pluginprovidergrpc"
+)
+
+type testNodeProviderPlugin struct {
+	params     map[string]interface{}
+	res        *ProviderResources
+	instances  map[string]struct{}
+	totalcount int32
+}
+
+func (p *testNodeProviderPlugin) Configure(_poolName string, _params []byte, _res *ProviderResources) error {
+	p.res = _res
+	return json.Unmarshal(_params, &p.params)
+}
+
+func (p *testNodeProviderPlugin) ListNodes(_ctx context.Context, _poolName string) ([]string, int32, error) {
+	linstances := []string{}
+	for linstanceId := range p.instances {
+		linstances = append(linstances, linstanceId)
+	}
+
+	return linstances, p.totalcount, nil
+}
+
+func (p *testNodeProviderPlugin) IsNodeExists(_ctx context.Context, _poolName string, _node *pluginprovidergrpc.Node) (bool, error) {
+	_, lok := p.instances[_node.Attributes["unique.platform.gce.id"]]
+	return lok, nil
+}
+
+func (p *testNodeProviderPlugin) UpdateNode(_ctx context.Context, _poolName string, _nodes []*pluginprovidergrpc.Node, _totalcount int32) error {
+	p.totalcount = _totalcount
+	return nil
+}
+
+func (p *testNodeProviderPlugin) RemoveNode(_ctx context.Context, _poolName string, _nodes []*pluginprovidergrpc.Node) (RemoveNodeResults, error) {
+	lresults := RemoveNodeResults{}
+	for _, lnode := range _nodes {
+		linstanceId := lnode.Attributes["unique.platform.gce.id"]
+		if _, lok := p.instances[linstanceId]; !lok {
+			lresults[lnode.Id] = &RemoveNodeResult{Status: RemoveNodeStatusNotFound, Reason: fmt.Errorf("no such instance %s", linstanceId)}
+			continue
+		}
+
+		delete(p.instances, linstanceId)
+		lresults[lnode.Id] = &RemoveNodeResult{Status: RemoveNodeStatusRemoved}
+	}
+
+	return lresults, nil
+}
+
+func TestPluginProvider(t *testing.T) {
+	limpl := &testNodeProviderPlugin{instances: map[string]struct{}{"gce-1": {}}}
+	client, _ := plugin.TestPluginGRPCConn(t, map[string]plugin.Plugin{
+		"nodeprovider": &NodeProviderPlugin{Impl: limpl},
+	})
+	defer client.Close()
+
+	raw, lerr := client.Dispense("nodeprovider")
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lprovider, lerr := newPluginProvider("workers", raw.(NodeProviderPluginInterface), []byte(`{"mig":"workers-a"}`), &ProviderResources{Cpu: 2000})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if limpl.params["mig"] != "workers-a" || limpl.res.Cpu != 2000 {
+		t.Fatalf("plugin configured with wrong params: %v, %v", limpl.params, limpl.res)
+	}
+
+	lnomadNode := &nomad.Node{ID: "node-1", Attributes: map[string]string{"unique.platform.gce.id": "gce-1"}}
+	if lexists, lerr := lprovider.IsNodeExists(context.TODO(), lnomadNode); lerr != nil || !lexists {
+		t.Fatalf("node must exists in plugin(err: %v)", lerr)
+	}
+
+	lerr = lprovider.UpdateNode(context.TODO(), []*structs.Node{}, 3)
+	if lerr != nil || limpl.totalcount != 3 {
+		t.Fatalf("wrong update result: %v, totalcount: %d", lerr, limpl.totalcount)
+	}
+
+	lunknownNode := &nomad.Node{ID: "node-2", Attributes: map[string]string{"unique.platform.gce.id": "gce-2"}}
+	lresults := lprovider.RemoveNode(context.TODO(), []*nomad.Node{lnomadNode, lunknownNode})
+	if lresults["node-1"].Status != RemoveNodeStatusRemoved {
+		t.Fatalf("node-1 must be removed, got: %s", lresults["node-1"])
+	}
+
+	if lresults["node-2"].Status != RemoveNodeStatusNotFound || lresults["node-2"].Reason == nil {
+		t.Fatalf("node-2 must be not found with reason, got: %s", lresults["node-2"])
+	}
+
+	if lexists, _ := lprovider.IsNodeExists(context.TODO(), lnomadNode); lexists {
+		t.Fatalf("node must be removed from plugin")
+	}
+}
+
+func TestPluginRemoveNodeStatus(t *testing.T) {
+	for _, lstatus := range []RemoveNodeStatus{RemoveNodeStatusRemoved, RemoveNodeStatusNotFound, RemoveNodeStatusFailedRetryable, RemoveNodeStatusFailedPermanent} {
+		if lback, lok := removeNodeStatusFromPlugin(removeNodeStatusToPlugin(lstatus)); !lok || lback != lstatus {
+			t.Fatalf("status %s must survive plugin protocol, got %s", lstatus, lback)
+		}
+	}
+
+	// плагин, не выставивший статус, не должен выдавать ноду за удаленную
+	if lstatus, lok := removeNodeStatusFromPlugin(pluginprovidergrpc.RemoveNodeStatus_UNSPECIFIED); lok || lstatus != RemoveNodeStatusFailedRetryable {
+		t.Fatalf("unset status must be retryable failure, got %s", lstatus)
+	}
+}
@@ -0,0 +1,257 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.3
+// source: plugin.proto
+
+package pluginprovidergrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	NodeProviderService_Configure_FullMethodName    = "/pluginprovidergrpc.NodeProviderService/Configure"
+	NodeProviderService_ListNodes_FullMethodName    = "/pluginprovidergrpc.NodeProviderService/ListNodes"
+	NodeProviderService_IsNodeExists_FullMethodName = "/pluginprovidergrpc.NodeProviderService/IsNodeExists"
+	NodeProviderService_UpdateNode_FullMethodName   = "/pluginprovidergrpc.NodeProviderService/UpdateNode"
+	NodeProviderService_RemoveNode_FullMethodName   = "/pluginprovidergrpc.NodeProviderService/RemoveNode"
+)
+
+// NodeProviderServiceClient is the client API for NodeProviderService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type NodeProviderServiceClient interface {
+	Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error)
+	ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error)
+	IsNodeExists(ctx context.Context, in *IsNodeExistsRequest, opts ...grpc.CallOption) (*IsNodeExistsResponse, error)
+	UpdateNode(ctx context.Context, in *UpdateNodeRequest, opts ...grpc.CallOption) (*UpdateNodeResponse, error)
+	RemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*RemoveNodeResponse, error)
+}
+
+type nodeProviderServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNodeProviderServiceClient(cc grpc.ClientConnInterface) NodeProviderServiceClient {
+	return &nodeProviderServiceClient{cc}
+}
+
+func (c *nodeProviderServiceClient) Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error) {
+	out := new(ConfigureResponse)
+	err := c.cc.Invoke(ctx, NodeProviderService_Configure_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeProviderServiceClient) ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error) {
+	out := new(ListNodesResponse)
+	err := c.cc.Invoke(ctx, NodeProviderService_ListNodes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeProviderServiceClient) IsNodeExists(ctx context.Context, in *IsNodeExistsRequest, opts ...grpc.CallOption) (*IsNodeExistsResponse, error) {
+	out := new(IsNodeExistsResponse)
+	err := c.cc.Invoke(ctx, NodeProviderService_IsNodeExists_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeProviderServiceClient) UpdateNode(ctx context.Context, in *UpdateNodeRequest, opts ...grpc.CallOption) (*UpdateNodeResponse, error) {
+	out := new(UpdateNodeResponse)
+	err := c.cc.Invoke(ctx, NodeProviderService_UpdateNode_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeProviderServiceClient) RemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*RemoveNodeResponse, error) {
+	out := new(RemoveNodeResponse)
+	err := c.cc.Invoke(ctx, NodeProviderService_RemoveNode_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NodeProviderServiceServer is the server API for NodeProviderService service.
+// All implementations must embed UnimplementedNodeProviderServiceServer
+// for forward compatibility
+type NodeProviderServiceServer interface {
+	Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error)
+	ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error)
+	IsNodeExists(context.Context, *IsNodeExistsRequest) (*IsNodeExistsResponse, error)
+	UpdateNode(context.Context, *UpdateNodeRequest) (*UpdateNodeResponse, error)
+	RemoveNode(context.Context, *RemoveNodeRequest) (*RemoveNodeResponse, error)
+	mustEmbedUnimplementedNodeProviderServiceServer()
+}
+
+// UnimplementedNodeProviderServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedNodeProviderServiceServer struct {
+}
+
+func (UnimplementedNodeProviderServiceServer) Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Configure not implemented")
+}
+func (UnimplementedNodeProviderServiceServer) ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNodes not implemented")
+}
+func (UnimplementedNodeProviderServiceServer) IsNodeExists(context.Context, *IsNodeExistsRequest) (*IsNodeExistsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IsNodeExists not implemented")
+}
+func (UnimplementedNodeProviderServiceServer) UpdateNode(context.Context, *UpdateNodeRequest) (*UpdateNodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateNode not implemented")
+}
+func (UnimplementedNodeProviderServiceServer) RemoveNode(context.Context, *RemoveNodeRequest) (*RemoveNodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveNode not implemented")
+}
+func (UnimplementedNodeProviderServiceServer) mustEmbedUnimplementedNodeProviderServiceServer() {}
+
+// UnsafeNodeProviderServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NodeProviderServiceServer will
+// result in compilation errors.
+type UnsafeNodeProviderServiceServer interface {
+	mustEmbedUnimplementedNodeProviderServiceServer()
+}
+
+func RegisterNodeProviderServiceServer(s grpc.ServiceRegistrar, srv NodeProviderServiceServer) {
+	s.RegisterService(&NodeProviderService_ServiceDesc, srv)
+}
+
+func _NodeProviderService_Configure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeProviderServiceServer).Configure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeProviderService_Configure_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeProviderServiceServer).Configure(ctx, req.(*ConfigureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeProviderService_ListNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeProviderServiceServer).ListNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeProviderService_ListNodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeProviderServiceServer).ListNodes(ctx, req.(*ListNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeProviderService_IsNodeExists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IsNodeExistsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeProviderServiceServer).IsNodeExists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeProviderService_IsNodeExists_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeProviderServiceServer).IsNodeExists(ctx, req.(*IsNodeExistsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeProviderService_UpdateNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeProviderServiceServer).UpdateNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeProviderService_UpdateNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeProviderServiceServer).UpdateNode(ctx, req.(*UpdateNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeProviderService_RemoveNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeProviderServiceServer).RemoveNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeProviderService_RemoveNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeProviderServiceServer).RemoveNode(ctx, req.(*RemoveNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// NodeProviderService_ServiceDesc is the grpc.ServiceDesc for NodeProviderService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NodeProviderService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pluginprovidergrpc.NodeProviderService",
+	HandlerType: (*NodeProviderServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Configure",
+			Handler:    _NodeProviderService_Configure_Handler,
+		},
+		{
+			MethodName: "ListNodes",
+			Handler:    _NodeProviderService_ListNodes_Handler,
+		},
+		{
+			MethodName: "IsNodeExists",
+			Handler:    _NodeProviderService_IsNodeExists_Handler,
+		},
+		{
+			MethodName: "UpdateNode",
+			Handler:    _NodeProviderService_UpdateNode_Handler,
+		},
+		{
+			MethodName: "RemoveNode",
+			Handler:    _NodeProviderService_RemoveNode_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "plugin.proto",
+}
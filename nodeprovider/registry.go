@@ -0,0 +1,222 @@
+package nodeprovider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type ParamType int
+
+const (
+	ParamTypeNone ParamType = iota
+	ParamTypeAny
+	ParamTypeString
+	ParamTypeInt
+	ParamTypeList
+	ParamTypeMap
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case ParamTypeNone:
+		return "none"
+	case ParamTypeAny:
+		return "any"
+	case ParamTypeString:
+		return "string"
+	case ParamTypeInt:
+		return "int"
+	case ParamTypeList:
+		return "list"
+	case ParamTypeMap:
+		return "map"
+	}
+
+	return "unknown"
+}
+
+// ParamSchema describes shape of provider params from pool yaml(after variantToTypes conversion), for
+// ParamTypeMap Fields describes known keys of map
+type ParamSchema struct {
+	Type     ParamType
+	Required bool
+	Fields   map[string]*ParamSchema
+}
+
+func (s *ParamSchema) Validate(_params interface{}) error {
+	return s.validate("params", _params)
+}
+
+func (s *ParamSchema) validate(_path string, _params interface{}) error {
+	if _params == nil {
+		if s.Required {
+			return fmt.Errorf("%s is required", _path)
+		}
+
+		return nil
+	}
+
+	switch s.Type {
+	case ParamTypeNone:
+		return fmt.Errorf("%s is not allowed", _path)
+
+	case ParamTypeAny:
+		return nil
+
+	case ParamTypeString:
+		if _, lok := _params.(string); !lok {
+			return fmt.Errorf("%s must be %s", _path, s.Type)
+		}
+
+	case ParamTypeInt:
+		if _, lok := _params.(int); !lok {
+			return fmt.Errorf("%s must be %s", _path, s.Type)
+		}
+
+	case ParamTypeList:
+		if _, lok := _params.([]interface{}); !lok {
+			return fmt.Errorf("%s must be %s", _path, s.Type)
+		}
+
+	case ParamTypeMap:
+		lparams, lok := _params.(map[string]interface{})
+		if !lok {
+			return fmt.Errorf("%s must be %s", _path, s.Type)
+		}
+
+		lfieldsNames := make([]string, 0, len(s.Fields))
+		for lfieldName := range s.Fields {
+			lfieldsNames = append(lfieldsNames, lfieldName)
+		}
+		sort.Strings(lfieldsNames)
+
+		for _, lfieldName := range lfieldsNames {
+			lerr := s.Fields[lfieldName].validate(_path+"."+lfieldName, lparams[lfieldName])
+			if lerr != nil {
+				return lerr
+			}
+		}
+	}
+
+	return nil
+}
+
+// ProviderResources is resources of one pool node, as they described in pool yaml
+type ProviderResources struct {
+	Cpu    int
+	MemMB  int
+	DiskMB int
+}
+
+type ProviderFactory func(_params interface{}, _res *ProviderResources) (INodeProvider, error)
+
+// ProviderIdentity returns what nodes of provider are, for example aws autoscale group name. Pools whose
+// providers have the same identity claim the same nodes
+type ProviderIdentity func(_params interface{}) string
+
+type providerRegistration struct {
+	schema   *ParamSchema
+	factory  ProviderFactory
+	identity ProviderIdentity
+}
+
+var gProvidersLock sync.RWMutex
+var gProviders map[string]*providerRegistration = map[string]*providerRegistration{}
+
+// RegisterProvider makes node provider available for pools by its name, usually called from init()
+func RegisterProvider(_name string, _schema *ParamSchema, _factory ProviderFactory) {
+	gProvidersLock.Lock()
+	defer gProvidersLock.Unlock()
+
+	if _, lok := gProviders[_name]; lok {
+		panic(fmt.Sprintf("node provider %s already registered", _name))
+	}
+
+	if _schema == nil {
+		_schema = &ParamSchema{Type: ParamTypeNone}
+	}
+
+	gProviders[_name] = &providerRegistration{
+		schema:  _schema,
+		factory: _factory,
+	}
+}
+
+// RegisterProviderIdentity is optional, it allows to detect pools that share the same nodes
+func RegisterProviderIdentity(_name string, _identity ProviderIdentity) {
+	gProvidersLock.Lock()
+	defer gProvidersLock.Unlock()
+
+	lregistration, lok := gProviders[_name]
+	if !lok {
+		panic(fmt.Sprintf("node provider %s is not registered", _name))
+	}
+
+	lregistration.identity = _identity
+}
+
+func ListProviders() []string {
+	gProvidersLock.RLock()
+	defer gProvidersLock.RUnlock()
+
+	lnames := make([]string, 0, len(gProviders))
+	for lname := range gProviders {
+		lnames = append(lnames, lname)
+	}
+	sort.Strings(lnames)
+
+	return lnames
+}
+
+func lookupProvider(_name string) (*providerRegistration, error) {
+	gProvidersLock.RLock()
+	lregistration, lok := gProviders[_name]
+	gProvidersLock.RUnlock()
+
+	if !lok {
+		return nil, fmt.Errorf("unknown node provider %q, valid providers: %s", _name, strings.Join(ListProviders(), ", "))
+	}
+
+	return lregistration, nil
+}
+
+func GetProviderSchema(_name string) (*ParamSchema, error) {
+	lregistration, lerr := lookupProvider(_name)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return lregistration.schema, nil
+}
+
+// GetProviderIdentity returns empty string if provider has no identity or params are wrong
+func GetProviderIdentity(_name string, _params interface{}) string {
+	lregistration, lerr := lookupProvider(_name)
+	if lerr != nil || lregistration.identity == nil || lregistration.schema.Validate(_params) != nil {
+		return ""
+	}
+
+	return lregistration.identity(_params)
+}
+
+func CreateProvider(_name string, _params interface{}, _res *ProviderResources) (INodeProvider, error) {
+	lregistration, lerr := lookupProvider(_name)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	lerr = lregistration.schema.Validate(_params)
+	if lerr != nil {
+		return nil, fmt.Errorf("wrong %s provider params: %s", _name, lerr)
+	}
+
+	var lres *ProviderResources
+	if _res != nil {
+		lrescopy := *_res
+		lres = &lrescopy
+	}
+
+	return lregistration.factory(_params, lres)
+}
@@ -0,0 +1,78 @@
+package nodeprovider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateProviderUnknownName(t *testing.T) {
+	_, lerr := CreateProvider("gcpmig", nil, nil)
+	if lerr == nil {
+		t.Fatalf("unknown provider must fail")
+	}
+
+	for _, lname := range []string{"anynode", "awsautoscale", "karpenter"} {
+		if !strings.Contains(lerr.Error(), lname) {
+			t.Fatalf("error must list valid provider %s, got: %s", lname, lerr)
+		}
+	}
+}
+
+func TestCreateProviderAnyNode(t *testing.T) {
+	lprovider, lerr := CreateProvider("anynode", nil, nil)
+	if lerr != nil {
+		t.Fatalf("can't create anynode provider due: %s", lerr)
+	}
+
+	if _, lok := lprovider.(*AnyNodeProvider); !lok {
+		t.Fatalf("wrong provider type: %T", lprovider)
+	}
+}
+
+func TestProviderSchemaValidate(t *testing.T) {
+	lschema, lerr := GetProviderSchema("karpenter")
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lerr = lschema.Validate(nil)
+	if lerr == nil {
+		t.Fatalf("karpenter params are required")
+	}
+
+	lerr = lschema.Validate(map[string]interface{}{"name": 10, "freqPerCpuCore": 2500, "reqs": []interface{}{}})
+	if lerr == nil || !strings.Contains(lerr.Error(), "params.name") {
+		t.Fatalf("wrong name type must fail, got: %v", lerr)
+	}
+
+	// без freqPerCpuCore фабрика не может пересчитать cpu пула в ядра
+	lerr = lschema.Validate(map[string]interface{}{"name": "sparkdriver", "reqs": []interface{}{}})
+	if lerr == nil || !strings.Contains(lerr.Error(), "freqPerCpuCore") {
+		t.Fatalf("missing freqPerCpuCore must fail, got: %v", lerr)
+	}
+
+	lerr = lschema.Validate(map[string]interface{}{"name": "sparkdriver", "freqPerCpuCore": 2500, "reqs": []interface{}{}})
+	if lerr != nil {
+		t.Fatalf("valid params must pass, got: %s", lerr)
+	}
+
+	lschema, _ = GetProviderSchema("awsautoscale")
+	lerr = lschema.Validate(map[string]interface{}{"name": "asg"})
+	if lerr == nil {
+		t.Fatalf("awsautoscale params must be list")
+	}
+}
+
+func TestGetProviderIdentity(t *testing.T) {
+	if lidentity := GetProviderIdentity("awsautoscale", []interface{}{"asg-a"}); lidentity != "asg asg-a" {
+		t.Fatalf("wrong awsautoscale identity: %q", lidentity)
+	}
+
+	if lidentity := GetProviderIdentity("karpenter", map[string]interface{}{"name": "spark", "freqPerCpuCore": 2500, "reqs": []interface{}{}}); lidentity != "karpenter spark" {
+		t.Fatalf("wrong karpenter identity: %q", lidentity)
+	}
+
+	if lidentity := GetProviderIdentity("awsautoscale", nil); lidentity != "" {
+		t.Fatalf("wrong params must give empty identity, got: %q", lidentity)
+	}
+}
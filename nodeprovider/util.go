@@ -1,6 +1,7 @@
 package nodeprovider
 
 import (
+	"context"
 	"math/rand"
 	"regexp"
 	"time"
@@ -76,3 +77,16 @@ func GetLastRegisterEvent(_events []*nomad.NodeEvent) *nomad.NodeEvent {
 
 	return llastregisterevnt
 }
+
+// sleepWithContext returns ctx error if context done before _d passed
+func sleepWithContext(_ctx context.Context, _d time.Duration) error {
+	ltimer := time.NewTimer(_d)
+	defer ltimer.Stop()
+
+	select {
+	case <-_ctx.Done():
+		return _ctx.Err()
+	case <-ltimer.C:
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+)
+
+// nomadTokenTransport sets ACL token to every request, token is replaced when token file changes, so short lived
+// tokens(for example workload identity) are used without client recreation
+type nomadTokenTransport struct {
+	base  http.RoundTripper
+	token atomic.Value
+}
+
+func (t *nomadTokenTransport) RoundTrip(_req *http.Request) (*http.Response, error) {
+	ltoken, _ := t.token.Load().(string)
+	if ltoken != "" && _req.Header.Get("X-Nomad-Token") == "" {
+		_req = _req.Clone(_req.Context())
+		_req.Header.Set("X-Nomad-Token", ltoken)
+	}
+
+	return t.base.RoundTrip(_req)
+}
+
+func readNomadTokenFile(_path string) (string, error) {
+	ltoken, lerr := os.ReadFile(_path)
+	if lerr != nil {
+		return "", fmt.Errorf("can't read nomad token file %s due: %s", _path, lerr)
+	}
+
+	return strings.TrimSpace(string(ltoken)), nil
+}
+
+func watchNomadTokenFile(_transport *nomadTokenTransport, _path string, _period time.Duration) {
+	logger := hclog.L().Named("nomad")
+	lticker := time.NewTicker(_period)
+
+	for range lticker.C {
+		ltoken, lerr := readNomadTokenFile(_path)
+		if lerr != nil {
+			logger.Error(fmt.Sprintf("%s, so continue with previous token", lerr))
+			continue
+		}
+
+		if ltoken != _transport.token.Load().(string) {
+			_transport.token.Store(ltoken)
+			logger.Info(fmt.Sprintf("nomad token reloaded from %s", _path))
+		}
+	}
+}
+
+// NewNomadClient creates client shared by all parts of scaler, not set options are taken from NOMAD_*
+// environment variables as nomad cli does
+func NewNomadClient(_cnf *NomadClientConfig) (*nomad.Client, error) {
+	lconfig := nomad.DefaultConfig()
+
+	if _cnf.Address != "" {
+		lconfig.Address = _cnf.Address
+	}
+	if _cnf.Region != "" {
+		lconfig.Region = _cnf.Region
+	}
+	if _cnf.Namespace != "" {
+		lconfig.Namespace = _cnf.Namespace
+	}
+	if _cnf.Token != "" {
+		lconfig.SecretID = _cnf.Token
+	}
+	if _cnf.CACert != "" {
+		lconfig.TLSConfig.CACert = _cnf.CACert
+	}
+	if _cnf.ClientCert != "" {
+		lconfig.TLSConfig.ClientCert = _cnf.ClientCert
+	}
+	if _cnf.ClientKey != "" {
+		lconfig.TLSConfig.ClientKey = _cnf.ClientKey
+	}
+	if _cnf.TLSServerName != "" {
+		lconfig.TLSConfig.TLSServerName = _cnf.TLSServerName
+	}
+	if _cnf.TLSSkipVerify {
+		lconfig.TLSConfig.Insecure = true
+	}
+
+	if _cnf.TokenFile == "" {
+		return nomad.NewClient(lconfig)
+	}
+
+	ltoken, lerr := readNomadTokenFile(_cnf.TokenFile)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	// токен из файла подставляет транспорт, поэтому http клиента с tls готовим сами
+	lhttpClient := cleanhttp.DefaultPooledClient()
+	lhttpClient.Transport.(*http.Transport).TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	lerr = nomad.ConfigureTLS(lhttpClient, lconfig.TLSConfig)
+	if lerr != nil {
+		return nil, fmt.Errorf("can't configure nomad tls due: %s", lerr)
+	}
+
+	ltransport := &nomadTokenTransport{base: lhttpClient.Transport}
+	ltransport.token.Store(ltoken)
+	lhttpClient.Transport = ltransport
+
+	lconfig.HttpClient = lhttpClient
+	lconfig.SecretID = ""
+
+	lclient, lerr := nomad.NewClient(lconfig)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	go watchNomadTokenFile(ltransport, _cnf.TokenFile, _cnf.TokenFilePeriod)
+
+	return lclient, nil
+}
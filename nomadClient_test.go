@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewNomadClientTokenFile(t *testing.T) {
+	var lgotToken atomic.Value
+	lnomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lgotToken.Store(r.Header.Get("X-Nomad-Token"))
+		w.Write([]byte("[]"))
+	}))
+	defer lnomadServer.Close()
+
+	ltokenPath := writeTestFile(t, "token", "first-token\n")
+
+	lnc, lerr := NewNomadClient(&NomadClientConfig{Address: lnomadServer.URL, TokenFile: ltokenPath, TokenFilePeriod: 10 * time.Millisecond})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	_, _, lerr = lnc.Nodes().List(nil)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if lgotToken.Load() != "first-token" {
+		t.Fatalf("token from file must be sent, got: %q", lgotToken.Load())
+	}
+
+	lerr = os.WriteFile(ltokenPath, []byte("second-token"), 0644)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	ldeadline := time.Now().Add(5 * time.Second)
+	for lgotToken.Load() != "second-token" && time.Now().Before(ldeadline) {
+		time.Sleep(20 * time.Millisecond)
+
+		_, _, lerr = lnc.Nodes().List(nil)
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+	}
+
+	if lgotToken.Load() != "second-token" {
+		t.Fatalf("changed token file must be reread, got: %q", lgotToken.Load())
+	}
+
+	_, lerr = NewNomadClient(&NomadClientConfig{Address: lnomadServer.URL, TokenFile: ltokenPath + ".missing"})
+	if lerr == nil {
+		t.Fatalf("missing token file must fail")
+	}
+}
@@ -100,6 +100,14 @@ func parsePoolDifinition(_yamlPath string) ([]*PoolNodeSpec, error) {
 		}
 
 		newpool := NewPoolNodeSpec(poolDataCasted)
+		if _, lerr := newpool.GetWarmWindows(); lerr != nil {
+			return nil, fmt.Errorf("can't parse warm field due: %s", lerr)
+		}
+
+		if _, lerr := newpool.GetGCConfig(); lerr != nil {
+			return nil, fmt.Errorf("can't parse gc field due: %s", lerr)
+		}
+
 		pools = append(pools, newpool)
 	}
 
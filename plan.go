@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+type TaskGroupPlan struct {
+	TaskGroup  string
+	Count      int
+	Pool       string
+	NewNodes   int
+	Infeasible []string
+}
+
+// PlanCommand is "plan" subcommand, it shows offline, without asking nomad, which pools job will be placed on
+type PlanCommand struct {
+	Count int `long:"count" description:"Number of allocations of every task group to place(default is count of task group)"`
+	Args  struct {
+		JobFile string `positional-arg-name:"jobfile" description:"Path to nomad job file(HCL1 or HCL2)"`
+	} `positional-args:"yes" required:"yes"`
+
+	opts *Opts
+}
+
+func (c *PlanCommand) Execute(_args []string) error {
+	setVerbosity(c.opts.Verbose)
+
+	var config Config
+	lerr := configParse(c.opts.ConfigPath, &config)
+	if lerr != nil {
+		return fmt.Errorf("can't parse config due: %s", lerr)
+	}
+
+	lpoolSpecs, lerr := parsePoolDifinition(config.PoolConfig)
+	if lerr != nil {
+		return fmt.Errorf("can't parse pool yaml due: %s", lerr)
+	}
+
+	lapiJob, lerr := parseJobFile(c.Args.JobFile)
+	if lerr != nil {
+		return lerr
+	}
+
+	printPlan(os.Stdout, planJob(lpoolSpecs, apiNomadJobToStructsJobV2(lapiJob), c.Count))
+	return nil
+}
+
+// planJob estimates nodes as if pools have no free space, the same way scalingAction do it for blocked job
+func planJob(_poolSpecs []*PoolNodeSpec, _job *structs.Job, _count int) []*TaskGroupPlan {
+	linfeasible := infeasibleTaskGroups(_poolSpecs, _job)
+
+	lcounts := map[string]int{}
+	for _, ltg := range _job.TaskGroups {
+		if _count > 0 {
+			lcounts[ltg.Name] = _count
+		}
+	}
+	ltgPools := GetOptimalPoolSpec(_job, _poolSpecs, lcounts)
+
+	lpools := map[string]*PoolToScale{}
+	lplans := make([]*TaskGroupPlan, 0, len(_job.TaskGroups))
+
+	for _, ltg := range _job.TaskGroups {
+		lplan := &TaskGroupPlan{TaskGroup: ltg.Name, Count: ltg.Count}
+		if _count > 0 {
+			lplan.Count = _count
+		}
+		lplans = append(lplans, lplan)
+
+		if !isScalableJobType(_job.Type) {
+			lplan.Infeasible = []string{fmt.Sprintf("%s jobs are not scaled, new nodes only add placements to them", _job.Type)}
+			continue
+		}
+
+		lpoolSpec := ltgPools[ltg.Name]
+		if lpoolSpec == nil {
+			lplan.Infeasible = linfeasible[ltg.Name]
+			if len(lplan.Infeasible) == 0 {
+				lplan.Infeasible = []string{"no pool have enough resources for task group"}
+			}
+			continue
+		}
+
+		lplan.Pool = lpoolSpec.GetFullName()
+		lpoolToScale, lok := lpools[lplan.Pool]
+		if !lok {
+			lpoolToScale = &PoolToScale{
+				pool: &Pool{fullName: lplan.Pool, poolnodespec: lpoolSpec},
+			}
+			lpools[lplan.Pool] = lpoolToScale
+		}
+
+		en, ea := estimateRequiredNodes(lpoolToScale.pool, lpoolToScale.en, lpoolToScale.ea, _job, ltg, lplan.Count)
+		lplan.NewNodes = len(en)
+
+		lpoolToScale.en = append(lpoolToScale.en, en...)
+		lpoolToScale.ea = append(lpoolToScale.ea, ea...)
+	}
+
+	sort.Slice(lplans, func(i, j int) bool {
+		return lplans[i].TaskGroup < lplans[j].TaskGroup
+	})
+
+	return lplans
+}
+
+func printPlan(w io.Writer, _plans []*TaskGroupPlan) {
+	for _, lplan := range _plans {
+		if lplan.Pool == "" {
+			fmt.Fprintf(w, "task group %s(count %d): no feasible pool\n", lplan.TaskGroup, lplan.Count)
+			for _, lreason := range lplan.Infeasible {
+				fmt.Fprintf(w, "  %s\n", lreason)
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "task group %s(count %d): pool %s, new nodes: %d\n", lplan.TaskGroup, lplan.Count, lplan.Pool, lplan.NewNodes)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanJob(t *testing.T) {
+	lpoolSpecs := []*PoolNodeSpec{
+		NewPoolNodeSpec(map[string]Variant{
+			"cpu":              NewVariantIntValue(1000),
+			"mem":              NewVariantIntValue(100),
+			"attr.cpu.arch":    NewVariantStringValue("x86"),
+			"attr.kernel.name": NewVariantStringValue("linux"),
+			"datacenter":       NewVariantStringValue("test"),
+			"drivers": NewVariantSliceValue([]Variant{
+				NewVariantStringValue("docker"),
+			}),
+		}),
+	}
+
+	ljobPath := filepath.Join(t.TempDir(), "web.nomad")
+	lerr := os.WriteFile(ljobPath, []byte(`
+job "web" {
+  datacenters = ["test"]
+
+  group "app" {
+    count = 3
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "nginx"
+      }
+      resources {
+        cpu    = 400
+        memory = 50
+      }
+    }
+  }
+
+  group "riscv" {
+    constraint {
+      attribute = "${attr.cpu.arch}"
+      value     = "riscv"
+    }
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "nginx"
+      }
+      resources {
+        cpu    = 100
+        memory = 10
+      }
+    }
+  }
+}
+`), 0644)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lapiJob, lerr := parseJobFile(ljobPath)
+	if lerr != nil {
+		t.Fatalf("can't parse job file due: %s", lerr)
+	}
+
+	lplans := planJob(lpoolSpecs, apiNomadJobToStructsJobV2(lapiJob), 0)
+	if len(lplans) != 2 {
+		t.Fatalf("wrong plans count: %d", len(lplans))
+	}
+
+	if lplans[0].TaskGroup != "app" || lplans[0].Pool != lpoolSpecs[0].GetFullName() || lplans[0].Count != 3 || lplans[0].NewNodes != 2 {
+		t.Fatalf("wrong plan for app: %+v", lplans[0])
+	}
+
+	if lplans[1].TaskGroup != "riscv" || lplans[1].Pool != "" || len(lplans[1].Infeasible) != 1 {
+		t.Fatalf("wrong plan for riscv: %+v", lplans[1])
+	}
+	t.Logf("riscv infeasible due: %v", lplans[1].Infeasible)
+
+	lplans = planJob(lpoolSpecs, apiNomadJobToStructsJobV2(lapiJob), 5)
+	if lplans[0].Count != 5 || lplans[0].NewNodes != 3 {
+		t.Fatalf("wrong plan for app with count override: %+v", lplans[0])
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-hclog"
 	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/uuid"
 	"github.com/hashicorp/nomad/nomad/structs"
 	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider"
 )
@@ -22,6 +24,34 @@ type PoolAllocConsume struct {
 	closemonitor chan struct{}
 }
 
+// DryRunAction is what pool would have done with node provider if scaler was not in dry run mode
+type DryRunAction struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Nodes   int       `json:"nodes"`
+	NodeIds []string  `json:"nodeids,omitempty"`
+}
+
+const cDryRunActionsToKeep = 100
+
+// как часто проверяем, не застрял ли пул
+const cStallCheckPeriod = 10 * time.Second
+
+// сколько прогрев ждет провайдера и появления нод, после этого его ноды больше не учитываются как ephemeral
+const cWarmUpTimeout = 10 * time.Minute
+
+// PoolStalledError is returned when pool made no progress in adding nodes for fallback time, or its node provider
+// reported that cloud has no capacity. Unplaced is count of allocations, that were expected on not added nodes,
+// by task groups
+type PoolStalledError struct {
+	Reason   string
+	Unplaced map[string]int
+}
+
+func (e *PoolStalledError) Error() string {
+	return fmt.Sprintf("pool stalled: %s", e.Reason)
+}
+
 type Pool struct {
 	lock       sync.Mutex
 	updrmvlock sync.RWMutex
@@ -35,11 +65,35 @@ type Pool struct {
 	ephemeralnomadNodes  []*structs.Node
 	ephemeralnomadAllocs []*structs.Allocation
 
+	// ноды добавленные во время скейлинга и время когда они стали ready(пусто пока не стали), нужно для метрик
+	scaledNodesReadyAt map[string]time.Time
+
 	poolnodespec *PoolNodeSpec
 	nodeProvider nodeprovider.INodeProvider
 
 	countNodesPubCh  []*PoolNodeConsume
 	countAllocsPubCh []*PoolAllocConsume
+
+	dryRun        bool
+	dryRunActions []*DryRunAction
+
+	// границы размера пула, 0 - без границы
+	minNodes int
+	maxNodes int
+
+	// набор пулов, в который входит пул, через него соблюдается общий лимит нод, nil если пул сам по себе
+	poolSet *PoolSet
+
+	// ресурсы, которые system jobs займут на каждой новой ноде пула, nil пока неизвестны
+	systemFootprint *structs.ComparableResources
+
+	// сколько нод и когда запрошено скейлингами, нужно для скорости скейлинга
+	scaleUps []*PoolScaleUp
+}
+
+type PoolScaleUp struct {
+	Time  time.Time
+	Nodes int
 }
 
 func NewPool(_poolnodespec *PoolNodeSpec) (*Pool, error) {
@@ -48,7 +102,6 @@ func NewPool(_poolnodespec *PoolNodeSpec) (*Pool, error) {
 		return nil, fmt.Errorf("provider attribute must be set in pool")
 	}
 
-	var lprovider nodeprovider.INodeProvider
 	lproviderInfo := lpoolProviderAttr.GetMapValue()
 	if lproviderInfo == nil {
 		return nil, fmt.Errorf("provider info is nil")
@@ -59,45 +112,30 @@ func NewPool(_poolnodespec *PoolNodeSpec) (*Pool, error) {
 		return nil, fmt.Errorf("provider info have no name attribute")
 	}
 
-	switch *lname.GetStringValue() {
-	case "awsautoscale":
-		lparamsVariant, lok := lproviderInfo["params"]
-		if !lok {
-			return nil, fmt.Errorf("provider info have no params attribute")
-		}
-
-		llprovider, lerr := nodeprovider.Createawsautoscalegroupv2(variantToTypes(lparamsVariant))
-		if lerr != nil {
-			return nil, fmt.Errorf("can't create awsautoscale provider due: %s", lerr)
-		}
-
-		lprovider = llprovider
-
-	case "anynode":
-		lprovider, _ = nodeprovider.NewAnyNodeProvider()
-
-	case "karpenter":
-		lparamsVariant, lok := lproviderInfo["params"]
-		if !lok {
-			return nil, fmt.Errorf("provider info have no params attribute")
-		}
+	if lname.GetType() != VariantTypeString {
+		return nil, fmt.Errorf("provider name must be string")
+	}
 
-		lres := _poolnodespec.GetResources()
-		lproviderRes := &nodeprovider.K8sKapenterProviderResources{
-			Cpu:    lres.Cpu,
-			MemMB:  lres.MemMB,
-			DiskMB: lres.DiskMB,
-		}
+	var lparams interface{}
+	if lparamsVariant, lok := lproviderInfo["params"]; lok {
+		lparams = variantToTypes(lparamsVariant)
+	}
 
-		llprovider, lerr := nodeprovider.Createkarpenterprovider(variantToTypes(lparamsVariant), lproviderRes)
-		if lerr != nil {
-			return nil, fmt.Errorf("can't create karpenter provider due: %s", lerr)
-		}
+	lres := _poolnodespec.GetResources()
+	lproviderRes := &nodeprovider.ProviderResources{
+		Cpu:    lres.Cpu,
+		MemMB:  lres.MemMB,
+		DiskMB: lres.DiskMB,
+	}
 
-		lprovider = llprovider
+	lproviderName := *lname.GetStringValue()
+	lprovider, lerr := nodeprovider.CreateProvider(lproviderName, lparams, lproviderRes)
+	if lerr != nil {
+		return nil, fmt.Errorf("can't create %s provider due: %s", lproviderName, lerr)
 	}
 
 	lpoolName := _poolnodespec.GetFullName()
+	lminNodes, lmaxNodes := _poolnodespec.GetNodeBounds()
 
 	pool := &Pool{
 		logger:       hclog.L().Named("pool").With("pool", lpoolName),
@@ -107,6 +145,11 @@ func NewPool(_poolnodespec *PoolNodeSpec) (*Pool, error) {
 
 		nomadNodes:  map[string]*structs.Node{},
 		nomadAllocs: map[string]*structs.Allocation{},
+
+		scaledNodesReadyAt: map[string]time.Time{},
+
+		minNodes: lminNodes,
+		maxNodes: lmaxNodes,
 	}
 
 	return pool, nil
@@ -116,16 +159,177 @@ func (p *Pool) GetName() string {
 	return p.fullName
 }
 
-func (p *Pool) tryNomadNode(_nomadNode *nomad.Node) bool {
+// SetDryRun must be called before pool is used, in dry run mode pool never calls node provider to change nodes
+func (p *Pool) SetDryRun(_dryRun bool) {
+	p.dryRun = _dryRun
+}
+
+func (p *Pool) IsDryRun() bool {
+	return p.dryRun
+}
+
+// SetNodeBounds changes min and max nodes of pool, 0 means no bound
+func (p *Pool) SetNodeBounds(_minNodes int, _maxNodes int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.minNodes = _minNodes
+	p.maxNodes = _maxNodes
+}
+
+func (p *Pool) GetNodeBounds() (int, int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.minNodes, p.maxNodes
+}
+
+// SetSystemFootprint sets resources, which system jobs will allocate on every new node of pool
+func (p *Pool) SetSystemFootprint(_footprint *structs.ComparableResources) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.systemFootprint = _footprint
+}
+
+// Size returns nodes count of pool with nodes that are expected to appear due scalings in progress
+func (p *Pool) Size() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.nomadNodes) + len(p.ephemeralnomadNodes)
+}
+
+func (p *Pool) lockBudget() int {
+	if p.poolSet == nil {
+		return -1
+	}
+
+	return p.poolSet.lockBudget(p)
+}
+
+func (p *Pool) unlockBudget() {
+	if p.poolSet != nil {
+		p.poolSet.unlockBudget()
+	}
+}
+
+// allowedNewNodes returns how many of _want new nodes pool may request, and what limited them(empty if not
+// limited), _globalLimit is nodes allowed to pool by global cap(-1 if there is no cap). Must be called with p.lock held
+func (p *Pool) allowedNewNodes(_want int, _globalLimit int) (int, string) {
+	lsize := len(p.nomadNodes) + len(p.ephemeralnomadNodes)
+	lallowed := _want
+	lreason := ""
+
+	if p.maxNodes > 0 && p.maxNodes-lsize < lallowed {
+		lallowed = p.maxNodes - lsize
+		lreason = fmt.Sprintf("pool max %d nodes", p.maxNodes)
+	}
+
+	if _globalLimit >= 0 && _globalLimit-lsize < lallowed {
+		lallowed = _globalLimit - lsize
+		lreason = fmt.Sprintf("global max_nodes(%d nodes left for pool)", _globalLimit)
+	}
+
+	return max(lallowed, 0), lreason
+}
+
+// clampScaling drops new nodes which pool may not request, with allocations planned on them, shortfall is
+// reported to log and metrics. Must be called with p.lock held
+func (p *Pool) clampScaling(_logger hclog.Logger, _en []*structs.Node, _ea []*structs.Allocation, _globalLimit int) ([]*structs.Node, []*structs.Allocation) {
+	lallowed, lreason := p.allowedNewNodes(len(_en), _globalLimit)
+	if lallowed >= len(_en) {
+		return _en, _ea
+	}
+
+	lshortfall := len(_en) - lallowed
+	_logger.Warn(fmt.Sprintf("scaling clamped by %s: required %d new nodes, allowed %d, so %d nodes short", lreason, len(_en), lallowed, lshortfall))
+	metrics.IncrCounterWithLabels([]string{"scaleup", "nodesshortfall"}, float32(lshortfall), poolLabels(p.fullName))
+
+	ldroppedNodes := map[string]struct{}{}
+	for _, lnode := range _en[lallowed:] {
+		ldroppedNodes[lnode.ID] = struct{}{}
+	}
+
+	lea := make([]*structs.Allocation, 0, len(_ea))
+	for _, lalloc := range _ea {
+		if _, lok := ldroppedNodes[lalloc.NodeID]; !lok {
+			lea = append(lea, lalloc)
+		}
+	}
+
+	return _en[:lallowed], lea
+}
+
+// ScaleUpRate returns count of nodes requested by scalings of pool during cScaleUpRateWindow before _now
+func (p *Pool) ScaleUpRate(_now time.Time) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	lrate := 0
+	lrecent := p.scaleUps[:0]
+	for _, lscaleUp := range p.scaleUps {
+		if _now.Sub(lscaleUp.Time) < cScaleUpRateWindow {
+			lrecent = append(lrecent, lscaleUp)
+			lrate += lscaleUp.Nodes
+		}
+	}
+	p.scaleUps = lrecent
+
+	return lrate
+}
+
+// must be called with p.lock held
+func (p *Pool) recordDryRun(_action *DryRunAction) {
+	_action.Time = time.Now()
+	p.dryRunActions = append(p.dryRunActions, _action)
+	if len(p.dryRunActions) > cDryRunActionsToKeep {
+		p.dryRunActions = p.dryRunActions[len(p.dryRunActions)-cDryRunActionsToKeep:]
+	}
+}
+
+func (p *Pool) GetDryRunActions() []*DryRunAction {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]*DryRunAction{}, p.dryRunActions...)
+}
+
+// hasNomadNode reports that nomad node already belongs to pool
+func (p *Pool) hasNomadNode(_nodeId string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, lok := p.nomadNodes[_nodeId]
+	return lok
+}
+
+func (p *Pool) tryNomadNode(_ctx context.Context, _nomadNode *nomad.Node) bool {
 	p.lock.Lock()
 	_, alreadyInPool := p.nomadNodes[_nomadNode.ID]
 	p.lock.Unlock()
 
-	if alreadyInPool || p.nodeProvider.IsNodeExists(_nomadNode) {
+	lbelongsToPool := alreadyInPool
+	if !alreadyInPool {
+		var lerr error
+		lbelongsToPool, lerr = p.nodeProvider.IsNodeExists(_ctx, _nomadNode)
+		if lerr != nil {
+			p.logger.Error(fmt.Sprintf("can't check that nomad node %s belongs to pool due: %s", _nomadNode.ID, lerr))
+			return false
+		}
+	}
+
+	if lbelongsToPool {
 		if _nomadNode.Status != nomad.NodeStatusDown {
 			p.lock.Lock()
 
 			p.nomadNodes[_nomadNode.ID] = apiNomadNodeToStructsNode(_nomadNode)
+			if !alreadyInPool && len(p.ephemeralnomadNodes) > 0 {
+				p.scaledNodesReadyAt[_nomadNode.ID] = time.Time{}
+			}
+			if lreadyAt, lok := p.scaledNodesReadyAt[_nomadNode.ID]; lok && lreadyAt.IsZero() && _nomadNode.Status == nomad.NodeStatusReady {
+				p.scaledNodesReadyAt[_nomadNode.ID] = time.Now()
+			}
 			lnomadNodesCount := len(p.nomadNodes)
 			lnomadAllocsCount := len(p.nomadAllocs)
 
@@ -158,6 +362,7 @@ func (p *Pool) tryNomadNode(_nomadNode *nomad.Node) bool {
 		} else {
 			p.lock.Lock()
 			delete(p.nomadNodes, _nomadNode.ID)
+			delete(p.scaledNodesReadyAt, _nomadNode.ID)
 			allocsToRemove := []string{}
 			for _, lalloc := range p.nomadAllocs {
 				if lalloc.NodeID == _nomadNode.ID {
@@ -237,6 +442,10 @@ func (p *Pool) tryNomadAllocation(_nomadAllocation *nomad.Allocation) bool {
 				}
 
 				if lephemeralAlloc != nil {
+					if lreadyAt := p.scaledNodesReadyAt[_nomadAllocation.NodeID]; !lreadyAt.IsZero() {
+						metrics.MeasureSinceWithLabels([]string{"pool", "allocplacement"}, lreadyAt, poolLabels(p.fullName))
+					}
+
 					countAllocsPubCh := []*PoolAllocConsume{}
 
 					for _, lallocCh := range p.countAllocsPubCh {
@@ -272,17 +481,54 @@ func (p *Pool) tryNomadAllocation(_nomadAllocation *nomad.Allocation) bool {
 }
 
 func (p *Pool) Update(_ctx context.Context, _en []*structs.Node, _ea []*structs.Allocation) error {
-	var returnerr error
+	return p.UpdateWithFallback(_ctx, _en, _ea, 0, nil)
+}
+
+// UpdateWithFallback stops waiting with *PoolStalledError if no new nodes appeared for _fallbackAfter, or node
+// provider reported that cloud has no capacity, 0 means wait as long as _ctx allows. _accepted, if set, is called
+// before node provider with nodes and allocations that are left after pool and global max are applied
+func (p *Pool) UpdateWithFallback(_ctx context.Context, _en []*structs.Node, _ea []*structs.Allocation, _fallbackAfter time.Duration, _accepted func([]*structs.Node, []*structs.Allocation)) error {
 	p.updrmvlock.RLock()
 	defer p.updrmvlock.RUnlock()
 
 	logger := p.logger.Named("update")
 
+	lglobalLimit := p.lockBudget()
 	p.lock.Lock()
 
+	lrequested := len(_en)
+	_en, _ea = p.clampScaling(logger, _en, _ea, lglobalLimit)
+	if _accepted != nil {
+		if p.dryRun {
+			_accepted(nil, nil) // в dry run ноды не запрашиваются, ждать после перезапуска нечего
+		} else {
+			_accepted(_en, _ea)
+		}
+	}
+
+	if lrequested > 0 && len(_en) == 0 {
+		p.lock.Unlock()
+		p.unlockBudget()
+
+		return fmt.Errorf("pool reached max nodes, so no nodes can be added")
+	}
+
+	if p.dryRun {
+		waitCount := len(p.nomadNodes) + len(p.ephemeralnomadNodes) + len(_en)
+		p.recordDryRun(&DryRunAction{Action: "update", Nodes: len(_en)})
+		p.lock.Unlock()
+		p.unlockBudget()
+
+		// ноды не появятся, поэтому и ждать нечего
+		logger.Info(fmt.Sprintf("dry run: would set size to %d nodes, to place %d allocs on %d new nodes", waitCount, len(_ea), len(_en)))
+		return nil
+	}
+
 	p.ephemeralnomadNodes = append(p.ephemeralnomadNodes, _en...)
 	p.ephemeralnomadAllocs = append(p.ephemeralnomadAllocs, _ea...)
 	waitCount := len(p.nomadNodes) + len(p.ephemeralnomadNodes)
+	// ноды уже учтены как ephemeral, поэтому другие пулы могут считать бюджет
+	p.unlockBudget()
 
 	lnomadnodes := make([]*structs.Node, 0, len(p.nomadNodes))
 	for _, lnode := range p.nomadNodes {
@@ -290,6 +536,7 @@ func (p *Pool) Update(_ctx context.Context, _en []*structs.Node, _ea []*structs.
 	}
 
 	logger.Info(fmt.Sprintf("setting size to %d nodes", waitCount))
+	lproviderCallTime := time.Now()
 	lerr := p.nodeProvider.UpdateNode(_ctx, lnomadnodes, int32(waitCount))
 	if lerr != nil {
 		for _, lea := range _ea {
@@ -315,6 +562,40 @@ func (p *Pool) Update(_ctx context.Context, _en []*structs.Node, _ea []*structs.
 		return fmt.Errorf("can't set node count due: %s", lerr)
 	}
 
+	metrics.IncrCounterWithLabels([]string{"scaleup", "nodesrequested"}, float32(len(_en)), poolLabels(p.fullName))
+	p.scaleUps = append(p.scaleUps, &PoolScaleUp{Time: time.Now(), Nodes: len(_en)})
+
+	countNodesCh, countAllocsCh := p.subscribeEphemeral()
+	p.lock.Unlock()
+
+	return p.waitEphemeral(_ctx, logger, _en, _ea, waitCount, len(lnomadnodes), lproviderCallTime, _fallbackAfter, countNodesCh, countAllocsCh)
+}
+
+// Resume restores waiting for ephemeral nodes and allocations of scaling which was in progress when scaler restarted,
+// node provider already knows about them, so only pool bookkeeping is restored
+func (p *Pool) Resume(_ctx context.Context, _en []*structs.Node, _ea []*structs.Allocation) error {
+	p.updrmvlock.RLock()
+	defer p.updrmvlock.RUnlock()
+
+	logger := p.logger.Named("resume")
+
+	p.lock.Lock()
+
+	p.ephemeralnomadNodes = append(p.ephemeralnomadNodes, _en...)
+	p.ephemeralnomadAllocs = append(p.ephemeralnomadAllocs, _ea...)
+	waitCount := len(p.nomadNodes) + len(p.ephemeralnomadNodes)
+
+	logger.Info(fmt.Sprintf("resume waiting for %d ephemeral nodes and %d ephemeral allocs", len(_en), len(_ea)))
+	countNodesCh, countAllocsCh := p.subscribeEphemeral()
+	lnodesBefore := len(p.nomadNodes)
+	p.lock.Unlock()
+
+	// время обращения к провайдеру до рестарта неизвестно, поэтому время регистрации нод не меряем
+	return p.waitEphemeral(_ctx, logger, _en, _ea, waitCount, lnodesBefore, time.Time{}, 0, countNodesCh, countAllocsCh)
+}
+
+// must be called with p.lock held
+func (p *Pool) subscribeEphemeral() (*PoolNodeConsume, *PoolAllocConsume) {
 	countNodesCh := &PoolNodeConsume{
 		make(chan int),
 		make(chan struct{}),
@@ -327,12 +608,26 @@ func (p *Pool) Update(_ctx context.Context, _en []*structs.Node, _ea []*structs.
 	}
 	p.countAllocsPubCh = append(p.countAllocsPubCh, countAllocsCh)
 
-	p.lock.Unlock()
+	return countNodesCh, countAllocsCh
+}
 
+// waitEphemeral also measures registration time of requested nodes since _providerCallTime, if it is set. If
+// _fallbackAfter is set, it checks that pool is not stalled
+func (p *Pool) waitEphemeral(_ctx context.Context, logger hclog.Logger, _en []*structs.Node, _ea []*structs.Allocation, waitCount int, _nodesBefore int, _providerCallTime time.Time, _fallbackAfter time.Duration, countNodesCh *PoolNodeConsume, countAllocsCh *PoolAllocConsume) error {
+	var returnerr error
 	var allocationsPlaced []*structs.Allocation
+	lregisteredNodes := 0
 	waitAllocsTimer := time.NewTimer(10 * time.Second)
 	waitAllocsTimer.Stop()
 
+	var lstallCheckCh <-chan time.Time
+	lprogressTime := time.Now()
+	if _fallbackAfter > 0 {
+		lstallTicker := time.NewTicker(min(_fallbackAfter, cStallCheckPeriod))
+		defer lstallTicker.Stop()
+		lstallCheckCh = lstallTicker.C
+	}
+
 WAITLOOP:
 	for {
 		select {
@@ -342,9 +637,29 @@ WAITLOOP:
 
 		case <-waitAllocsTimer.C:
 			logger.Info(fmt.Sprintf("Waiting for pool update done, only %d ephemeral allocations(%d) are placed", len(allocationsPlaced), len(_ea)))
+			metrics.IncrCounterWithLabels([]string{"pool", "allocsnotplaced"}, float32(len(_ea)-len(allocationsPlaced)), poolLabels(p.fullName))
 			break WAITLOOP
 
+		case <-lstallCheckCh:
+			// все ноды уже появились, ждем только аллокации
+			if lregisteredNodes >= len(_en) {
+				break
+			}
+
+			if lreason := p.stalledReason(_ctx, logger, lprogressTime, _providerCallTime, _fallbackAfter); lreason != "" {
+				returnerr = &PoolStalledError{Reason: lreason, Unplaced: unplacedAllocs(_en[lregisteredNodes:], _ea, allocationsPlaced)}
+				break WAITLOOP
+			}
+
 		case curCount := <-countNodesCh.consummer:
+			// ноды могли добавиться и другим скейлингом, поэтому это лишь оценка
+			for ; lregisteredNodes < len(_en) && _nodesBefore+lregisteredNodes < curCount; lregisteredNodes++ {
+				lprogressTime = time.Now()
+				if !_providerCallTime.IsZero() {
+					metrics.MeasureSinceWithLabels([]string{"pool", "noderegistration"}, _providerCallTime, poolLabels(p.fullName))
+				}
+			}
+
 			if curCount >= waitCount {
 				waitAllocsTimer.Reset(10 * time.Second)
 			}
@@ -354,6 +669,7 @@ WAITLOOP:
 				if lea.ID == ephemeralAllocID {
 					allocationsPlaced = append(allocationsPlaced, lea)
 					waitAllocsTimer.Reset(10 * time.Second)
+					lprogressTime = time.Now()
 
 					if len(allocationsPlaced) == len(_ea) {
 						logger.Info(fmt.Sprintf("Waiting for pool update done, all ephemeral allocations(%d) are placed", len(_ea)))
@@ -396,66 +712,248 @@ WAITLOOP:
 	return returnerr
 }
 
+// stalledReason returns why pool is considered stalled, empty if it is not
+func (p *Pool) stalledReason(_ctx context.Context, _logger hclog.Logger, _progressTime time.Time, _providerCallTime time.Time, _fallbackAfter time.Duration) string {
+	if time.Since(_progressTime) >= _fallbackAfter {
+		return fmt.Sprintf("no new nodes for %s", _fallbackAfter)
+	}
+
+	lcapacityProvider, lok := p.nodeProvider.(nodeprovider.ICapacityNodeProvider)
+	if !lok {
+		return ""
+	}
+
+	lreason, lerr := lcapacityProvider.InsufficientCapacity(_ctx, _providerCallTime)
+	if lerr != nil {
+		_logger.Warn(fmt.Sprintf("can't check capacity of node provider due: %s", lerr))
+		return ""
+	}
+
+	if lreason != "" {
+		return fmt.Sprintf("insufficient capacity: %s", lreason)
+	}
+
+	return ""
+}
+
+// unplacedAllocs counts by task groups not placed allocations, which were estimated on _missingNodes
+func unplacedAllocs(_missingNodes []*structs.Node, _ea []*structs.Allocation, _placed []*structs.Allocation) map[string]int {
+	lmissingNodes := map[string]struct{}{}
+	for _, lnode := range _missingNodes {
+		lmissingNodes[lnode.ID] = struct{}{}
+	}
+
+	lplaced := map[string]struct{}{}
+	for _, lalloc := range _placed {
+		lplaced[lalloc.ID] = struct{}{}
+	}
+
+	lunplaced := map[string]int{}
+	for _, lalloc := range _ea {
+		if _, lok := lplaced[lalloc.ID]; lok {
+			continue
+		}
+
+		if _, lok := lmissingNodes[lalloc.NodeID]; lok {
+			lunplaced[lalloc.TaskGroup] += 1
+		}
+	}
+
+	return lunplaced
+}
+
+// WarmUp adds nodes to pool ahead of demand. Until they appear in nomad they are ephemeral, so pool max and global
+// max_nodes count them the same way as nodes requested by scalings. Returns false if no nodes were requested
 func (p *Pool) WarmUp(_nodesTolaunch int) bool {
 	p.updrmvlock.RLock()
 	defer p.updrmvlock.RUnlock()
 
+	logger := p.logger.Named("warmup")
+
+	lwarmNodes := make([]*structs.Node, 0, _nodesTolaunch)
+	for li := 0; li < _nodesTolaunch; li++ {
+		lwarmNodes = append(lwarmNodes, p.poolnodespec.GetNode(uuid.Generate()))
+	}
+
+	lglobalLimit := p.lockBudget()
 	p.lock.Lock()
 
+	lwarmNodes, _ = p.clampScaling(logger, lwarmNodes, nil, lglobalLimit)
+	if len(lwarmNodes) == 0 {
+		p.lock.Unlock()
+		p.unlockBudget()
+		return false
+	}
+
+	if p.dryRun {
+		p.recordDryRun(&DryRunAction{Action: "warmup", Nodes: len(lwarmNodes)})
+		p.lock.Unlock()
+		p.unlockBudget()
+
+		logger.Info(fmt.Sprintf("dry run: would add %d nodes to pool due warmup", len(lwarmNodes)))
+		return true
+	}
+
+	p.ephemeralnomadNodes = append(p.ephemeralnomadNodes, lwarmNodes...)
+	waitCount := len(p.nomadNodes) + len(p.ephemeralnomadNodes)
+	// ноды уже учтены как ephemeral, поэтому другие пулы могут считать бюджет
+	p.unlockBudget()
+
 	lnomadnodes := make([]*structs.Node, 0, len(p.nomadNodes))
 	for _, lnode := range p.nomadNodes {
 		lnomadnodes = append(lnomadnodes, lnode)
 	}
 
-	p.logger.Info(fmt.Sprintf("adding %d nodes to pool due warmup", _nodesTolaunch))
+	lctx, lcancel := context.WithTimeout(context.Background(), cWarmUpTimeout)
+	defer lcancel()
+
+	logger.Info(fmt.Sprintf("adding %d nodes to pool due warmup, so setting size to %d nodes", len(lwarmNodes), waitCount))
+	lerr := p.nodeProvider.UpdateNode(lctx, lnomadnodes, int32(waitCount))
+	if lerr != nil {
+		p.dropEphemeralNodes(lwarmNodes)
+		p.lock.Unlock()
+
+		logger.Error(fmt.Sprintf("can't set node count due: %s", lerr))
+		return false
+	}
+
 	countNodesCh := &PoolNodeConsume{
 		make(chan int),
 		make(chan struct{}),
 	}
-
 	p.countNodesPubCh = append(p.countNodesPubCh, countNodesCh)
-	waitCount := len(lnomadnodes) + _nodesTolaunch
-	p.nodeProvider.UpdateNode(context.TODO(), lnomadnodes, int32(waitCount))
 	p.lock.Unlock()
 
-	for curCount := range countNodesCh.consummer {
-		if curCount >= waitCount {
-			break
+WAITLOOP:
+	for {
+		select {
+		case <-lctx.Done():
+			logger.Warn(fmt.Sprintf("not all warmup nodes appeared in nomad, stop waiting for them: %s", lctx.Err()))
+			break WAITLOOP
+
+		case curCount := <-countNodesCh.consummer:
+			if curCount >= waitCount {
+				break WAITLOOP
+			}
 		}
 	}
 	close(countNodesCh.closemonitor)
 
+	p.lock.Lock()
+	p.dropEphemeralNodes(lwarmNodes)
+	p.lock.Unlock()
+
 	return true
 }
 
-func (p *Pool) RemoveNode(_nomadNodeIds []string) bool {
+// must be called with p.lock held
+func (p *Pool) dropEphemeralNodes(_en []*structs.Node) {
+	for _, lnode := range _en {
+		for li, notExistentNode := range p.ephemeralnomadNodes {
+			if lnode.ID == notExistentNode.ID {
+				p.ephemeralnomadNodes = append(p.ephemeralnomadNodes[:li], p.ephemeralnomadNodes[li+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// SaveProviderState returns nil if node provider have no state to save
+func (p *Pool) SaveProviderState() ([]byte, error) {
+	if lstatefulProvider, lok := p.nodeProvider.(nodeprovider.IStatefulNodeProvider); lok {
+		return lstatefulProvider.SaveState()
+	}
+
+	return nil, nil
+}
+
+func (p *Pool) RestoreProviderState(_state []byte) error {
+	if lstatefulProvider, lok := p.nodeProvider.(nodeprovider.IStatefulNodeProvider); lok {
+		return lstatefulProvider.RestoreState(_state)
+	}
+
+	return nil
+}
+
+// RemoveNode returns result for every requested node id, nodes that pool don't know about reported as not found
+func (p *Pool) RemoveNode(_ctx context.Context, _nomadNodeIds []string) nodeprovider.RemoveNodeResults {
 	p.updrmvlock.Lock()
 	defer p.updrmvlock.Unlock()
 
 	logger := p.logger.Named("remove")
 
+	lresults := nodeprovider.RemoveNodeResults{}
+
 	p.lock.Lock()
 	nomadNodes := make([]*nomad.Node, 0, len(_nomadNodeIds))
 	for _, lnomadNodeId := range _nomadNodeIds {
 		if nomadNode, lok := p.nomadNodes[lnomadNodeId]; lok {
 			nomadNodes = append(nomadNodes, structsNomadNodeToApiNode(nomadNode))
+		} else {
+			lresults[lnomadNodeId] = &nodeprovider.RemoveNodeResult{Status: nodeprovider.RemoveNodeStatusNotFound, Reason: fmt.Errorf("node not in pool")}
+		}
+	}
+
+	if p.dryRun && len(nomadNodes) > 0 {
+		lnodeIds := make([]string, 0, len(nomadNodes))
+		for _, lnomadNode := range nomadNodes {
+			lnodeIds = append(lnodeIds, lnomadNode.ID)
+		}
+		p.recordDryRun(&DryRunAction{Action: "remove", Nodes: len(lnodeIds), NodeIds: lnodeIds})
+
+		logger.Info(fmt.Sprintf("dry run: would remove nodes %v", lnodeIds))
+		for lnomadNodeId, lresult := range nodeprovider.NewRemoveNodeResults(nomadNodes, nodeprovider.RemoveNodeStatusRemoved, nil) {
+			lresults[lnomadNodeId] = lresult
 		}
+		nomadNodes = nil
 	}
 	p.lock.Unlock()
 
-	lerr := p.nodeProvider.RemoveNode(nomadNodes)
-	if lerr != nil {
-		logger.Error(fmt.Sprintf("can't remove nomad nodes due: %s", lerr))
+	if len(nomadNodes) > 0 {
+		for lnomadNodeId, lresult := range p.nodeProvider.RemoveNode(_ctx, nomadNodes) {
+			lresults[lnomadNodeId] = lresult
+		}
 	}
 
-	logger.Info(fmt.Sprintf("removed %s nomad nodes", _nomadNodeIds))
-	return true
+	for lnomadNodeId, lresult := range lresults {
+		switch lresult.Status {
+		case nodeprovider.RemoveNodeStatusRemoved, nodeprovider.RemoveNodeStatusNotFound:
+			logger.Info(fmt.Sprintf("nomad node %s: %s", lnomadNodeId, lresult))
+		default:
+			logger.Error(fmt.Sprintf("can't remove nomad node %s: %s", lnomadNodeId, lresult))
+		}
+	}
+
+	return lresults
 }
 
 // ----------------------------------------------------------------------------
 func createPools(_stalecnf *StaleApiConfig, _nomadClient *nomad.Client, _poolSpecs []*PoolNodeSpec) (map[string]*Pool, uint64, error) {
 	lpools := map[string]*Pool{}
 
+	nodeList, queryMeta, lerr := listNomadNodes(_stalecnf, _nomadClient)
+	if lerr != nil {
+		return nil, 0, lerr
+	}
+
+	for _, poolSpec := range _poolSpecs {
+		pool, lerr := NewPool(poolSpec)
+		if lerr != nil {
+			return nil, 0, fmt.Errorf("can't create pool due: %s", lerr)
+		}
+
+		lpools[poolSpec.GetFullName()] = pool
+
+		lerr = fillPool(_stalecnf, _nomadClient, pool, nodeList)
+		if lerr != nil {
+			return nil, 0, lerr
+		}
+	}
+
+	return lpools, queryMeta.LastIndex, nil
+}
+
+func listNomadNodes(_stalecnf *StaleApiConfig, _nomadClient *nomad.Client) ([]*nomad.NodeListStub, *nomad.QueryMeta, error) {
 	lnqoptions := &nomad.QueryOptions{AllowStale: _stalecnf.Allow}
 	nodeList, queryMeta, lerr := _nomadClient.Nodes().List(lnqoptions)
 	if lerr == nil {
@@ -467,53 +965,53 @@ func createPools(_stalecnf *StaleApiConfig, _nomadClient *nomad.Client, _poolSpe
 		}
 	}
 	if lerr != nil {
-		return nil, 0, fmt.Errorf("can't get nomad nodes due: %s", lerr)
+		return nil, nil, fmt.Errorf("can't get nomad nodes due: %s", lerr)
 	}
 
-	for _, poolSpec := range _poolSpecs {
-		pool, lerr := NewPool(poolSpec)
+	return nodeList, queryMeta, nil
+}
+
+// fillPool adds to pool nomad nodes which it owns, with their allocations
+func fillPool(_stalecnf *StaleApiConfig, _nomadClient *nomad.Client, _pool *Pool, _nodeList []*nomad.NodeListStub) error {
+	for _, lnomadNodeStub := range _nodeList {
+		lnqoptions := &nomad.QueryOptions{AllowStale: _stalecnf.Allow}
+		nomadNode, lmeta, lerr := _nomadClient.Nodes().Info(lnomadNodeStub.ID, nil)
+		if lerr == nil {
+			if _stalecnf.Allow {
+				if lmeta.LastContact > _stalecnf.StaleAllowedDuration {
+					lnqoptions.AllowStale = false
+					nomadNode, _, lerr = _nomadClient.Nodes().Info(lnomadNodeStub.ID, nil)
+				}
+			}
+		}
 		if lerr != nil {
-			return nil, 0, fmt.Errorf("can't create pool due: %s", lerr)
+			return fmt.Errorf("can't get nomad node %s info due: %s", lnomadNodeStub.ID, lerr)
 		}
 
-		lpools[poolSpec.GetFullName()] = pool
+		lctx, lcancel := context.WithTimeout(context.Background(), cNodeCheckTimeout)
+		lbelongsToPool := _pool.tryNomadNode(lctx, nomadNode)
+		lcancel()
 
-		for _, lnomadNodeStub := range nodeList {
-			lnqoptions := &nomad.QueryOptions{AllowStale: _stalecnf.Allow}
-			nomadNode, lmeta, lerr := _nomadClient.Nodes().Info(lnomadNodeStub.ID, nil)
+		if lbelongsToPool {
+			lnqoptions := nomad.QueryOptions{Namespace: nomad.AllNamespacesNamespace, AllowStale: _stalecnf.Allow}
+			nomadNodeAllocations, lmeta, lerr := _nomadClient.Nodes().Allocations(lnomadNodeStub.ID, &lnqoptions)
 			if lerr == nil {
 				if _stalecnf.Allow {
 					if lmeta.LastContact > _stalecnf.StaleAllowedDuration {
 						lnqoptions.AllowStale = false
-						nomadNode, _, lerr = _nomadClient.Nodes().Info(lnomadNodeStub.ID, nil)
+						nomadNodeAllocations, _, lerr = _nomadClient.Nodes().Allocations(lnomadNodeStub.ID, &lnqoptions)
 					}
 				}
 			}
 			if lerr != nil {
-				return nil, 0, fmt.Errorf("can't get nomad node %s info due: %s", lnomadNodeStub.ID, lerr)
+				return fmt.Errorf("can't get nomad allocations on node %s due: %s", lnomadNodeStub.ID, lerr)
 			}
 
-			if pool.tryNomadNode(nomadNode) {
-				lnqoptions := nomad.QueryOptions{Namespace: nomad.AllNamespacesNamespace, AllowStale: _stalecnf.Allow}
-				nomadNodeAllocations, lmeta, lerr := _nomadClient.Nodes().Allocations(lnomadNodeStub.ID, &lnqoptions)
-				if lerr == nil {
-					if _stalecnf.Allow {
-						if lmeta.LastContact > _stalecnf.StaleAllowedDuration {
-							lnqoptions.AllowStale = false
-							nomadNodeAllocations, _, lerr = _nomadClient.Nodes().Allocations(lnomadNodeStub.ID, &lnqoptions)
-						}
-					}
-				}
-				if lerr != nil {
-					return nil, 0, fmt.Errorf("can't get nomad allocations on node %s due: %s", lnomadNodeStub.ID, lerr)
-				}
-
-				for _, alloc := range nomadNodeAllocations {
-					pool.tryNomadAllocation(alloc)
-				}
+			for _, alloc := range nomadNodeAllocations {
+				_pool.tryNomadAllocation(alloc)
 			}
 		}
 	}
 
-	return lpools, queryMeta.LastIndex, nil
+	return nil
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Pramod-Devireddy/go-exprtk"
+)
+
+// окно, за которое считается скорость скейлинга пула
+const cScaleUpRateWindow = time.Hour
+
+// cAllowedFreexprVariables are variables that gc sets before allowed_freexpr evaluation
+var cAllowedFreexprVariables = []string{"totalnodes", "busynodes", "ephemeralnodes", "queuedallocs", "scaleuprate", "hour", "weekday", "nodecpu", "nodemem"}
+
+// PoolGCConfig is gc settings from gc block of pool, they override global ones, zero values are not overridden
+type PoolGCConfig struct {
+	CiclesToGc     int
+	CiclePeriod    time.Duration
+	AllowedFreexpr string
+}
+
+// FreexprVariables are values of allowed_freexpr variables for one pool
+type FreexprVariables struct {
+	TotalNodes     int
+	BusyNodes      int
+	EphemeralNodes int
+	QueuedAllocs   int
+	ScaleUpRate    int
+	Now            time.Time
+	NodeCpu        int
+	NodeMem        int
+}
+
+// newAllowedFreexpr compiles allowed_freexpr with all variables that gc sets
+func newAllowedFreexpr(_expr string) (*exprtk.GoExprtk, error) {
+	exprtkObj := exprtk.NewExprtk()
+	exprtkObj.SetExpression(_expr)
+	for _, lvariable := range cAllowedFreexprVariables {
+		exprtkObj.AddDoubleVariable(lvariable)
+	}
+
+	lerr := exprtkObj.CompileExpression()
+	if lerr != nil {
+		exprtkObj.Delete()
+		return nil, fmt.Errorf("can't compile expression: %s", lerr)
+	}
+
+	return &exprtkObj, nil
+}
+
+// evalAllowedFreexpr returns count of free nodes that pool may keep
+func evalAllowedFreexpr(_expr *exprtk.GoExprtk, _vars *FreexprVariables) int {
+	_expr.SetDoubleVariableValue("totalnodes", float64(_vars.TotalNodes))
+	_expr.SetDoubleVariableValue("busynodes", float64(_vars.BusyNodes))
+	_expr.SetDoubleVariableValue("ephemeralnodes", float64(_vars.EphemeralNodes))
+	_expr.SetDoubleVariableValue("queuedallocs", float64(_vars.QueuedAllocs))
+	_expr.SetDoubleVariableValue("scaleuprate", float64(_vars.ScaleUpRate))
+	_expr.SetDoubleVariableValue("hour", float64(_vars.Now.Hour()))
+	_expr.SetDoubleVariableValue("weekday", float64(_vars.Now.Weekday()))
+	_expr.SetDoubleVariableValue("nodecpu", float64(_vars.NodeCpu))
+	_expr.SetDoubleVariableValue("nodemem", float64(_vars.NodeMem))
+
+	return int(_expr.GetEvaluatedValue())
+}
+
+func parsePoolGCConfig(_v Variant) (*PoolGCConfig, error) {
+	if _v.GetType() != VariantTypeMap {
+		return nil, fmt.Errorf("gc must be map")
+	}
+
+	lconfig := &PoolGCConfig{}
+	for lkey, lvalue := range _v.GetMapValue() {
+		switch lkey {
+		case "cicles_to_gc":
+			if lvalue.GetType() != VariantTypeInt || *lvalue.GetIntValue() <= 0 {
+				return nil, fmt.Errorf("cicles_to_gc must be positive int")
+			}
+			lconfig.CiclesToGc = *lvalue.GetIntValue()
+
+		case "cicle_period":
+			if lvalue.GetType() != VariantTypeString {
+				return nil, fmt.Errorf("cicle_period must be duration string")
+			}
+
+			lperiod, lerr := time.ParseDuration(*lvalue.GetStringValue())
+			if lerr != nil || lperiod <= 0 {
+				return nil, fmt.Errorf("cicle_period must be positive duration")
+			}
+			lconfig.CiclePeriod = lperiod
+
+		case "allowed_freexpr":
+			if lvalue.GetType() != VariantTypeString {
+				return nil, fmt.Errorf("allowed_freexpr must be string")
+			}
+
+			lexpr, lerr := newAllowedFreexpr(*lvalue.GetStringValue())
+			if lerr != nil {
+				return nil, fmt.Errorf("wrong allowed_freexpr: %s", lerr)
+			}
+			lexpr.Delete()
+			lconfig.AllowedFreexpr = *lvalue.GetStringValue()
+
+		default:
+			return nil, fmt.Errorf("unknown key %q in gc", lkey)
+		}
+	}
+
+	return lconfig, nil
+}
+
+// FreexprCache keeps compiled allowed_freexpr of pools by expression text, so expression is compiled once and is
+// not compiled again when pool config is reloaded
+type FreexprCache map[string]*exprtk.GoExprtk
+
+func (c FreexprCache) Get(_expr string) (*exprtk.GoExprtk, error) {
+	if lexpr, lok := c[_expr]; lok {
+		return lexpr, nil
+	}
+
+	lexpr, lerr := newAllowedFreexpr(_expr)
+	if lerr != nil {
+		return nil, lerr
+	}
+	c[_expr] = lexpr
+
+	return lexpr, nil
+}
+
+// Retain frees compiled expressions that are not in _used, they are left from pools that were removed or whose
+// allowed_freexpr was changed on reload
+func (c FreexprCache) Retain(_used map[*exprtk.GoExprtk]bool) {
+	for lexprText, lexpr := range c {
+		if !_used[lexpr] {
+			lexpr.Delete()
+			delete(c, lexprText)
+		}
+	}
+}
+
+// ForPool returns gc settings of pool: global ones, overridden by gc block of pool spec
+func (c *GarbageCollectorConfig) ForPool(_spec *PoolNodeSpec, _exprs FreexprCache) (*GarbageCollectorConfig, error) {
+	lconfig := *c
+	if _spec == nil {
+		return &lconfig, nil
+	}
+
+	lpoolConfig, lerr := _spec.GetGCConfig()
+	if lerr != nil || lpoolConfig == nil {
+		return &lconfig, lerr
+	}
+
+	if lpoolConfig.CiclesToGc > 0 {
+		lconfig.CiclesToGc = lpoolConfig.CiclesToGc
+	}
+
+	if lpoolConfig.CiclePeriod > 0 {
+		lconfig.CiclePeriod = lpoolConfig.CiclePeriod
+	}
+
+	if lpoolConfig.AllowedFreexpr != "" {
+		lexpr, lerr := _exprs.Get(lpoolConfig.AllowedFreexpr)
+		if lerr != nil {
+			return &lconfig, lerr
+		}
+		lconfig.AllowedFreexpr = lexpr
+	}
+
+	return &lconfig, nil
+}
+
+// queuedAllocsByPools returns count of allocations of queued scaling events, that wait for nodes of pools
+func queuedAllocsByPools(_queue *Queue[*ScalingEvent]) map[string]int {
+	lqueued := make(map[string]int)
+	if _queue == nil {
+		return lqueued
+	}
+
+	for _, lscalingEvent := range _queue.Items() {
+		for _, ltgInfo := range lscalingEvent.UnAllocatedTg {
+			if ltgInfo.PoolInfo != nil {
+				lqueued[ltgInfo.PoolInfo.GetFullName()] += ltgInfo.UnAllocCount
+			}
+		}
+	}
+
+	return lqueued
+}
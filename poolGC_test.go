@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pramod-Devireddy/go-exprtk"
+)
+
+func TestPoolGCConfig(t *testing.T) {
+	lpoolSpecs, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 2000
+  mem: 4096
+  gc:
+    cicles_to_gc: 2
+    cicle_period: 30s
+    allowed_freexpr: "ceil(queuedallocs / 4) + ephemeralnodes + if(weekday >= 1 and weekday <= 5 and hour >= 8, nodecpu / 1000, 0)"
+  provider:
+    name: anynode
+- datacenter: test
+  cpu: 1000
+  mem: 100
+  provider:
+    name: anynode
+`))
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lglobalExpr, lerr := newAllowedFreexpr("busynodes")
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lgcconfig := &GarbageCollectorConfig{CiclesToGc: 5, CiclePeriod: time.Minute, AllowedFreexpr: lglobalExpr}
+	lexprs := FreexprCache{}
+
+	lpoolgcconfig, lerr := lgcconfig.ForPool(lpoolSpecs[0], lexprs)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if lpoolgcconfig.CiclesToGc != 2 || lpoolgcconfig.CiclePeriod != 30*time.Second || lpoolgcconfig.AllowedFreexpr == lglobalExpr {
+		t.Fatalf("gc settings of pool must override global ones, got %+v", lpoolgcconfig)
+	}
+
+	if lgcconfig.CiclesToGc != 5 || lgcconfig.CiclePeriod != time.Minute {
+		t.Fatalf("global gc settings must not change, got %+v", lgcconfig)
+	}
+
+	// выражение компилируется один раз
+	if lagain, _ := lgcconfig.ForPool(lpoolSpecs[0], lexprs); lagain.AllowedFreexpr != lpoolgcconfig.AllowedFreexpr || len(lexprs) != 1 {
+		t.Fatalf("compiled expression must be reused")
+	}
+
+	lmonday, _ := time.Parse(time.RFC3339, "2024-01-15T09:00:00Z")
+	lsunday, _ := time.Parse(time.RFC3339, "2024-01-14T09:00:00Z")
+	for _, lcase := range []struct {
+		vars *FreexprVariables
+		free int
+	}{
+		{&FreexprVariables{Now: lmonday, NodeCpu: 2000}, 2},
+		{&FreexprVariables{Now: lsunday, NodeCpu: 2000}, 0},
+		{&FreexprVariables{Now: lsunday, NodeCpu: 2000, QueuedAllocs: 5, EphemeralNodes: 1}, 3},
+	} {
+		if lfree := evalAllowedFreexpr(lpoolgcconfig.AllowedFreexpr, lcase.vars); lfree != lcase.free {
+			t.Fatalf("%d free nodes expected for %+v, got %d", lcase.free, lcase.vars, lfree)
+		}
+	}
+
+	lpoolgcconfig, lerr = lgcconfig.ForPool(lpoolSpecs[1], lexprs)
+	if lerr != nil || lpoolgcconfig.CiclesToGc != 5 || lpoolgcconfig.CiclePeriod != time.Minute || lpoolgcconfig.AllowedFreexpr != lglobalExpr {
+		t.Fatalf("pool without gc must use global settings, got %+v: %v", lpoolgcconfig, lerr)
+	}
+
+	// выражение пула, которого уже нет, освобождается, используемые остаются
+	if _, lerr := lexprs.Get("totalnodes - busynodes"); lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lusedExpr, _ := lexprs.Get("ceil(queuedallocs / 4) + ephemeralnodes + if(weekday >= 1 and weekday <= 5 and hour >= 8, nodecpu / 1000, 0)")
+	lexprs.Retain(map[*exprtk.GoExprtk]bool{lusedExpr: true, lglobalExpr: true})
+	if len(lexprs) != 1 || lexprs["totalnodes - busynodes"] != nil {
+		t.Fatalf("only used expression must be kept, got %v", lexprs)
+	}
+
+	if lagain, _ := lgcconfig.ForPool(lpoolSpecs[0], lexprs); lagain.AllowedFreexpr != lusedExpr {
+		t.Fatalf("used expression must not be compiled again")
+	}
+}
+
+func TestPoolGCConfigWrong(t *testing.T) {
+	for _, lcase := range []struct {
+		gc  string
+		err string
+	}{
+		{"cicles_to_gc: 0", "cicles_to_gc must be positive int"},
+		{"cicle_period: 10", "cicle_period must be duration string"},
+		{"cicle_period: -1m", "cicle_period must be positive duration"},
+		{"allowed_freexpr: \"unknownvar + 1\"", "wrong allowed_freexpr"},
+		{"remove_timeout: 1m", "unknown key \"remove_timeout\" in gc"},
+	} {
+		_, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 100
+  gc:
+    `+lcase.gc+`
+  provider:
+    name: anynode
+`))
+		if lerr == nil || !strings.Contains(lerr.Error(), lcase.err) {
+			t.Fatalf("error %q expected for %q, got %v", lcase.err, lcase.gc, lerr)
+		}
+	}
+}
+
+func TestPoolScaleUpRate(t *testing.T) {
+	lnow := time.Now()
+	lpool := &Pool{scaleUps: []*PoolScaleUp{
+		{Time: lnow.Add(-2 * time.Hour), Nodes: 10},
+		{Time: lnow.Add(-30 * time.Minute), Nodes: 3},
+		{Time: lnow.Add(-time.Minute), Nodes: 2},
+	}}
+
+	if lrate := lpool.ScaleUpRate(lnow); lrate != 5 {
+		t.Fatalf("5 nodes requested during last hour expected, got %d", lrate)
+	}
+
+	if len(lpool.scaleUps) != 2 {
+		t.Fatalf("old scale ups must be forgotten, got %d", len(lpool.scaleUps))
+	}
+}
+
+func TestQueuedAllocsByPools(t *testing.T) {
+	lspecA := &PoolNodeSpec{FullName: "a"}
+	lspecB := &PoolNodeSpec{FullName: "b"}
+
+	lqueue := NewQueue[*ScalingEvent]()
+	lqueue.Enqueue(&ScalingEvent{Id: "default/job1", UnAllocatedTg: map[string]*ScalingEventTgInfo{
+		"web": {UnAllocCount: 3, PoolInfo: lspecA},
+		"db":  {UnAllocCount: 1, PoolInfo: lspecB},
+	}}, "default/job1")
+	lqueue.Enqueue(&ScalingEvent{Id: "default/job2", UnAllocatedTg: map[string]*ScalingEventTgInfo{
+		"web": {UnAllocCount: 2, PoolInfo: lspecA},
+	}}, "default/job2")
+
+	lqueued := queuedAllocsByPools(lqueue)
+	if lqueued["a"] != 5 || lqueued["b"] != 1 {
+		t.Fatalf("5 allocs in pool a and 1 in pool b expected, got %v", lqueued)
+	}
+}
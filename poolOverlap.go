@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/helper/uuid"
+	"github.com/hashicorp/nomad/nomad/state"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/hashicorp/nomad/scheduler"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider"
+)
+
+// PoolOverlap is pair of pools(indexes in pool specs list) that scaler can't tell apart
+type PoolOverlap struct {
+	Index      int
+	OtherIndex int
+	Msg        string
+}
+
+// pinningTaskGroup returns task group with constraints, drivers and devices of node, so it fits only nodes
+// that have at least the same properties
+func pinningTaskGroup(_node *structs.Node) (*structs.TaskGroup, []*structs.Constraint, map[string]struct{}) {
+	lconstraints := []*structs.Constraint{}
+	if _node.NodeClass != "" {
+		lconstraints = append(lconstraints, &structs.Constraint{LTarget: "${node.class}", RTarget: _node.NodeClass, Operand: "="})
+	}
+	for lname, lvalue := range _node.Attributes {
+		lconstraints = append(lconstraints, &structs.Constraint{LTarget: "${attr." + lname + "}", RTarget: lvalue, Operand: "="})
+	}
+	for lname, lvalue := range _node.Meta {
+		lconstraints = append(lconstraints, &structs.Constraint{LTarget: "${meta." + lname + "}", RTarget: lvalue, Operand: "="})
+	}
+
+	ldrivers := map[string]struct{}{}
+	for ldriver := range _node.Drivers {
+		ldrivers[ldriver] = struct{}{}
+	}
+
+	ltask := &structs.Task{Name: "pin", Resources: &structs.Resources{}}
+	for _, ldevice := range _node.NodeResources.Devices {
+		if len(ldevice.Instances) == 0 { // такой девайс не может запросить ни одна джоба
+			continue
+		}
+
+		ltask.Resources.Devices = append(ltask.Resources.Devices, &structs.RequestedDevice{
+			Name:  fmt.Sprintf("%s/%s/%s", ldevice.Vendor, ldevice.Type, ldevice.Name),
+			Count: 1,
+		})
+	}
+
+	return &structs.TaskGroup{Name: "pin", Tasks: []*structs.Task{ltask}}, lconstraints, ldrivers
+}
+
+// findDuplicatePools detects pools with the same full name(size and compute class), pools are kept by full name,
+// so such pool would silently replace other one
+func findDuplicatePools(_poolSpecs []*PoolNodeSpec) []*PoolOverlap {
+	lduplicates := []*PoolOverlap{}
+	lfullNames := map[string]int{}
+
+	for li, lpoolSpec := range _poolSpecs {
+		if lj, lok := lfullNames[lpoolSpec.GetFullName()]; lok {
+			lduplicates = append(lduplicates, &PoolOverlap{
+				Index:      lj,
+				OtherIndex: li,
+				Msg:        fmt.Sprintf("pool %s is the same as other pool, pools must differ in size or in properties of nodes", lpoolSpec.GetFullName()),
+			})
+		} else {
+			lfullNames[lpoolSpec.GetFullName()] = li
+		}
+	}
+
+	return lduplicates
+}
+
+// checkDuplicatePools returns error if some pools are the same, scaler can't run with such pools
+func checkDuplicatePools(_poolSpecs []*PoolNodeSpec) error {
+	if lduplicates := findDuplicatePools(_poolSpecs); len(lduplicates) > 0 {
+		return fmt.Errorf("%s", lduplicates[0].Msg)
+	}
+
+	return nil
+}
+
+// findPoolOverlaps detects pools of the same size, where job constrained to one of them fits other too, so
+// scaler may choose any of them. Also detects pools whose providers claim the same nodes, as nomad node is
+// given to first pool whose provider claims it
+func findPoolOverlaps(_poolSpecs []*PoolNodeSpec) []*PoolOverlap {
+	plan := &structs.Plan{
+		EvalID:          uuid.Generate(),
+		NodeUpdate:      make(map[string][]*structs.Allocation),
+		NodeAllocation:  make(map[string][]*structs.Allocation),
+		NodePreemptions: make(map[string][]*structs.Allocation),
+	}
+
+	logger := hclog.L().Named("binpaking")
+	config := &state.StateStoreConfig{Logger: logger, Region: "global"}
+	state, _ := state.NewStateStore(config)
+	evlCtx := scheduler.NewEvalContext(nil, state, plan, logger)
+
+	constraintChecker := scheduler.NewConstraintChecker(evlCtx, nil)
+	driversChecker := scheduler.NewDriverChecker(evlCtx, nil)
+	deviceChecker := scheduler.NewDeviceChecker(evlCtx)
+
+	lnodes := make([]*structs.Node, 0, len(_poolSpecs))
+	for _, lpoolSpec := range _poolSpecs {
+		lnodes = append(lnodes, lpoolSpec.GetNode(""))
+	}
+
+	fits := func(_pinned *structs.Node, _node *structs.Node) bool {
+		ltg, lconstraints, ldrivers := pinningTaskGroup(_pinned)
+		constraintChecker.SetConstraints(lconstraints)
+		driversChecker.SetDrivers(ldrivers)
+		deviceChecker.SetTaskGroup(ltg)
+
+		evlCtx.Reset()
+		return constraintChecker.Feasible(_node) && driversChecker.Feasible(_node) && deviceChecker.Feasible(_node)
+	}
+
+	loverlaps := []*PoolOverlap{}
+	lidentities := map[string]int{}
+
+	for li, lpoolSpec := range _poolSpecs {
+		lres := lpoolSpec.GetResources()
+
+		for lj := 0; lj < li; lj++ {
+			lother := _poolSpecs[lj]
+			lotherRes := lother.GetResources()
+			// одинаковые пулы - ошибка, их находит findDuplicatePools
+			if lother.GetFullName() == lpoolSpec.GetFullName() || lnodes[li].Datacenter != lnodes[lj].Datacenter ||
+				lres.Cpu != lotherRes.Cpu || lres.MemMB != lotherRes.MemMB || lres.DiskMB != lotherRes.DiskMB {
+				continue
+			}
+
+			if fits(lnodes[lj], lnodes[li]) || fits(lnodes[li], lnodes[lj]) {
+				loverlaps = append(loverlaps, &PoolOverlap{
+					Index:      lj,
+					OtherIndex: li,
+					Msg:        fmt.Sprintf("pools %s and %s have the same size and job constrained to one of them fits other too", lother.GetFullName(), lpoolSpec.GetFullName()),
+				})
+			}
+		}
+
+		lproviderVariant, lok := lpoolSpec.Attributes["provider"]
+		if !lok || lproviderVariant.GetType() != VariantTypeMap {
+			continue
+		}
+
+		lprovider := lproviderVariant.GetMapValue()
+		if lproviderName, lok := lprovider["name"]; lok && lproviderName.GetType() == VariantTypeString {
+			var lparams interface{}
+			if lparamsVariant, lok := lprovider["params"]; lok {
+				lparams = variantToTypes(lparamsVariant)
+			}
+
+			lidentity := nodeprovider.GetProviderIdentity(*lproviderName.GetStringValue(), lparams)
+			if lidentity == "" {
+				continue
+			}
+
+			if lj, lok := lidentities[lidentity]; lok {
+				if _poolSpecs[lj].GetFullName() != lpoolSpec.GetFullName() {
+					loverlaps = append(loverlaps, &PoolOverlap{
+						Index:      lj,
+						OtherIndex: li,
+						Msg:        fmt.Sprintf("pools %s and %s have the same provider(%s), so they claim the same nodes", _poolSpecs[lj].GetFullName(), lpoolSpec.GetFullName(), lidentity),
+					})
+				}
+			} else {
+				lidentities[lidentity] = li
+			}
+		}
+	}
+
+	return loverlaps
+}
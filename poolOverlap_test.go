@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindPoolOverlaps(t *testing.T) {
+	lpath := writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: x86
+  provider:
+    name: awsautoscale
+    params:
+      - asg-a
+- datacenter: test
+  cpu: 2000
+  mem: 2Gib
+  attr.cpu.arch: x86
+  provider:
+    name: awsautoscale
+    params:
+      - asg-a
+- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: x86
+  attr.kernel.name: linux
+  provider:
+    name: awsautoscale
+    params:
+      - asg-b
+- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: arm64
+  provider:
+    name: awsautoscale
+    params:
+      - asg-c
+- datacenter: other
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: x86
+  provider:
+    name: awsautoscale
+    params:
+      - asg-d
+`)
+
+	lpoolSpecs, lerr := parsePoolDifinition(lpath)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	loverlaps := findPoolOverlaps(lpoolSpecs)
+	if len(loverlaps) != 2 {
+		t.Fatalf("expected 2 overlaps, got %d", len(loverlaps))
+	}
+
+	if loverlaps[0].Index != 0 || loverlaps[0].OtherIndex != 1 || !strings.Contains(loverlaps[0].Msg, "same provider(asg asg-a)") {
+		t.Fatalf("pools with the same asg must overlap, got: %d, %d, %s", loverlaps[0].Index, loverlaps[0].OtherIndex, loverlaps[0].Msg)
+	}
+
+	if loverlaps[1].Index != 0 || loverlaps[1].OtherIndex != 2 || !strings.Contains(loverlaps[1].Msg, "same size") {
+		t.Fatalf("pool with more attributes of the same size must overlap, got: %d, %d, %s", loverlaps[1].Index, loverlaps[1].OtherIndex, loverlaps[1].Msg)
+	}
+}
+
+func TestFindDuplicatePools(t *testing.T) {
+	lpath := writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: x86
+  provider:
+    name: awsautoscale
+    params:
+      - asg-a
+- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: arm64
+  provider:
+    name: awsautoscale
+    params:
+      - asg-b
+- name: same
+  datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  attr.cpu.arch: x86
+  min: 1
+  provider:
+    name: awsautoscale
+    params:
+      - asg-a
+`)
+
+	lpoolSpecs, lerr := parsePoolDifinition(lpath)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lduplicates := findDuplicatePools(lpoolSpecs)
+	if len(lduplicates) != 1 || lduplicates[0].Index != 0 || lduplicates[0].OtherIndex != 2 {
+		t.Fatalf("pools different only in name and min must be the same, got: %v", lduplicates)
+	}
+
+	if checkDuplicatePools(lpoolSpecs) == nil {
+		t.Fatal("duplicate pools must be an error")
+	}
+
+	if loverlaps := findPoolOverlaps(lpoolSpecs); len(loverlaps) != 0 {
+		t.Fatalf("duplicate pools must not be reported as overlap, got: %d", len(loverlaps))
+	}
+
+	if checkDuplicatePools(lpoolSpecs[:2]) != nil {
+		t.Fatal("different pools must not be an error")
+	}
+}
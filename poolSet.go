@@ -0,0 +1,177 @@
+package main
+
+import (
+	"sync"
+)
+
+// PoolSet is current pools of scaler, on config reload pools are replaced, so long living threads must not keep
+// pools map, but take it from PoolSet every time they need it
+type PoolSet struct {
+	lock     sync.RWMutex
+	pools    map[string]*Pool
+	specs    []*PoolNodeSpec
+	maxNodes int
+	// пулы, убранные перезагрузкой, чьи ноды еще дренирует gc
+	retired map[string]*Pool
+
+	// сериализует запросы нод всеми пулами, чтобы параллельные скейлинги не превысили общий лимит
+	budgetLock sync.Mutex
+}
+
+func NewPoolSet(_pools map[string]*Pool, _specs []*PoolNodeSpec) *PoolSet {
+	lpoolSet := &PoolSet{
+		pools:   _pools,
+		specs:   _specs,
+		retired: map[string]*Pool{},
+	}
+
+	for _, lpool := range _pools {
+		lpool.poolSet = lpoolSet
+	}
+
+	return lpoolSet
+}
+
+// SetMaxNodes sets cap of nodes across all pools, 0 means no cap
+func (s *PoolSet) SetMaxNodes(_maxNodes int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.maxNodes = _maxNodes
+}
+
+// lockBudget returns how many nodes _pool may have by global cap(-1 if there is no cap), nodes of other pools
+// are counted with ephemeral ones. Must be followed by unlockBudget after _pool added its ephemeral nodes
+func (s *PoolSet) lockBudget(_pool *Pool) int {
+	s.budgetLock.Lock()
+
+	s.lock.RLock()
+	lmaxNodes := s.maxNodes
+	lpools := make([]*Pool, 0, len(s.pools))
+	for _, lpool := range s.pools {
+		lpools = append(lpools, lpool)
+	}
+	s.lock.RUnlock()
+
+	if lmaxNodes <= 0 {
+		return -1
+	}
+
+	lotherNodes := 0
+	for _, lpool := range lpools {
+		if lpool != _pool {
+			lotherNodes += lpool.Size()
+		}
+	}
+
+	return max(lmaxNodes-lotherNodes, 0)
+}
+
+func (s *PoolSet) unlockBudget() {
+	s.budgetLock.Unlock()
+}
+
+// Pools returns snapshot of pools, which will not be changed by reload
+func (s *PoolSet) Pools() map[string]*Pool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	lpools := make(map[string]*Pool, len(s.pools))
+	for lpoolName, lpool := range s.pools {
+		lpools[lpoolName] = lpool
+	}
+
+	return lpools
+}
+
+func (s *PoolSet) Get(_name string) (*Pool, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	lpool, lok := s.pools[_name]
+	return lpool, lok
+}
+
+func (s *PoolSet) Specs() []*PoolNodeSpec {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.specs
+}
+
+// Spec returns current spec of pool by full name, nil if there is no such pool
+func (s *PoolSet) Spec(_fullName string) *PoolNodeSpec {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, lspec := range s.specs {
+		if lspec.GetFullName() == _fullName {
+			return lspec
+		}
+	}
+
+	return nil
+}
+
+// SpecByShortName returns spec of pool by name given to it in pool configuration, nil if there is no such pool
+func (s *PoolSet) SpecByShortName(_name string) *PoolNodeSpec {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, lspec := range s.specs {
+		if lspec.GetShortName() == _name {
+			return lspec
+		}
+	}
+
+	return nil
+}
+
+// Replace sets new pools and their specs at once
+func (s *PoolSet) Replace(_pools map[string]*Pool, _specs []*PoolNodeSpec) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pools = _pools
+	s.specs = _specs
+
+	// пул вернули в конфиг, теперь его ноды достанутся новому пулу
+	for lpoolName := range _pools {
+		delete(s.retired, lpoolName)
+	}
+
+	for _, lpool := range _pools {
+		if lpool.poolSet != s {
+			lpool.poolSet = s
+		}
+	}
+}
+
+// Retire keeps retired _pool receiving updates of its nomad nodes, so gc can track drains of them
+func (s *PoolSet) Retire(_pool *Pool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.retired[_pool.GetName()] = _pool
+}
+
+// Forget drops retired pool, when gc has no more nodes of it to remove
+func (s *PoolSet) Forget(_name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.retired, _name)
+}
+
+// Retired returns snapshot of retired pools whose nodes gc still removes
+func (s *PoolSet) Retired() map[string]*Pool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	lpools := make(map[string]*Pool, len(s.retired))
+	for lpoolName, lpool := range s.retired {
+		lpools[lpoolName] = lpool
+	}
+
+	return lpools
+}
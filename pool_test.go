@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider"
+)
+
+func testPoolNodeSpec() *PoolNodeSpec {
+	return NewPoolNodeSpec(map[string]Variant{"cpu": NewVariantIntValue(1000), "mem": NewVariantIntValue(1024)})
+}
+
+func TestPoolDryRun(t *testing.T) {
+	// без провайдера, любое обращение к нему упадет
+	lpool := &Pool{
+		logger:   hclog.L(),
+		fullName: "workers",
+		nomadNodes: map[string]*structs.Node{
+			"node-1": {ID: "node-1"},
+		},
+		nomadAllocs:  map[string]*structs.Allocation{},
+		poolnodespec: testPoolNodeSpec(),
+	}
+	lpool.SetDryRun(true)
+
+	lerr := lpool.Update(context.Background(), []*structs.Node{{ID: "ephemeral-node"}}, []*structs.Allocation{{ID: "ephemeral-alloc"}})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if len(lpool.ephemeralnomadNodes) != 0 || len(lpool.ephemeralnomadAllocs) != 0 {
+		t.Fatalf("dry run must not leave ephemeral nodes or allocs in pool")
+	}
+
+	lpool.WarmUp(2)
+
+	lresults := lpool.RemoveNode(context.Background(), []string{"node-1", "unknown-node"})
+	if lresults["node-1"].Status != nodeprovider.RemoveNodeStatusRemoved || lresults["unknown-node"].Status != nodeprovider.RemoveNodeStatusNotFound {
+		t.Fatalf("wrong remove results: %v", lresults)
+	}
+
+	lactions := lpool.GetDryRunActions()
+	if len(lactions) != 3 || lactions[0].Action != "update" || lactions[0].Nodes != 1 || lactions[1].Action != "warmup" || lactions[1].Nodes != 2 || lactions[2].Action != "remove" || lactions[2].NodeIds[0] != "node-1" {
+		t.Fatalf("wrong dry run actions: %+v", lactions)
+	}
+}
+
+func TestPoolNodeBounds(t *testing.T) {
+	lnewPool := func(_name string, _maxNodes int, _nodes ...string) *Pool {
+		lpool := &Pool{
+			logger:       hclog.L(),
+			fullName:     _name,
+			nomadNodes:   map[string]*structs.Node{},
+			nomadAllocs:  map[string]*structs.Allocation{},
+			poolnodespec: testPoolNodeSpec(),
+			maxNodes:     _maxNodes,
+		}
+		for _, lnodeId := range _nodes {
+			lpool.nomadNodes[lnodeId] = &structs.Node{ID: lnodeId}
+		}
+		lpool.SetDryRun(true)
+
+		return lpool
+	}
+
+	lworkers := lnewPool("workers", 3, "node-1")
+	lgpu := lnewPool("gpu", 0, "node-2", "node-3")
+	lpools := NewPoolSet(map[string]*Pool{"workers": lworkers, "gpu": lgpu}, nil)
+
+	// max пула: из 3 новых нод можно только 2, аллокация на отброшенной ноде тоже отбрасывается
+	lerr := lworkers.Update(context.Background(),
+		[]*structs.Node{{ID: "en-1"}, {ID: "en-2"}, {ID: "en-3"}},
+		[]*structs.Allocation{{ID: "ea-1", NodeID: "en-1"}, {ID: "ea-3", NodeID: "en-3"}})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	// общий лимит: в dry run ноды не добавляются, у workers 1 нода, значит пулу gpu осталось 2, а у него уже 2
+	lpools.SetMaxNodes(3)
+	lerr = lgpu.Update(context.Background(), []*structs.Node{{ID: "en-4"}}, nil)
+	if lerr == nil {
+		t.Fatalf("pool without room must not be scaled")
+	}
+
+	lpools.SetMaxNodes(5)
+	lerr = lgpu.Update(context.Background(), []*structs.Node{{ID: "en-4"}, {ID: "en-5"}}, nil)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if lworkers.WarmUp(5) != true {
+		t.Fatalf("warmup must be clamped, not rejected")
+	}
+
+	lworkersActions := lworkers.GetDryRunActions()
+	if len(lworkersActions) != 2 || lworkersActions[0].Nodes != 2 || lworkersActions[1].Nodes != 2 {
+		t.Fatalf("wrong clamped actions of workers: %+v", lworkersActions)
+	}
+
+	lgpuActions := lgpu.GetDryRunActions()
+	if len(lgpuActions) != 1 || lgpuActions[0].Nodes != 2 {
+		t.Fatalf("wrong clamped actions of gpu: %+v", lgpuActions)
+	}
+}
+
+// noCapacityProvider accepts any size, but never adds nodes
+type noCapacityProvider struct {
+	reason string
+}
+
+func (p *noCapacityProvider) IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error) {
+	return false, nil
+}
+
+func (p *noCapacityProvider) RemoveNode(_ctx context.Context, _nomadNodes []*nomad.Node) nodeprovider.RemoveNodeResults {
+	return nodeprovider.NewRemoveNodeResults(_nomadNodes, nodeprovider.RemoveNodeStatusNotFound, nil)
+}
+
+func (p *noCapacityProvider) UpdateNode(_ctx context.Context, _nodes []*structs.Node, _totalcount int32) error {
+	return nil
+}
+
+func (p *noCapacityProvider) InsufficientCapacity(_ctx context.Context, _since time.Time) (string, error) {
+	return p.reason, nil
+}
+
+func TestPoolStalled(t *testing.T) {
+	lpool := &Pool{
+		logger:             hclog.L(),
+		fullName:           "spot",
+		nomadNodes:         map[string]*structs.Node{},
+		nomadAllocs:        map[string]*structs.Allocation{},
+		scaledNodesReadyAt: map[string]time.Time{},
+		nodeProvider:       &noCapacityProvider{},
+	}
+
+	lnodes := []*structs.Node{{ID: "en-1"}, {ID: "en-2"}}
+	lallocs := []*structs.Allocation{
+		{ID: "ea-1", NodeID: "en-1", TaskGroup: "app"},
+		{ID: "ea-2", NodeID: "en-1", TaskGroup: "app"},
+		{ID: "ea-3", NodeID: "en-2", TaskGroup: "worker"},
+	}
+
+	lerr := lpool.UpdateWithFallback(context.Background(), lnodes, lallocs, 50*time.Millisecond, nil)
+
+	var lstalled *PoolStalledError
+	if !errors.As(lerr, &lstalled) {
+		t.Fatalf("pool without new nodes must stall, got: %v", lerr)
+	}
+
+	if lstalled.Unplaced["app"] != 2 || lstalled.Unplaced["worker"] != 1 {
+		t.Fatalf("wrong unplaced allocs: %v", lstalled.Unplaced)
+	}
+
+	if len(lpool.ephemeralnomadNodes) != 0 || len(lpool.ephemeralnomadAllocs) != 0 {
+		t.Fatalf("stalled pool must not keep ephemeral nodes or allocs")
+	}
+}
+
+func TestPoolUpdateAccepted(t *testing.T) {
+	lpool := &Pool{
+		logger:             hclog.L(),
+		fullName:           "spot",
+		nomadNodes:         map[string]*structs.Node{},
+		nomadAllocs:        map[string]*structs.Allocation{},
+		scaledNodesReadyAt: map[string]time.Time{},
+		nodeProvider:       &noCapacityProvider{},
+		maxNodes:           1,
+	}
+
+	var lacceptedNodes []*structs.Node
+	var lacceptedAllocs []*structs.Allocation
+	lctx, lcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer lcancel()
+
+	// сохранять нужно только то, что пул запросил у провайдера после ограничения max
+	lpool.UpdateWithFallback(lctx,
+		[]*structs.Node{{ID: "en-1"}, {ID: "en-2"}},
+		[]*structs.Allocation{{ID: "ea-1", NodeID: "en-1"}, {ID: "ea-2", NodeID: "en-2"}},
+		0,
+		func(_en []*structs.Node, _ea []*structs.Allocation) {
+			lacceptedNodes, lacceptedAllocs = _en, _ea
+		})
+
+	if len(lacceptedNodes) != 1 || lacceptedNodes[0].ID != "en-1" || len(lacceptedAllocs) != 1 || lacceptedAllocs[0].ID != "ea-1" {
+		t.Fatalf("clamped nodes and allocs must be accepted, got %v %v", lacceptedNodes, lacceptedAllocs)
+	}
+}
+
+// warmUpProvider claims every node and remembers sizes that pool asked for
+type warmUpProvider struct {
+	noCapacityProvider
+	err    error
+	totals []int32
+}
+
+func (p *warmUpProvider) IsNodeExists(_ctx context.Context, _nomadNode *nomad.Node) (bool, error) {
+	return true, nil
+}
+
+func (p *warmUpProvider) UpdateNode(_ctx context.Context, _nodes []*structs.Node, _totalcount int32) error {
+	if _, lok := _ctx.Deadline(); !lok {
+		return errors.New("provider must be called with timeout")
+	}
+
+	p.totals = append(p.totals, _totalcount)
+	return p.err
+}
+
+func TestPoolWarmUp(t *testing.T) {
+	lprovider := &warmUpProvider{err: errors.New("no capacity")}
+	lpool := &Pool{
+		logger:             hclog.L(),
+		fullName:           "workers",
+		nomadNodes:         map[string]*structs.Node{"node-1": {ID: "node-1"}},
+		nomadAllocs:        map[string]*structs.Allocation{},
+		scaledNodesReadyAt: map[string]time.Time{},
+		poolnodespec:       testPoolNodeSpec(),
+		nodeProvider:       lprovider,
+		maxNodes:           3,
+	}
+
+	// прогрев ограничен max пула, при ошибке провайдера его ноды не остаются в пуле
+	if lpool.WarmUp(5) {
+		t.Fatalf("warmup must fail with provider error")
+	}
+
+	if len(lprovider.totals) != 1 || lprovider.totals[0] != 3 || len(lpool.ephemeralnomadNodes) != 0 {
+		t.Fatalf("warmup must be clamped and dropped on error, got sizes %v and %d ephemeral nodes", lprovider.totals, len(lpool.ephemeralnomadNodes))
+	}
+
+	lprovider.err = nil
+	lwarmedCh := make(chan bool)
+	go func() {
+		lwarmedCh <- lpool.WarmUp(2)
+	}()
+
+	for li := 0; lpool.Size() < 3; li++ {
+		if li > 100 {
+			t.Fatalf("warmup nodes must be ephemeral until they appear in nomad")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// пока ноды прогрева не появились, скейлинг не может превысить max
+	if lpool.Update(context.Background(), []*structs.Node{{ID: "en-1"}}, nil) == nil {
+		t.Fatalf("scaling must count nodes of warmup")
+	}
+
+	lpool.tryNomadNode(context.Background(), &nomad.Node{ID: "node-2", Status: nomad.NodeStatusReady})
+	lpool.tryNomadNode(context.Background(), &nomad.Node{ID: "node-3", Status: nomad.NodeStatusReady})
+
+	select {
+	case lwarmed := <-lwarmedCh:
+		if !lwarmed {
+			t.Fatalf("warmup must succeed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("warmup must end when its nodes appear")
+	}
+
+	if len(lpool.ephemeralnomadNodes) != 0 || lpool.Size() != 3 {
+		t.Fatalf("warmup nodes must be replaced by nomad nodes, got %d ephemeral and %d total", len(lpool.ephemeralnomadNodes), lpool.Size())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/nomad/helper/uuid"
@@ -14,6 +15,8 @@ import (
 	"github.com/mitchellh/hashstructure"
 )
 
+const cDefaultFallbackAfter = 5 * time.Minute
+
 // -----------------------------------------------------------------------------
 type PoolNodeSpecResources struct {
 	Cpu     int
@@ -58,6 +61,87 @@ func (n *PoolNodeSpec) GetResources() *PoolNodeSpecResources {
 	return lresources
 }
 
+// GetNodeBounds returns min and max nodes count of pool, 0 means no bound
+func (n *PoolNodeSpec) GetNodeBounds() (int, int) {
+	lbounds := [2]int{}
+
+	for li, lboundName := range []string{"min", "max"} {
+		if lboundVal, lok := n.Attributes[lboundName]; lok && lboundVal.GetType() == VariantTypeInt {
+			lbounds[li] = *lboundVal.GetIntValue()
+		}
+	}
+
+	return lbounds[0], lbounds[1]
+}
+
+// GetCost returns cost of one pool node per hour, false if cost not set
+func (n *PoolNodeSpec) GetCost() (float64, bool) {
+	lcost, lok := n.Attributes["cost"]
+	if !lok {
+		return 0, false
+	}
+
+	switch lcost.GetType() {
+	case VariantTypeInt:
+		return float64(*lcost.GetIntValue()), true
+	case VariantTypeFloat:
+		return *lcost.GetFloatValue(), true
+	}
+
+	return 0, false
+}
+
+// GetShortName returns name given to pool in pool configuration, empty if not set
+func (n *PoolNodeSpec) GetShortName() string {
+	if lname, lok := n.Attributes["name"]; lok && lname.GetType() == VariantTypeString {
+		return *lname.GetStringValue()
+	}
+
+	return ""
+}
+
+// GetFallback returns names of pools to fall back to, in order, and time without progress after which pool
+// considered stalled
+func (n *PoolNodeSpec) GetFallback() ([]string, time.Duration) {
+	lfallback := []string{}
+	if lfallbackVariant, lok := n.Attributes["fallback"]; lok && lfallbackVariant.GetType() == VariantTypeSlice {
+		for _, lnameVariant := range lfallbackVariant.GetSliceValue() {
+			if lnameVariant.GetType() == VariantTypeString {
+				lfallback = append(lfallback, *lnameVariant.GetStringValue())
+			}
+		}
+	}
+
+	lfallbackAfter := cDefaultFallbackAfter
+	if lafterVariant, lok := n.Attributes["fallback_after"]; lok && lafterVariant.GetType() == VariantTypeString {
+		if lafter, lerr := time.ParseDuration(*lafterVariant.GetStringValue()); lerr == nil {
+			lfallbackAfter = lafter
+		}
+	}
+
+	return lfallback, lfallbackAfter
+}
+
+// GetWarmWindows returns time windows, in which pool must have some free nodes
+func (n *PoolNodeSpec) GetWarmWindows() ([]*WarmWindow, error) {
+	lwarm, lok := n.Attributes["warm"]
+	if !lok {
+		return nil, nil
+	}
+
+	return parseWarmWindows(lwarm)
+}
+
+// GetGCConfig returns gc settings of pool, nil if pool uses global ones
+func (n *PoolNodeSpec) GetGCConfig() (*PoolGCConfig, error) {
+	lgc, lok := n.Attributes["gc"]
+	if !lok {
+		return nil, nil
+	}
+
+	return parsePoolGCConfig(lgc)
+}
+
 func (n *PoolNodeSpec) GetFullName() string {
 	return n.FullName
 }
@@ -67,7 +151,7 @@ func (n PoolNodeSpec) HashIncludeMap(field string, k, v interface{}) (bool, erro
 	case "Attributes":
 		as := k.(string)
 		switch as {
-		case "cpu", "mem", "disk":
+		case "cpu", "mem", "disk", "min", "max", "cost", "name", "fallback", "fallback_after", "warm", "gc": // не меняют ноды пула
 			return false, nil
 		}
 		return true, nil
@@ -525,7 +609,10 @@ func getSuitableNodes(_tgName string, _job *structs.Job, _nodes []*structs.Node)
 	return tgToNode
 }
 
-func GetOptimalPoolSpec(_job *structs.Job, _poolList []*PoolNodeSpec) map[string]*PoolNodeSpec {
+// GetOptimalPoolSpec selects pool for every task group of job. If some of suitable pools have cost, pool with
+// cheapest nodes for all _counts allocations of task group is selected(task group count if not in _counts),
+// otherwise smallest suitable pool
+func GetOptimalPoolSpec(_job *structs.Job, _poolList []*PoolNodeSpec, _counts map[string]int) map[string]*PoolNodeSpec {
 	lprevJobStatus := _job.Status
 	_job.Status = structs.JobStatusPending
 	defer func() {
@@ -577,6 +664,21 @@ func GetOptimalPoolSpec(_job *structs.Job, _poolList []*PoolNodeSpec) map[string
 		}
 	}
 
+	for _, ltg := range _job.TaskGroups {
+		if _, lok := lreturnPoolsNames[ltg.Name]; !lok { // ни один пул не подходит
+			continue
+		}
+
+		lcount := ltg.Count
+		if lqueued, lok := _counts[ltg.Name]; lok && lqueued > 0 {
+			lcount = lqueued
+		}
+
+		if lpoolName, lok := cheapestPoolName(_job, ltg, lcount, testNodes, poolsByNames); lok {
+			lreturnPoolsNames[ltg.Name] = lpoolName
+		}
+	}
+
 	retval := map[string]*PoolNodeSpec{}
 	for tgName, lpoolName := range lreturnPoolsNames {
 		retval[tgName] = nil
@@ -587,3 +689,36 @@ func GetOptimalPoolSpec(_job *structs.Job, _poolList []*PoolNodeSpec) map[string
 
 	return retval
 }
+
+// cheapestPoolName estimates nodes, that would be created in every suitable pool with cost for _count allocations
+// of task group, and returns pool where they cost less, false if no suitable pool have cost
+func cheapestPoolName(_job *structs.Job, _tg *structs.TaskGroup, _count int, _testNodes []*structs.Node, _poolsByNames map[string]*PoolNodeSpec) (string, bool) {
+	logger := hclog.L().Named("binpaking")
+
+	lbestPoolName := ""
+	lbestCost := 0.0
+
+	for _, ltestNode := range _testNodes {
+		lpoolSpec := _poolsByNames[ltestNode.ID]
+		lnodeCost, lok := lpoolSpec.GetCost()
+		if !lok {
+			continue
+		}
+
+		// в неподходящем пуле оценка нод никогда не закончится
+		if getSuitableNodes(_tg.Name, _job, []*structs.Node{ltestNode})[_tg.Name] == "" {
+			continue
+		}
+
+		lnodes, _ := estimateRequiredNodes(&Pool{fullName: lpoolSpec.GetFullName(), poolnodespec: lpoolSpec}, nil, nil, _job, _tg, _count)
+		lcost := float64(len(lnodes)) * lnodeCost
+		logger.Debug(fmt.Sprintf("task group %s/%s.%s(count %d) needs %d nodes of pool %s, cost %v", _job.Namespace, _job.ID, _tg.Name, _count, len(lnodes), lpoolSpec.GetFullName(), lcost))
+
+		if lbestPoolName == "" || lcost < lbestCost {
+			lbestPoolName = ltestNode.ID
+			lbestCost = lcost
+		}
+	}
+
+	return lbestPoolName, lbestPoolName != ""
+}
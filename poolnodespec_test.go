@@ -133,7 +133,7 @@ func TestGetOptimalPool(t *testing.T) {
 	nodes = append(nodes, mokeNodePoolNode(512, "arm64"))
 	nodes = append(nodes, mokeNodePoolNode(1024, "arm64"))
 
-	optimalNodes := GetOptimalPoolSpec(structsJob, nodes)
+	optimalNodes := GetOptimalPoolSpec(structsJob, nodes, nil)
 
 	for tgName, pool := range optimalNodes {
 		t.Logf("tg %s: %s", tgName, pool.GetName())
@@ -156,7 +156,7 @@ func TestGetOptimalPoolForBadDatacenter(t *testing.T) {
 	nodes = append(nodes, mokeNodePoolNode(512, "arm64"))
 	nodes = append(nodes, mokeNodePoolNode(1024, "arm64"))
 
-	optimalNodes := GetOptimalPoolSpec(structsJob, nodes)
+	optimalNodes := GetOptimalPoolSpec(structsJob, nodes, nil)
 
 	for tgName, pool := range optimalNodes {
 		t.Logf("tg %s: %s", tgName, pool.GetName())
@@ -205,7 +205,7 @@ func TestGetOptimalPoolSpecWithDevices(t *testing.T) {
 	}
 
 	structsJob := apiNomadJobToStructsJobV2(apiJob)
-	optimal := GetOptimalPoolSpec(structsJob, poolSpecs)
+	optimal := GetOptimalPoolSpec(structsJob, poolSpecs, nil)
 
 	if len(optimal) == 0 {
 		t.Fatalf("no optimal pool found")
@@ -234,7 +234,7 @@ func TestGetOptimalPoolSpecWithoutDevices(t *testing.T) {
 	}
 
 	structsJob := apiNomadJobToStructsJobV2(apiJob)
-	optimal := GetOptimalPoolSpec(structsJob, poolSpecs)
+	optimal := GetOptimalPoolSpec(structsJob, poolSpecs, nil)
 
 	if len(optimal) == 0 {
 		t.Fatalf("no optimal pool found")
@@ -248,3 +248,91 @@ func TestGetOptimalPoolSpecWithoutDevices(t *testing.T) {
 
 	t.Logf("optimal: %v", optimal)
 }
+
+func TestGetOptimalPoolSpecByCost(t *testing.T) {
+	lpath := writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 100
+  drivers:
+    - docker
+  provider:
+    name: anynode
+- datacenter: test
+  cpu: 4000
+  mem: 400
+  drivers:
+    - docker
+  provider:
+    name: anynode
+`)
+	lpoolSpecs, lerr := parsePoolDifinition(lpath)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	lsmall, lbig := lpoolSpecs[0], lpoolSpecs[1]
+
+	lapiJob, lerr := parseJobFile(writeTestFile(t, "web.nomad", `
+job "web" {
+  datacenters = ["test"]
+
+  group "app" {
+    count = 6
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "nginx"
+      }
+      resources {
+        cpu    = 400
+        memory = 40
+      }
+    }
+  }
+}
+`))
+	if lerr != nil {
+		t.Fatalf("can't parse job file due: %s", lerr)
+	}
+	ljob := apiNomadJobToStructsJobV2(lapiJob)
+
+	// без стоимости выбирается наименьший пул
+	if lpool := GetOptimalPoolSpec(ljob, lpoolSpecs, nil)["app"]; lpool != lsmall {
+		t.Fatalf("without cost smallest pool must be selected, got: %v", lpool)
+	}
+
+	lsmall.Attributes["cost"] = NewVariantFloatValue(1)
+	lbig.Attributes["cost"] = NewVariantFloatValue(2.5)
+
+	// 6 аллокаций: 3 малых ноды(3.0) дороже одной большой(2.5)
+	if lpool := GetOptimalPoolSpec(ljob, lpoolSpecs, nil)["app"]; lpool != lbig {
+		t.Fatalf("cheaper for 6 allocs big pool must be selected, got: %v", lpool)
+	}
+
+	// 2 аллокации: одна малая нода(1.0) дешевле одной большой
+	if lpool := GetOptimalPoolSpec(ljob, lpoolSpecs, map[string]int{"app": 2})["app"]; lpool != lsmall {
+		t.Fatalf("cheaper for 2 allocs small pool must be selected, got: %v", lpool)
+	}
+
+	lpath = writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 100
+  drivers:
+    - docker
+  cost: 0.096
+  provider:
+    name: anynode
+`)
+	lpoolSpecs, lerr = parsePoolDifinition(lpath)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	if lcost, lok := lpoolSpecs[0].GetCost(); !lok || lcost != 0.096 {
+		t.Fatalf("wrong cost: %v", lcost)
+	}
+
+	if lpoolSpecs[0].GetFullName() != lsmall.GetFullName() {
+		t.Fatalf("cost must not change pool name")
+	}
+}
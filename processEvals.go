@@ -3,21 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-hclog"
 	nomad "github.com/hashicorp/nomad/api"
 )
 
-func processEvals(_stateStat *StateStat, _stalecnf *StaleApiConfig, _preventhung *HungPreventionConfig, evalsCh <-chan *nomad.Evaluation, scalingRequireCh *Queue[*ScalingEvent], scalingDoneCh <-chan string, _poolSpecs []*PoolNodeSpec) {
+func processEvals(_stateStat *StateStat, _nc *nomad.Client, _stalecnf *StaleApiConfig, _preventhung *HungPreventionConfig, evalsCh <-chan *nomad.Evaluation, scalingRequireCh *Queue[*ScalingEvent], scalingDoneCh <-chan string, restoredEventsCh <-chan *RestoredScalingEvents, scalingCancelCh <-chan *ScalingCancelRequest, _pools *PoolSet, _filters *atomic.Pointer[FilterConfig]) {
 	logger := hclog.L().Named("evals")
 
-	cnf := nomad.DefaultConfig()
-	nclient, _ := nomad.NewClient(cnf)
-
 	evals := map[string]*nomad.Evaluation{}
 	blockedEvalsChains := map[string][]string{} // цепочка блокированных евалов с головой в которой всегда блокированный  eval
 	firedEvents := map[string]*ScalingEvent{}
+	blockedChainsSince := map[string]time.Time{} // когда job впервые был заблокирован, для метрик
+	blockedChainsJob := map[string]string{}      // job для метки метрики, у dispatch и periodic job это родительский job
 
 	waitCompleteEvents := time.NewTimer(10 * time.Second)
 
@@ -50,8 +52,19 @@ func processEvals(_stateStat *StateStat, _stalecnf *StaleApiConfig, _preventhung
 
 			if lEval.Status == "blocked" {
 				if _, lok := blockedEvalsChains[lchainId]; !lok { //создаем новую цепочку блокированных евалов, если такой еще нет
+					if !isScalableJobType(lEval.Type) {
+						logger.Debug(fmt.Sprintf("skip blocked eval %s of %s job %s/%s, new nodes only add placements to such jobs", lEval.ID, lEval.Type, lEval.Namespace, lEval.JobID))
+						continue
+					}
+
+					if lreason := _filters.Load().EvalFilteredReason(lEval); lreason != "" {
+						logger.Debug(fmt.Sprintf("skip blocked eval %s: %s", lEval.ID, lreason))
+						continue
+					}
+
 					lEvalsChain := []string{lEval.ID}
 					blockedEvalsChains[lchainId] = lEvalsChain
+					blockedChainsSince[lchainId] = time.Unix(0, lEval.CreateTime)
 					logger.Debug(fmt.Sprintf("crate new chain %s, result chain: %v", lchainId, lEvalsChain))
 					resetTimer = true // нужно подвести итог так как добавилась блокированная цепочка
 				}
@@ -64,6 +77,33 @@ func processEvals(_stateStat *StateStat, _stalecnf *StaleApiConfig, _preventhung
 		case lchainId := <-scalingDoneCh:
 			delete(firedEvents, lchainId)
 
+		case lrestoredEvents := <-restoredEventsCh:
+			for lchainId, lrestoredEvent := range lrestoredEvents.Events {
+				if scalingRequireCh.Remove(lchainId) {
+					logger.Info(fmt.Sprintf("drop scaling event %s, because it was already in progress before restart or leader change", lchainId))
+				}
+
+				firedEvents[lchainId] = lrestoredEvent
+			}
+			close(lrestoredEvents.Done)
+
+		case lcancelRequest := <-scalingCancelCh:
+			lresult := ScalingCancelNotFound
+			if scalingRequireCh.Remove(lcancelRequest.Id) {
+				delete(firedEvents, lcancelRequest.Id)
+				lresult = ScalingCancelDequeued
+			} else if firedEvent, lok := firedEvents[lcancelRequest.Id]; lok {
+				firedEvent.CtxCancelFn() // из firedEvents удалится когда scalingAction сообщит о завершении
+				lresult = ScalingCancelCancelled
+			}
+
+			// забываем цепочку, событие будет брошено снова только когда nomad пришлет новый блокированный eval для job
+			delete(blockedEvalsChains, lcancelRequest.Id)
+			delete(blockedChainsSince, lcancelRequest.Id)
+			delete(blockedChainsJob, lcancelRequest.Id)
+			logger.Info(fmt.Sprintf("scaling event %s canceled by operator: %s", lcancelRequest.Id, lresult))
+			lcancelRequest.Result <- lresult
+
 		case <-waitCompleteEvents.C:
 			newevals := map[string]*nomad.Evaluation{}
 			removedChains := []string{}
@@ -91,6 +131,12 @@ func processEvals(_stateStat *StateStat, _stalecnf *StaleApiConfig, _preventhung
 						firedEvent.CtxCancelFn()
 					}
 
+					// job еще не читали, значит блокировка была короче одного подведения итогов, такие не меряем
+					if lsince, lok := blockedChainsSince[lchainId]; lok && lsince.UnixNano() > 0 && blockedChainsJob[lchainId] != "" {
+						lnamespace, _, _ := strings.Cut(lchainId, "/")
+						metrics.MeasureSinceWithLabels([]string{"job", "blockedtime"}, lsince, []metrics.Label{{Name: "namespace", Value: lnamespace}, {Name: "job", Value: blockedChainsJob[lchainId]}})
+					}
+
 					removedChains = append(removedChains, lchainId)
 					continue
 				}
@@ -104,27 +150,53 @@ func processEvals(_stateStat *StateStat, _stalecnf *StaleApiConfig, _preventhung
 				}
 
 				blockedEval := evals[blockedEvalsChains[lchainId][0]]
-				jobDescription := getJobInfoFromEvalWithRetry(_stalecnf, logger, nclient, blockedEval)
+				jobDescription := getJobInfoFromEvalWithRetry(_stalecnf, logger, _nc, blockedEval)
 				structsJob := apiNomadJobToStructsJobV2(jobDescription)
 
-				if !feasiblePoolByConstraint(_poolSpecs, structsJob) {
+				// у каждого dispatch и periodic запуска свой id, метка с ним плодила бы серии без конца
+				blockedChainsJob[lchainId] = structsJob.ID
+				if structsJob.ParentID != "" {
+					blockedChainsJob[lchainId] = structsJob.ParentID
+				}
+
+				// фильтры могли поменяться после создания цепочки, а meta видна только в описании job
+				if lreason := _filters.Load().JobFilteredReason(structsJob); lreason != "" {
+					logger.Debug(fmt.Sprintf("eval chain %s skipped: %s", lchainId, lreason))
+					removedChains = append(removedChains, lchainId)
+					continue
+				}
+
+				if !isScalableJobType(structsJob.Type) {
+					logger.Debug(fmt.Sprintf("eval chain %s skipped: job %s/%s is %s job", lchainId, blockedEval.Namespace, blockedEval.JobID, structsJob.Type))
+					removedChains = append(removedChains, lchainId)
+					continue
+				}
+
+				lpoolSpecs := _pools.Specs()
+				if !feasiblePoolByConstraint(lpoolSpecs, structsJob) {
 					logger.Debug(fmt.Sprintf("eval chain %s for job: %s/%s not fully feasible for my pools so skip it", lchainId, blockedEval.Namespace, blockedEval.JobID))
 					removedChains = append(removedChains, lchainId)
 					continue
 				}
 
+				// пул выбирается по стоимости нод для всех аллокаций в очереди, поэтому summary нужен заранее
+				summary := getJobSummaryWithRetry(_stalecnf, logger, _nc, blockedEval)
+				lqueuedCounts := map[string]int{}
+				for tgName, tgSummary := range summary.Summary {
+					lqueuedCounts[tgName] = tgSummary.Queued
+				}
+
 				unAllocatedTg := map[string]*ScalingEventTgInfo{}
-				tgPools := GetOptimalPoolSpec(structsJob, _poolSpecs)
+				tgPools := GetOptimalPoolSpec(structsJob, lpoolSpecs, lqueuedCounts)
 				logMsg := fmt.Sprintf("Fire \"no enough resources\" event(%s) for job %s/%s evalschain %v\n", lchainId, blockedEval.Namespace, blockedEval.JobID, blockedEvalsChains[lchainId])
 
 				var latestFailedPlacement *nomad.Evaluation
-				for _, eval := range getJobEvalsFromEvalWithRetry(_stalecnf, logger, nclient, blockedEval) {
+				for _, eval := range getJobEvalsFromEvalWithRetry(_stalecnf, logger, _nc, blockedEval) {
 					if latestFailedPlacement == nil || latestFailedPlacement.CreateIndex < eval.CreateIndex {
 						latestFailedPlacement = eval
 					}
 				}
 
-				summary := getJobSummaryWithRetry(_stalecnf, logger, nclient, blockedEval)
 				for tgName, tgSummary := range summary.Summary {
 					if _, lok := latestFailedPlacement.FailedTGAllocs[tgName]; lok {
 						if _, lok := tgPools[tgName]; !lok {
@@ -171,6 +243,8 @@ func processEvals(_stateStat *StateStat, _stalecnf *StaleApiConfig, _preventhung
 			evals = newevals
 			for _, lchainId := range removedChains {
 				delete(blockedEvalsChains, lchainId)
+				delete(blockedChainsSince, lchainId)
+				delete(blockedChainsJob, lchainId)
 				logger.Debug(fmt.Sprintf("removed chain %s", lchainId))
 			}
 		}
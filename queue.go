@@ -96,6 +96,19 @@ func (q *Queue[T]) Dequeue() T {
 	return item
 }
 
+// Items returns snapshot of queued items in order they will be dequeued
+func (q *Queue[T]) Items() []T {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	litems := make([]T, 0, len(q.items))
+	for _, lqueueitem := range q.items {
+		litems = append(litems, lqueueitem.item)
+	}
+
+	return litems
+}
+
 func (q *Queue[T]) Remove(id string) bool {
 	q.lock.Lock()
 	defer q.lock.Unlock()
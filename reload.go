@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+)
+
+// ConfigReloader re-reads config and pool yaml on demand. Pools whose specs not changed are kept as is, so
+// scalings in progress on them are not disturbed, only gc settings, filters, pools and their node bounds are reloaded
+type ConfigReloader struct {
+	configPath string
+	stalecnf   *StaleApiConfig
+	nc         *nomad.Client
+	stat       *StateStat
+	pools      *PoolSet
+	gcconfigs  *atomic.Pointer[GarbageCollectorConfig]
+	filters    *atomic.Pointer[FilterConfig]
+	dryRun     bool
+	// ноды убранных пулов дренирует и удаляет gc, nil если gc не запущен
+	gcRemoveCh chan<- *GCRemoveRequest
+}
+
+func NewConfigReloader(_configPath string, _stalecnf *StaleApiConfig, _nc *nomad.Client, _stat *StateStat, _pools *PoolSet, _gcconfigs *atomic.Pointer[GarbageCollectorConfig], _filters *atomic.Pointer[FilterConfig], _dryRun bool, _gcRemoveCh chan<- *GCRemoveRequest) *ConfigReloader {
+	return &ConfigReloader{
+		configPath: _configPath,
+		stalecnf:   _stalecnf,
+		nc:         _nc,
+		stat:       _stat,
+		pools:      _pools,
+		gcconfigs:  _gcconfigs,
+		filters:    _filters,
+		dryRun:     _dryRun,
+		gcRemoveCh: _gcRemoveCh,
+	}
+}
+
+// Reload keeps current config and pools if new config or pool yaml are wrong
+func (r *ConfigReloader) Reload() error {
+	logger := hclog.L().Named("reload")
+
+	var lconfig Config
+	lerr := configParse(r.configPath, &lconfig)
+	if lerr != nil {
+		return fmt.Errorf("can't parse config due: %s", lerr)
+	}
+
+	lpoolSpecs, lerr := parsePoolDifinition(lconfig.PoolConfig)
+	if lerr != nil {
+		return fmt.Errorf("can't parce pool yaml due: %s", lerr)
+	}
+
+	lerr = checkDuplicatePools(lpoolSpecs)
+	if lerr != nil {
+		return fmt.Errorf("wrong pool yaml: %s", lerr)
+	}
+
+	for _, loverlap := range findPoolOverlaps(lpoolSpecs) {
+		logger.Warn(loverlap.Msg)
+	}
+
+	loldPools := r.pools.Pools()
+	lnewPools := map[string]*Pool{}
+	laddedPools := []*Pool{}
+
+	for _, lpoolSpec := range lpoolSpecs {
+		lpoolName := lpoolSpec.GetFullName()
+		if lpool, lok := loldPools[lpoolName]; lok {
+			lpool.SetNodeBounds(lpoolSpec.GetNodeBounds())
+			lnewPools[lpoolName] = lpool
+			continue
+		}
+
+		lpool, lerr := NewPool(lpoolSpec)
+		if lerr != nil {
+			return fmt.Errorf("can't create pool due: %s", lerr)
+		}
+		lpool.SetDryRun(r.dryRun)
+
+		lnewPools[lpoolName] = lpool
+		laddedPools = append(laddedPools, lpool)
+	}
+
+	// сначала подменяем пулы, чтобы новые пулы не пропустили события nomad, пока мы их наполняем
+	r.pools.Replace(lnewPools, lpoolSpecs)
+	r.pools.SetMaxNodes(lconfig.MaxNodes)
+	r.gcconfigs.Store(lconfig.GC[0])
+	r.filters.Store(lconfig.Filter[0])
+
+	if len(laddedPools) > 0 {
+		lnodeList, _, lerr := listNomadNodes(r.stalecnf, r.nc)
+		if lerr != nil {
+			logger.Error(fmt.Sprintf("%s, so new pools will get nodes only from nomad events", lerr))
+		} else {
+			for _, lpool := range laddedPools {
+				lerr = fillPool(r.stalecnf, r.nc, lpool, lnodeList)
+				if lerr != nil {
+					logger.Error(fmt.Sprintf("can't fill pool %s due: %s", lpool.GetName(), lerr))
+				}
+			}
+		}
+	}
+
+	for _, lpool := range laddedPools {
+		logger.Info(fmt.Sprintf("pool %s added", lpool.GetName()))
+	}
+
+	for lpoolName, lpool := range loldPools {
+		if _, lok := lnewPools[lpoolName]; lok {
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("pool %s retired, it will not be scaled anymore", lpoolName))
+		if lconfig.GC[0].DrainRetiredPools && r.gcRemoveCh != nil && r.stat.IsLeader() {
+			go r.drainRetiredPool(lpool)
+		}
+	}
+
+	return nil
+}
+
+// drainRetiredPool hands nodes of retired pool to gc, which drains them with gc drain settings and removes them
+// through node provider of retired pool only after drain completes
+func (r *ConfigReloader) drainRetiredPool(_pool *Pool) {
+	logger := hclog.L().Named("reload").With("pool", _pool.GetName())
+
+	_pool.lock.Lock()
+	lnodeIds := make([]string, 0, len(_pool.nomadNodes))
+	for lnodeId := range _pool.nomadNodes {
+		lnodeIds = append(lnodeIds, lnodeId)
+	}
+	_pool.lock.Unlock()
+
+	if len(lnodeIds) == 0 {
+		return
+	}
+
+	lremoveRequest := &GCRemoveRequest{Pool: _pool.GetName(), Nodes: lnodeIds, Retired: _pool, Result: make(chan map[string]*GCRemoveResult, 1)}
+	r.gcRemoveCh <- lremoveRequest
+	lresults := <-lremoveRequest.Result
+
+	for _, lnodeId := range lnodeIds {
+		lresult, lok := lresults[lnodeId]
+		if !lok {
+			lresult = &GCRemoveResult{Status: GCRemoveFailed, Err: fmt.Errorf("no result from gc")}
+		}
+
+		switch lresult.Status {
+		case GCRemoveDraining:
+			logger.Info(fmt.Sprintf("node %s of retired pool is draining, it will be removed after drain completes", lnodeId))
+		case GCRemoveDryRun:
+			logger.Info(fmt.Sprintf("dry run: would drain and remove node %s of retired pool", lnodeId))
+		default:
+			logger.Error(fmt.Sprintf("can't drain node %s of retired pool: %s(%v)", lnodeId, lresult.Status, lresult.Err))
+		}
+	}
+}
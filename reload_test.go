@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestConfigReloaderReload(t *testing.T) {
+	lnomadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]")) // в nomad нет нод
+	}))
+	defer lnomadServer.Close()
+
+	lnc, lerr := nomad.NewClient(&nomad.Config{Address: lnomadServer.URL})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	ldir := t.TempDir()
+	writeTestFileAt := func(_path string, _data string) {
+		lerr := os.WriteFile(_path, []byte(_data), 0644)
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+	}
+
+	lpoolsPath := writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: anynode
+- datacenter: test
+  cpu: 2000
+  mem: 1Gib
+  provider:
+    name: anynode
+`)
+	lconfigPath := filepath.Join(ldir, "config.hcl")
+	writeConfig := func(_poolsPath string, _ciclesToGc int) {
+		writeTestFileAt(lconfigPath, fmt.Sprintf("poolconfig = %q\n\ngc {\n  cicles_to_gc = %d\n  cicle_period = \"1m\"\n}\n\nstalenomadapi {\n  allow = false\n}\n", _poolsPath, _ciclesToGc))
+	}
+	writeConfig(lpoolsPath, 3)
+
+	var lconfig Config
+	lerr = configParse(lconfigPath, &lconfig)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lpoolSpecs, lerr := parsePoolDifinition(lconfig.PoolConfig)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lcreatedPools := map[string]*Pool{}
+	for _, lpoolSpec := range lpoolSpecs {
+		lpool, lerr := NewPool(lpoolSpec)
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+		lcreatedPools[lpoolSpec.GetFullName()] = lpool
+	}
+
+	lpools := NewPoolSet(lcreatedPools, lpoolSpecs)
+	lgcconfigs := &atomic.Pointer[GarbageCollectorConfig]{}
+	lgcconfigs.Store(lconfig.GC[0])
+
+	lreloader := NewConfigReloader(lconfigPath, lconfig.StaleNomadApi[0], lnc, NewStateStat(), lpools, lgcconfigs, &atomic.Pointer[FilterConfig]{}, true, nil)
+
+	// первый пул не меняется, второй удаляется, добавляется третий
+	writeTestFileAt(lpoolsPath, `- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: anynode
+- datacenter: test
+  cpu: 3000
+  mem: 1Gib
+  provider:
+    name: anynode
+`)
+	writeConfig(lpoolsPath, 5)
+
+	lerr = lreloader.Reload()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lreloadedPools := lpools.Pools()
+	if len(lreloadedPools) != 2 || len(lpools.Specs()) != 2 {
+		t.Fatalf("expected 2 pools after reload, got %d", len(lreloadedPools))
+	}
+
+	for lpoolName, lpool := range lreloadedPools {
+		if lpool.poolnodespec.GetResources().Cpu == 1000 && lpool != lcreatedPools[lpoolName] {
+			t.Fatalf("unchanged pool %s must be kept as is", lpoolName)
+		}
+
+		if lpool.poolnodespec.GetResources().Cpu == 3000 && !lpool.IsDryRun() {
+			t.Fatalf("new pool %s must inherit dry run mode", lpoolName)
+		}
+
+		if lpool.poolnodespec.GetResources().Cpu == 2000 {
+			t.Fatalf("removed pool %s must be retired", lpoolName)
+		}
+	}
+
+	if lgcconfigs.Load().CiclesToGc != 5 {
+		t.Fatalf("gc config must be reloaded, got cicles_to_gc: %d", lgcconfigs.Load().CiclesToGc)
+	}
+
+	// с неверным конфигом остаются прежние пулы и настройки
+	writeTestFileAt(lpoolsPath, "- datacenter: [")
+	if lreloader.Reload() == nil {
+		t.Fatalf("reload with wrong pool yaml must fail")
+	}
+
+	if len(lpools.Pools()) != 2 || lgcconfigs.Load().CiclesToGc != 5 {
+		t.Fatalf("failed reload must keep previous pools and gc config")
+	}
+}
+
+func TestConfigReloaderDrainRetiredPool(t *testing.T) {
+	lnc, lerr := nomad.NewClient(&nomad.Config{Address: "http://127.0.0.1:0"})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lpoolsPath := writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: anynode
+`)
+	lconfigPath := filepath.Join(t.TempDir(), "config.hcl")
+	lerr = os.WriteFile(lconfigPath, []byte(fmt.Sprintf("poolconfig = %q\n\ngc {\n  drain_retired_pools = true\n}\n", lpoolsPath)), 0644)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lretiredPool := &Pool{
+		logger:     hclog.L(),
+		fullName:   "retired",
+		nomadNodes: map[string]*structs.Node{"node-1": {ID: "node-1"}},
+	}
+	lpools := NewPoolSet(map[string]*Pool{"retired": lretiredPool}, nil)
+
+	lstat := NewStateStat()
+	lstat.SetLeader(true)
+	lgcRemoveCh := make(chan *GCRemoveRequest)
+	lreloader := NewConfigReloader(lconfigPath, &StaleApiConfig{}, lnc, lstat, lpools, &atomic.Pointer[GarbageCollectorConfig]{}, &atomic.Pointer[FilterConfig]{}, false, lgcRemoveCh)
+
+	lerr = lreloader.Reload()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	// ноды убранного пула не удаляются сразу, их дренирует и удаляет gc
+	select {
+	case lremoveRequest := <-lgcRemoveCh:
+		if lremoveRequest.Retired != lretiredPool || lremoveRequest.Pool != "retired" || !reflect.DeepEqual(lremoveRequest.Nodes, []string{"node-1"}) {
+			t.Fatalf("wrong remove request for retired pool: %+v", lremoveRequest)
+		}
+		lremoveRequest.Result <- map[string]*GCRemoveResult{"node-1": {Status: GCRemoveDraining}}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nodes of retired pool must be handed to gc")
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-hclog"
@@ -15,7 +18,7 @@ type PoolToScale struct {
 	ea   []*structs.Allocation
 }
 
-func scalingAction(_stat *StateStat, _pools map[string]*Pool, scalingRequireCh *Queue[*ScalingEvent], scalingDoneCh chan<- string) {
+func scalingAction(_stat *StateStat, _persist *PersistentState, _pools *PoolSet, scalingRequireCh *Queue[*ScalingEvent], scalingDoneCh chan<- string) {
 	logger := hclog.L().Named("scaling")
 
 	for {
@@ -38,8 +41,14 @@ func scalingAction(_stat *StateStat, _pools map[string]*Pool, scalingRequireCh *
 			var lpoolToScale *PoolToScale
 			var lok bool
 			if lpoolToScale, lok = lpoolsToScale[lpoolName]; !lok {
+				lpool, lok := _pools.Get(lpoolName)
+				if !lok { // пул удален при перезагрузке конфига, пока событие ждало в очереди
+					logger.Warn(fmt.Sprintf("pool %s for task group %s/%s.%s not exists anymore, so skip it", lpoolName, lJobToScale.Namespace, lJobToScale.ID, tgName))
+					continue
+				}
+
 				lpoolToScale = &PoolToScale{
-					pool: _pools[lpoolName],
+					pool: lpool,
 				}
 				lpoolsToScale[lpoolName] = lpoolToScale
 			}
@@ -52,26 +61,209 @@ func scalingAction(_stat *StateStat, _pools map[string]*Pool, scalingRequireCh *
 			lpoolToScale.ea = append(lpoolToScale.ea, ea...)
 		}
 
+		// пулы попадают в сохраненное состояние только когда пул принял ноды, с учетом его max и max_nodes
+		linflight := &InflightScaling{Id: scalingEvent.Id, FireTime: scalingEvent.FireTime, Pools: map[string]*InflightPoolScaling{}}
+		_persist.AddScaling(linflight)
+
 		lestimatedNodes := 0
-		for lpoolName, lpoolToScale := range lpoolsToScale {
+		for _, lpoolToScale := range lpoolsToScale {
 			lestimatedNodes += len(lpoolToScale.en)
-			lerr := lpoolToScale.pool.Update(scalingEvent.Ctx, lpoolToScale.en, lpoolToScale.ea)
-			if lerr != nil {
-				if lerr == context.DeadlineExceeded {
-					logger.Error("Waiting for pool update canceled by timeout", "pool", lpoolName)
-					_stat.IncScalingTimeouts()
-				} else if lerr == context.Canceled {
-					logger.Info("Waiting for pool update canceled, due reported that resources fully satisfied or not needed", "pool", lpoolName)
-				} else {
-					logger.Info(fmt.Sprintf("can't update pool, due: %s", lerr), "pool", lpoolName)
-				}
-			}
+			linflight = scalePool(logger, _stat, _persist, _pools, scalingEvent, linflight, lpoolToScale, map[string]struct{}{})
 		}
 
 		metrics.IncrCounter([]string{"scaleup", "estimatedNodes"}, float32(lestimatedNodes))
 		metrics.MeasureSince([]string{"scaleup", "executiontime"}, scalingEvent.FireTime)
 
+		_persist.RemoveScaling(scalingEvent.Id)
 		scalingDoneCh <- scalingEvent.Id
 		_stat.IncFreeScalingThreads()
 	}
 }
+
+// scalePool updates pool, and if pool stalled, scales first feasible pool of its fallback list for allocations which
+// were not placed, fallback pool falls back by its own list, pools in _tried are not scaled again. Returns inflight
+// scaling with fallback pools added
+func scalePool(logger hclog.Logger, _stat *StateStat, _persist *PersistentState, _pools *PoolSet, _event *ScalingEvent, _inflight *InflightScaling, _poolToScale *PoolToScale, _tried map[string]struct{}) *InflightScaling {
+	lpoolName := _poolToScale.pool.GetName()
+	_tried[lpoolName] = struct{}{}
+
+	var lfallback []string
+	var lfallbackAfter time.Duration
+	if lpoolSpec := _pools.Spec(lpoolName); lpoolSpec != nil {
+		lfallback, lfallbackAfter = lpoolSpec.GetFallback()
+	}
+	if len(lfallback) == 0 {
+		lfallbackAfter = 0
+	}
+
+	metrics.IncrCounterWithLabels([]string{"scaleup", "count"}, 1, poolLabels(lpoolName))
+	lerr := _poolToScale.pool.UpdateWithFallback(_event.Ctx, _poolToScale.en, _poolToScale.ea, lfallbackAfter, func(_en []*structs.Node, _ea []*structs.Allocation) {
+		_inflight = withInflightPool(_persist, _inflight, lpoolName, _en, _ea)
+	})
+
+	var lstalled *PoolStalledError
+	if errors.As(lerr, &lstalled) {
+		logger.Warn(fmt.Sprintf("%s, so fall back to %v for not placed allocs %v", lerr, lfallback, lstalled.Unplaced), "pool", lpoolName)
+		metrics.IncrCounterWithLabels([]string{"scaleup", "fallback"}, 1, poolLabels(lpoolName))
+
+		for _, lfallbackToScale := range fallbackPools(logger, _pools, _event.Job, lfallback, lstalled.Unplaced, _tried) {
+			_inflight = scalePool(logger, _stat, _persist, _pools, _event, _inflight, lfallbackToScale, _tried)
+		}
+	} else if lerr != nil {
+		if lerr == context.DeadlineExceeded {
+			logger.Error("Waiting for pool update canceled by timeout", "pool", lpoolName)
+			_stat.IncScalingTimeouts()
+		} else if lerr == context.Canceled {
+			logger.Info("Waiting for pool update canceled, due reported that resources fully satisfied or not needed", "pool", lpoolName)
+		} else {
+			logger.Info(fmt.Sprintf("can't update pool, due: %s", lerr), "pool", lpoolName)
+		}
+	}
+
+	return _inflight
+}
+
+// withInflightPool saves copy of _inflight where pool _poolName waits for _en and _ea, state may be checkpointed at
+// this moment, so saved scaling is never changed in place
+func withInflightPool(_persist *PersistentState, _inflight *InflightScaling, _poolName string, _en []*structs.Node, _ea []*structs.Allocation) *InflightScaling {
+	lnewInflight := &InflightScaling{Id: _inflight.Id, FireTime: _inflight.FireTime, Pools: map[string]*InflightPoolScaling{}}
+	for lname, lpoolScaling := range _inflight.Pools {
+		lnewInflight.Pools[lname] = lpoolScaling
+	}
+
+	if len(_en) > 0 || len(_ea) > 0 {
+		lnewInflight.Pools[_poolName] = &InflightPoolScaling{EphemeralNodes: _en, EphemeralAllocs: _ea}
+	} else {
+		delete(lnewInflight.Pools, _poolName)
+	}
+	_persist.AddScaling(lnewInflight)
+
+	return lnewInflight
+}
+
+// fallbackPools estimates nodes for _unplaced allocations of task groups in first feasible and not tried pool of
+// _fallback list for every task group
+func fallbackPools(logger hclog.Logger, _pools *PoolSet, _job *structs.Job, _fallback []string, _unplaced map[string]int, _tried map[string]struct{}) []*PoolToScale {
+	ljob := _job.Copy()
+	ljob.Status = structs.JobStatusPending
+
+	lpoolsToScale := map[string]*PoolToScale{}
+	lorder := []string{}
+
+	for _, ltg := range ljob.TaskGroups {
+		lunplaced := _unplaced[ltg.Name]
+		if lunplaced == 0 {
+			continue
+		}
+
+		var lpoolToScale *PoolToScale
+		for _, lfallbackName := range _fallback {
+			lpoolSpec := _pools.SpecByShortName(lfallbackName)
+			if lpoolSpec == nil {
+				logger.Warn(fmt.Sprintf("fallback pool %s not exists", lfallbackName))
+				continue
+			}
+
+			if _, lok := _tried[lpoolSpec.GetFullName()]; lok {
+				continue
+			}
+
+			lnode := lpoolSpec.GetNode(lpoolSpec.GetFullName())
+			if !containsInSlice(ljob.Datacenters, lnode.Datacenter) || getSuitableNodes(ltg.Name, ljob, []*structs.Node{lnode})[ltg.Name] == "" {
+				logger.Debug(fmt.Sprintf("fallback pool %s not suited for task group %s/%s.%s", lfallbackName, ljob.Namespace, ljob.ID, ltg.Name))
+				continue
+			}
+
+			if lpoolToScale = lpoolsToScale[lpoolSpec.GetFullName()]; lpoolToScale == nil {
+				lpool, lok := _pools.Get(lpoolSpec.GetFullName())
+				if !lok {
+					continue
+				}
+
+				lpoolToScale = &PoolToScale{pool: lpool}
+				lpoolsToScale[lpoolSpec.GetFullName()] = lpoolToScale
+				lorder = append(lorder, lpoolSpec.GetFullName())
+			}
+			break
+		}
+
+		if lpoolToScale == nil {
+			logger.Warn(fmt.Sprintf("no fallback pool suited for task group %s/%s.%s, so %d allocs left not placed", ljob.Namespace, ljob.ID, ltg.Name, lunplaced))
+			continue
+		}
+
+		en, ea := estimateRequiredNodes(lpoolToScale.pool, lpoolToScale.en, lpoolToScale.ea, _job, ltg, lunplaced)
+		logger.Info(fmt.Sprintf("estimate required nodes for %s/%s.%s: %d", ljob.Namespace, ljob.Name, ltg.Name, len(en)), "pool", lpoolToScale.pool.GetName())
+
+		lpoolToScale.en = append(lpoolToScale.en, en...)
+		lpoolToScale.ea = append(lpoolToScale.ea, ea...)
+	}
+
+	lresult := make([]*PoolToScale, 0, len(lorder))
+	for _, lpoolName := range lorder {
+		lresult = append(lresult, lpoolsToScale[lpoolName])
+	}
+
+	return lresult
+}
+
+// resumeScalings continues waiting for scalings that were in progress when scaler restarted. Returned events must be
+// treated by processEvals as already fired, so it will not scale pools second time
+func resumeScalings(_persist *PersistentState, _pools map[string]*Pool, _preventhung *HungPreventionConfig, scalingDoneCh chan<- string) map[string]*ScalingEvent {
+	logger := hclog.L().Named("scaling")
+	lrestoredEvents := map[string]*ScalingEvent{}
+
+	ltimeout := cRestoredScalingTimeout
+	if _preventhung.Allow {
+		ltimeout = _preventhung.DetectPeriod
+	}
+
+	for _, linflight := range _persist.GetScalings() {
+		ldeadline := linflight.FireTime.Add(ltimeout)
+		if time.Now().After(ldeadline) {
+			logger.Info(fmt.Sprintf("restored scaling event %s is too old, so forget it", linflight.Id))
+			_persist.RemoveScaling(linflight.Id)
+			continue
+		}
+
+		lctx, lcancelFn := context.WithDeadline(context.Background(), ldeadline)
+		lrestoredEvents[linflight.Id] = &ScalingEvent{
+			Id:          linflight.Id,
+			FireTime:    linflight.FireTime,
+			Ctx:         lctx,
+			CtxCancelFn: lcancelFn,
+		}
+
+		logger.Info(fmt.Sprintf("resume scaling event %s fired at %s", linflight.Id, linflight.FireTime))
+
+		go func(_inflight *InflightScaling, _ctx context.Context, _cancelFn context.CancelFunc) {
+			var lwg sync.WaitGroup
+
+			for lpoolName, lpoolScaling := range _inflight.Pools {
+				lpool, lok := _pools[lpoolName]
+				if !lok {
+					logger.Warn(fmt.Sprintf("pool %s of restored scaling event %s not exists anymore", lpoolName, _inflight.Id))
+					continue
+				}
+
+				lwg.Add(1)
+				go func(_poolName string, _pool *Pool, _poolScaling *InflightPoolScaling) {
+					defer lwg.Done()
+
+					lerr := _pool.Resume(_ctx, _poolScaling.EphemeralNodes, _poolScaling.EphemeralAllocs)
+					if lerr != nil {
+						logger.Info(fmt.Sprintf("waiting for restored pool update ended due: %s", lerr), "pool", _poolName)
+					}
+				}(lpoolName, lpool, lpoolScaling)
+			}
+
+			lwg.Wait()
+			_cancelFn()
+
+			_persist.RemoveScaling(_inflight.Id)
+			scalingDoneCh <- _inflight.Id
+		}(linflight, lctx, lcancelFn)
+	}
+
+	return lrestoredEvents
+}
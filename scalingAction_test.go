@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestFallbackPools(t *testing.T) {
+	lpoolSpecs, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", `- name: spot
+  datacenter: test
+  cpu: 1000
+  mem: 100
+  drivers:
+    - docker
+  fallback:
+    - arm
+    - ondemand
+  fallback_after: 2m
+  provider:
+    name: anynode
+- name: arm
+  datacenter: test
+  cpu: 1000
+  mem: 100
+  attr.cpu.arch: arm64
+  drivers:
+    - docker
+  provider:
+    name: anynode
+- name: ondemand
+  datacenter: test
+  cpu: 2000
+  mem: 200
+  drivers:
+    - docker
+  provider:
+    name: anynode
+`))
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lcreatedPools := map[string]*Pool{}
+	for _, lpoolSpec := range lpoolSpecs {
+		lpool, lerr := NewPool(lpoolSpec)
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+		lcreatedPools[lpoolSpec.GetFullName()] = lpool
+	}
+	lpools := NewPoolSet(lcreatedPools, lpoolSpecs)
+
+	lapiJob, lerr := parseJobFile(writeTestFile(t, "web.nomad", `
+job "web" {
+  datacenters = ["test"]
+
+  group "app" {
+    count = 6
+
+    constraint {
+      attribute = "${attr.cpu.arch}"
+      operator  = "!="
+      value     = "arm64"
+    }
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "nginx"
+      }
+      resources {
+        cpu    = 400
+        memory = 40
+      }
+    }
+  }
+}
+`))
+	if lerr != nil {
+		t.Fatalf("can't parse job file due: %s", lerr)
+	}
+
+	lfallback, lfallbackAfter := lpoolSpecs[0].GetFallback()
+	if len(lfallback) != 2 || lfallbackAfter.Minutes() != 2 {
+		t.Fatalf("wrong fallback: %v after %s", lfallback, lfallbackAfter)
+	}
+
+	// arm не подходит по constraint, значит 3 аллокации уходят в ondemand, по 4 на ноду
+	ltried := map[string]struct{}{lpoolSpecs[0].GetFullName(): {}}
+	lpoolsToScale := fallbackPools(hclog.L(), lpools, apiNomadJobToStructsJobV2(lapiJob), lfallback, map[string]int{"app": 3}, ltried)
+	if len(lpoolsToScale) != 1 || lpoolsToScale[0].pool.GetName() != lpoolSpecs[2].GetFullName() || len(lpoolsToScale[0].en) != 1 || len(lpoolsToScale[0].ea) != 3 {
+		t.Fatalf("wrong fallback pools: %+v", lpoolsToScale)
+	}
+
+	// все пулы уже пробовали
+	ltried[lpoolSpecs[2].GetFullName()] = struct{}{}
+	if lpoolsToScale := fallbackPools(hclog.L(), lpools, apiNomadJobToStructsJobV2(lapiJob), lfallback, map[string]int{"app": 3}, ltried); len(lpoolsToScale) != 0 {
+		t.Fatalf("tried pools must not be used again: %+v", lpoolsToScale)
+	}
+}
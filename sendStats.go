@@ -6,10 +6,16 @@ import (
 	"github.com/armon/go-metrics"
 )
 
-func sendStats(_state *StateStat) {
+func sendStats(_state *StateStat, _pools *PoolSet) {
 	tiker := time.NewTicker(10 * time.Second)
 
 	for range tiker.C {
+		var lisLeader float32
+		if _state.IsLeader() {
+			lisLeader = 1
+		}
+
+		metrics.SetGauge([]string{"state", "IsLeader"}, lisLeader)
 		metrics.SetGauge([]string{"state", "freeGcThreads"}, float32(_state.GetFreeGcThreads()))
 		metrics.SetGauge([]string{"state", "NumGcThreads"}, float32(_state.GetTotalGcThreads()))
 		metrics.SetGauge([]string{"state", "freeScalingThreads"}, float32(_state.GetFreeScalingThreads()))
@@ -18,5 +24,17 @@ func sendStats(_state *StateStat) {
 		metrics.SetGauge([]string{"state", "AcceptedAllocs"}, float32(_state.GetAcceptedAllocs()))
 		metrics.SetGauge([]string{"state", "ScalingTimeouts"}, float32(_state.GetScalingTimeouts()))
 		metrics.SetGauge([]string{"state", "NoSuitedScalingEvents"}, float32(_state.GetNosuitedEvents()))
+
+		for lpoolName, lpool := range _pools.Pools() {
+			lpool.lock.Lock()
+			lnodes := len(lpool.nomadNodes)
+			lallocs := len(lpool.nomadAllocs)
+			lephemeralNodes := len(lpool.ephemeralnomadNodes)
+			lpool.lock.Unlock()
+
+			metrics.SetGaugeWithLabels([]string{"pool", "nodes"}, float32(lnodes), poolLabels(lpoolName))
+			metrics.SetGaugeWithLabels([]string{"pool", "allocs"}, float32(lallocs), poolLabels(lpoolName))
+			metrics.SetGaugeWithLabels([]string{"pool", "ephemeralnodes"}, float32(lephemeralNodes), poolLabels(lpoolName))
+		}
 	}
 }
@@ -10,6 +10,8 @@ type StateStat struct {
 	scalingTimeouts atomic.Uint64
 	nosuitedEvents  atomic.Uint64
 
+	isLeader atomic.Bool
+
 	freeScalingThreads  atomic.Int64
 	freeGcThreads       atomic.Int64
 	totalScalingThreads int
@@ -20,6 +22,14 @@ func NewStateStat() *StateStat {
 	return &StateStat{}
 }
 
+func (s *StateStat) SetLeader(_isLeader bool) {
+	s.isLeader.Store(_isLeader)
+}
+
+func (s *StateStat) IsLeader() bool {
+	return s.isLeader.Load()
+}
+
 func (s *StateStat) IncFreeScalingThreads() {
 	s.freeScalingThreads.Add(1)
 }
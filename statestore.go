@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+const cScalerStateVersion = 1
+
+// если скейлинг был в процессе во время рестарта и hungprevention не включен, то ждем его завершения не дольше этого времени
+const cRestoredScalingTimeout = 10 * time.Minute
+
+// IStateStore keeps checkpoint of scaler state between restarts
+type IStateStore interface {
+	Load() ([]byte, error) // returns nil without error if nothing was saved yet
+	Save(_data []byte) error
+	Close() error
+}
+
+func NewStateStore(_cnf *StateStoreConfig, _nc *nomad.Client) (IStateStore, error) {
+	switch _cnf.Type {
+	case "bolt":
+		if _cnf.Path == "" {
+			return nil, fmt.Errorf("path must be set for bolt state store")
+		}
+
+		return NewBoltStateStore(_cnf.Path)
+
+	case "nomad":
+		return NewNomadStateStore(_nc, _cnf.Namespace, _cnf.Path), nil
+	}
+
+	return nil, fmt.Errorf("unknown state store type %q, valid types: bolt, nomad", _cnf.Type)
+}
+
+type InflightPoolScaling struct {
+	EphemeralNodes  []*structs.Node       `json:"ephemeralnodes"`
+	EphemeralAllocs []*structs.Allocation `json:"ephemeralallocs"`
+}
+
+// InflightScaling is scaling event which pools are waiting for ephemeral nodes and allocations
+type InflightScaling struct {
+	Id       string                          `json:"id"`
+	FireTime time.Time                       `json:"firetime"`
+	Pools    map[string]*InflightPoolScaling `json:"pools"`
+}
+
+type ScalerState struct {
+	Version        int                         `json:"version"`
+	NomadLastIndex uint64                      `json:"nomadlastindex"`
+	GC             map[string]*GCInfo          `json:"gc"`
+	Scalings       map[string]*InflightScaling `json:"scalings"`
+	Providers      map[string][]byte           `json:"providers"` // by pool name
+}
+
+func NewScalerState() *ScalerState {
+	return &ScalerState{
+		Version:   cScalerStateVersion,
+		GC:        map[string]*GCInfo{},
+		Scalings:  map[string]*InflightScaling{},
+		Providers: map[string][]byte{},
+	}
+}
+
+func LoadScalerState(_store IStateStore) (*ScalerState, error) {
+	ldata, lerr := _store.Load()
+	if lerr != nil {
+		return nil, fmt.Errorf("can't load state due: %s", lerr)
+	}
+
+	if ldata == nil {
+		return nil, nil
+	}
+
+	lstate := NewScalerState()
+	lerr = json.Unmarshal(ldata, lstate)
+	if lerr != nil {
+		return nil, fmt.Errorf("can't decode state due: %s", lerr)
+	}
+
+	if lstate.Version != cScalerStateVersion {
+		return nil, fmt.Errorf("state version %d not supported, expected: %d", lstate.Version, cScalerStateVersion)
+	}
+
+	return lstate, nil
+}
+
+// PersistentState collects parts of scaler state from goroutines that own them, so they can be checkpointed
+type PersistentState struct {
+	lock  sync.Mutex
+	state *ScalerState
+}
+
+func NewPersistentState(_restored *ScalerState) *PersistentState {
+	lpersist := &PersistentState{state: NewScalerState()}
+	if _restored != nil {
+		lpersist.state.NomadLastIndex = _restored.NomadLastIndex
+		lpersist.Restore(_restored)
+	}
+
+	return lpersist
+}
+
+// Restore replaces everything except nomad event index, which is always tracked by running scaler
+func (s *PersistentState) Restore(_restored *ScalerState) {
+	if _restored == nil {
+		return
+	}
+
+	// удаление нод не было подтверждено до рестарта, поэтому пробуем еще раз
+	for _, lgcInfo := range _restored.GC {
+		lgcInfo.Collecting = false
+	}
+
+	s.lock.Lock()
+	s.state.GC = _restored.GC
+	s.state.Scalings = _restored.Scalings
+	s.state.Providers = _restored.Providers
+	s.lock.Unlock()
+}
+
+func (s *PersistentState) SetNomadLastIndex(_index uint64) {
+	s.lock.Lock()
+	s.state.NomadLastIndex = _index
+	s.lock.Unlock()
+}
+
+func (s *PersistentState) GetNomadLastIndex() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.state.NomadLastIndex
+}
+
+func (s *PersistentState) SetGC(_nodesToGC map[string]*GCInfo) {
+	lgc := make(map[string]*GCInfo, len(_nodesToGC))
+	for lnodeId, lgcInfo := range _nodesToGC {
+		lgcInfoCopy := *lgcInfo
+		lgc[lnodeId] = &lgcInfoCopy
+	}
+
+	s.lock.Lock()
+	s.state.GC = lgc
+	s.lock.Unlock()
+}
+
+func (s *PersistentState) GetGC() map[string]*GCInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lgc := make(map[string]*GCInfo, len(s.state.GC))
+	for lnodeId, lgcInfo := range s.state.GC {
+		lgcInfoCopy := *lgcInfo
+		lgc[lnodeId] = &lgcInfoCopy
+	}
+
+	return lgc
+}
+
+func (s *PersistentState) AddScaling(_scaling *InflightScaling) {
+	s.lock.Lock()
+	s.state.Scalings[_scaling.Id] = _scaling
+	s.lock.Unlock()
+}
+
+func (s *PersistentState) RemoveScaling(_id string) {
+	s.lock.Lock()
+	delete(s.state.Scalings, _id)
+	s.lock.Unlock()
+}
+
+func (s *PersistentState) GetScalings() []*InflightScaling {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lscalings := make([]*InflightScaling, 0, len(s.state.Scalings))
+	for _, lscaling := range s.state.Scalings {
+		lscalings = append(lscalings, lscaling)
+	}
+
+	return lscalings
+}
+
+// RestoreProviders passes saved state to node providers, which support it
+func (s *PersistentState) RestoreProviders(_pools map[string]*Pool) {
+	s.lock.Lock()
+	lproviders := s.state.Providers
+	s.lock.Unlock()
+
+	for lpoolName, lproviderState := range lproviders {
+		lpool, lok := _pools[lpoolName]
+		if !lok {
+			continue
+		}
+
+		lerr := lpool.RestoreProviderState(lproviderState)
+		if lerr != nil {
+			lpool.logger.Error(fmt.Sprintf("can't restore node provider state due: %s", lerr))
+		}
+	}
+}
+
+func (s *PersistentState) Checkpoint(_store IStateStore, _pools map[string]*Pool) error {
+	lproviders := map[string][]byte{}
+	for lpoolName, lpool := range _pools {
+		lproviderState, lerr := lpool.SaveProviderState()
+		if lerr != nil {
+			return fmt.Errorf("can't save node provider state of pool %s due: %s", lpoolName, lerr)
+		}
+
+		if lproviderState != nil {
+			lproviders[lpoolName] = lproviderState
+		}
+	}
+
+	s.lock.Lock()
+	s.state.Providers = lproviders
+	ldata, lerr := json.Marshal(s.state)
+	s.lock.Unlock()
+
+	if lerr != nil {
+		return fmt.Errorf("can't encode state due: %s", lerr)
+	}
+
+	return _store.Save(ldata)
+}
+
+func checkpointState(_persist *PersistentState, _store IStateStore, _period time.Duration, _pools *PoolSet) {
+	logger := hclog.L().Named("state")
+	lticker := time.NewTicker(_period)
+
+	for range lticker.C {
+		lerr := _persist.Checkpoint(_store, _pools.Pools())
+		if lerr != nil {
+			logger.Error(fmt.Sprintf("can't checkpoint state due: %s", lerr))
+		}
+	}
+}
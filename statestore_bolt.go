@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	cBoltStateBucket = []byte("state")
+	cBoltStateKey    = []byte("scaler")
+)
+
+type BoltStateStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStateStore(_path string) (*BoltStateStore, error) {
+	ldb, lerr := bolt.Open(_path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if lerr != nil {
+		return nil, fmt.Errorf("can't open bolt db %s due: %s", _path, lerr)
+	}
+
+	lerr = ldb.Update(func(tx *bolt.Tx) error {
+		_, lerr := tx.CreateBucketIfNotExists(cBoltStateBucket)
+		return lerr
+	})
+	if lerr != nil {
+		ldb.Close()
+		return nil, fmt.Errorf("can't create bucket in bolt db %s due: %s", _path, lerr)
+	}
+
+	return &BoltStateStore{db: ldb}, nil
+}
+
+func (s *BoltStateStore) Load() ([]byte, error) {
+	var ldata []byte
+
+	lerr := s.db.View(func(tx *bolt.Tx) error {
+		lvalue := tx.Bucket(cBoltStateBucket).Get(cBoltStateKey)
+		if lvalue != nil {
+			// значение валидно только внутри транзакции
+			ldata = append([]byte{}, lvalue...)
+		}
+
+		return nil
+	})
+
+	return ldata, lerr
+}
+
+func (s *BoltStateStore) Save(_data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cBoltStateBucket).Put(cBoltStateKey, _data)
+	})
+}
+
+func (s *BoltStateStore) Close() error {
+	return s.db.Close()
+}
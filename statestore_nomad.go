@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	nomad "github.com/hashicorp/nomad/api"
+)
+
+const cNomadStateStoreItem = "state"
+
+// NomadStateStore keeps state in nomad variable, so it available for scaler on any node,
+// state is gzipped because nomad limits variable size by 64KiB
+type NomadStateStore struct {
+	client    *nomad.Client
+	namespace string
+	path      string
+}
+
+func NewNomadStateStore(_nc *nomad.Client, _namespace string, _path string) *NomadStateStore {
+	return &NomadStateStore{
+		client:    _nc,
+		namespace: _namespace,
+		path:      _path,
+	}
+}
+
+func (s *NomadStateStore) Load() ([]byte, error) {
+	lvar, _, lerr := s.client.Variables().Peek(s.path, &nomad.QueryOptions{Namespace: s.namespace})
+	if lerr != nil {
+		return nil, fmt.Errorf("can't read nomad variable %s due: %s", s.path, lerr)
+	}
+
+	if lvar == nil {
+		return nil, nil
+	}
+
+	lencoded, lok := lvar.Items[cNomadStateStoreItem]
+	if !lok {
+		return nil, nil
+	}
+
+	lcompressed, lerr := base64.StdEncoding.DecodeString(lencoded)
+	if lerr != nil {
+		return nil, fmt.Errorf("can't decode nomad variable %s due: %s", s.path, lerr)
+	}
+
+	lreader, lerr := gzip.NewReader(bytes.NewReader(lcompressed))
+	if lerr != nil {
+		return nil, fmt.Errorf("can't decompress nomad variable %s due: %s", s.path, lerr)
+	}
+	defer lreader.Close()
+
+	return io.ReadAll(lreader)
+}
+
+func (s *NomadStateStore) Save(_data []byte) error {
+	var lcompressed bytes.Buffer
+	lwriter := gzip.NewWriter(&lcompressed)
+
+	_, lerr := lwriter.Write(_data)
+	if lerr == nil {
+		lerr = lwriter.Close()
+	}
+	if lerr != nil {
+		return fmt.Errorf("can't compress state due: %s", lerr)
+	}
+
+	lvar := &nomad.Variable{
+		Namespace: s.namespace,
+		Path:      s.path,
+		Items: nomad.VariableItems{
+			cNomadStateStoreItem: base64.StdEncoding.EncodeToString(lcompressed.Bytes()),
+		},
+	}
+
+	_, _, lerr = s.client.Variables().Update(lvar, &nomad.WriteOptions{Namespace: s.namespace})
+	if lerr != nil {
+		return fmt.Errorf("can't write nomad variable %s due: %s", s.path, lerr)
+	}
+
+	return nil
+}
+
+func (s *NomadStateStore) Close() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestBoltStateStoreCheckpointRestore(t *testing.T) {
+	lstore, lerr := NewBoltStateStore(filepath.Join(t.TempDir(), "state.db"))
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	defer lstore.Close()
+
+	lrestored, lerr := LoadScalerState(lstore)
+	if lerr != nil || lrestored != nil {
+		t.Fatalf("empty store must return nil state, got: %v, %v", lrestored, lerr)
+	}
+
+	lpersist := NewPersistentState(nil)
+	lpersist.SetNomadLastIndex(1234)
+	lpersist.SetGC(map[string]*GCInfo{"node-1": {PoolName: "workers", SeenEmptyCiclesCount: 2, Collecting: true}})
+	lpersist.AddScaling(&InflightScaling{
+		Id:       "default/job",
+		FireTime: time.Now(),
+		Pools: map[string]*InflightPoolScaling{
+			"workers": {
+				EphemeralNodes:  []*structs.Node{{ID: "ephemeral-node"}},
+				EphemeralAllocs: []*structs.Allocation{{ID: "ephemeral-alloc", NodeID: "ephemeral-node"}},
+			},
+		},
+	})
+
+	lerr = lpersist.Checkpoint(lstore, map[string]*Pool{})
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lrestored, lerr = LoadScalerState(lstore)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lrestoredPersist := NewPersistentState(lrestored)
+	if lrestoredPersist.GetNomadLastIndex() != 1234 {
+		t.Fatalf("wrong restored nomad index: %d", lrestoredPersist.GetNomadLastIndex())
+	}
+
+	lgcInfo := lrestoredPersist.GetGC()["node-1"]
+	if lgcInfo == nil || lgcInfo.PoolName != "workers" || lgcInfo.SeenEmptyCiclesCount != 2 || lgcInfo.Collecting {
+		t.Fatalf("wrong restored gc info: %+v", lgcInfo)
+	}
+
+	lscalings := lrestoredPersist.GetScalings()
+	if len(lscalings) != 1 || lscalings[0].Pools["workers"].EphemeralAllocs[0].NodeID != "ephemeral-node" {
+		t.Fatalf("wrong restored scalings: %+v", lscalings)
+	}
+}
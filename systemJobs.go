@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/uuid"
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+// как часто перечитываем system jobs, их аллокации займут часть ресурсов каждой новой ноды
+const cSystemJobsRefreshPeriod = time.Minute
+
+// isScalableJobType returns false for system and sysbatch jobs, they are placed on every feasible node and never
+// queue, so new nodes only add more placements of them
+func isScalableJobType(_jobType string) bool {
+	return _jobType != structs.JobTypeSystem && _jobType != structs.JobTypeSysBatch
+}
+
+func taskGroupComparableResources(_tg *structs.TaskGroup) *structs.ComparableResources {
+	lresources := &structs.AllocatedResources{
+		Tasks:          map[string]*structs.AllocatedTaskResources{},
+		TaskLifecycles: map[string]*structs.TaskLifecycleConfig{},
+	}
+
+	if _tg.EphemeralDisk != nil {
+		lresources.Shared.DiskMB = int64(_tg.EphemeralDisk.SizeMB)
+	}
+
+	for _, ltask := range _tg.Tasks {
+		ltaskResources := &structs.AllocatedTaskResources{}
+		if ltask.Resources != nil {
+			ltaskResources.Cpu.CpuShares = int64(ltask.Resources.CPU)
+			ltaskResources.Memory.MemoryMB = int64(ltask.Resources.MemoryMB)
+		}
+
+		lresources.Tasks[ltask.Name] = ltaskResources
+		lresources.TaskLifecycles[ltask.Name] = ltask.Lifecycle
+	}
+
+	return lresources.Comparable()
+}
+
+// systemJobsFootprint sums resources of task groups of system jobs, which nomad will place on every new node of pool
+func systemJobsFootprint(_jobs []*structs.Job, _spec *PoolNodeSpec) *structs.ComparableResources {
+	lfootprint := &structs.ComparableResources{}
+	lnode := _spec.GetNode(uuid.Generate())
+
+	for _, ljob := range _jobs {
+		if ljob.Type != structs.JobTypeSystem || ljob.Stop || !containsInSlice(ljob.Datacenters, lnode.Datacenter) {
+			continue
+		}
+
+		lpendingJob := ljob.Copy()
+		lpendingJob.Status = structs.JobStatusPending
+
+		for _, ltg := range lpendingJob.TaskGroups {
+			if getSuitableNodes(ltg.Name, lpendingJob, []*structs.Node{lnode})[ltg.Name] == "" {
+				continue
+			}
+
+			lfootprint.Add(taskGroupComparableResources(ltg))
+		}
+	}
+
+	return lfootprint
+}
+
+// reserveFootprint marks resources of _footprint on synthetic node as reserved, so they are not used by binpacking
+func reserveFootprint(_node *structs.Node, _footprint *structs.ComparableResources) {
+	if _footprint == nil {
+		return
+	}
+
+	if _node.ReservedResources == nil {
+		_node.ReservedResources = &structs.NodeReservedResources{}
+	}
+	_node.ReservedResources.Cpu.CpuShares += _footprint.Flattened.Cpu.CpuShares
+	_node.ReservedResources.Memory.MemoryMB += _footprint.Flattened.Memory.MemoryMB
+	_node.ReservedResources.Disk.DiskMB += _footprint.Shared.DiskMB
+
+	if _node.Reserved == nil {
+		_node.Reserved = &structs.Resources{}
+	}
+	_node.Reserved.CPU += int(_footprint.Flattened.Cpu.CpuShares)
+	_node.Reserved.MemoryMB += int(_footprint.Flattened.Memory.MemoryMB)
+	_node.Reserved.DiskMB += int(_footprint.Shared.DiskMB)
+}
+
+func listSystemJobs(_stalecnf *StaleApiConfig, _nc *nomad.Client, _namespace string) ([]*structs.Job, error) {
+	if _namespace == "" {
+		_namespace = "*"
+	}
+
+	lstubs, _, lerr := _nc.Jobs().List(&nomad.QueryOptions{Namespace: _namespace, AllowStale: _stalecnf.Allow})
+	if lerr != nil {
+		return nil, fmt.Errorf("can't list jobs due: %s", lerr)
+	}
+
+	ljobs := []*structs.Job{}
+	for _, lstub := range lstubs {
+		if lstub.Type != structs.JobTypeSystem || lstub.Stop {
+			continue
+		}
+
+		ljob, _, lerr := _nc.Jobs().Info(lstub.ID, &nomad.QueryOptions{Namespace: lstub.Namespace, AllowStale: _stalecnf.Allow})
+		if lerr != nil {
+			return nil, fmt.Errorf("can't get system job %s/%s due: %s", lstub.Namespace, lstub.ID, lerr)
+		}
+
+		ljob.Canonicalize()
+		ljobs = append(ljobs, apiNomadJobToStructsJobV2(ljob))
+	}
+
+	return ljobs, nil
+}
+
+// watchSystemJobs periodically updates footprint of system jobs on new nodes of every pool
+func watchSystemJobs(_stalecnf *StaleApiConfig, _nc *nomad.Client, _namespace string, _pools *PoolSet) {
+	logger := hclog.L().Named("systemjobs")
+
+	for {
+		ljobs, lerr := listSystemJobs(_stalecnf, _nc, _namespace)
+		if lerr != nil {
+			logger.Error(fmt.Sprintf("can't refresh system jobs due: %s", lerr))
+		} else {
+			for _, lpool := range _pools.Pools() {
+				lfootprint := systemJobsFootprint(ljobs, lpool.poolnodespec)
+				lpool.SetSystemFootprint(lfootprint)
+				logger.Debug(fmt.Sprintf("system jobs footprint on new node: cpu %d, mem %dMb, disk %dMb", lfootprint.Flattened.Cpu.CpuShares, lfootprint.Flattened.Memory.MemoryMB, lfootprint.Shared.DiskMB), "pool", lpool.GetName())
+			}
+		}
+
+		time.Sleep(cSystemJobsRefreshPeriod)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+)
+
+func TestSystemJobsFootprint(t *testing.T) {
+	lpoolSpecs, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 100
+  drivers:
+    - docker
+  provider:
+    name: anynode
+`))
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lpool, lerr := NewPool(lpoolSpecs[0])
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lparseJob := func(_name string, _text string) *structs.Job {
+		lapiJob, lerr := parseJobFile(writeTestFile(t, _name, _text))
+		if lerr != nil {
+			t.Fatal(lerr)
+		}
+
+		return apiNomadJobToStructsJobV2(lapiJob)
+	}
+
+	lsystemJobs := []*structs.Job{
+		lparseJob("logs.nomad", `
+job "logs" {
+  datacenters = ["test"]
+  type        = "system"
+
+  group "shipper" {
+    task "vector" {
+      driver = "docker"
+      config {
+        image = "vector"
+      }
+      resources {
+        cpu    = 250
+        memory = 25
+      }
+    }
+  }
+}
+`),
+		lparseJob("othersdc.nomad", `
+job "othersdc" {
+  datacenters = ["other"]
+  type        = "system"
+
+  group "agent" {
+    task "agent" {
+      driver = "docker"
+      config {
+        image = "agent"
+      }
+      resources {
+        cpu    = 300
+        memory = 30
+      }
+    }
+  }
+}
+`),
+		lparseJob("exec.nomad", `
+job "exec" {
+  datacenters = ["test"]
+  type        = "system"
+
+  group "agent" {
+    task "agent" {
+      driver = "exec"
+      config {
+        command = "agent"
+      }
+      resources {
+        cpu    = 300
+        memory = 30
+      }
+    }
+  }
+}
+`),
+	}
+
+	lfootprint := systemJobsFootprint(lsystemJobs, lpoolSpecs[0])
+	if lfootprint.Flattened.Cpu.CpuShares != 250 || lfootprint.Flattened.Memory.MemoryMB != 25 {
+		t.Fatalf("only system job feasible on pool node must be counted, got cpu %d, mem %d", lfootprint.Flattened.Cpu.CpuShares, lfootprint.Flattened.Memory.MemoryMB)
+	}
+
+	ljob := lparseJob("web.nomad", `
+job "web" {
+  datacenters = ["test"]
+
+  group "app" {
+    count = 6
+
+    task "server" {
+      driver = "docker"
+      config {
+        image = "nginx"
+      }
+      resources {
+        cpu    = 400
+        memory = 40
+      }
+    }
+  }
+}
+`)
+
+	lnodes, _ := estimateRequiredNodes(lpool, nil, nil, ljob, ljob.TaskGroups[0], 6)
+	if len(lnodes) != 3 {
+		t.Fatalf("without system jobs 2 allocs must fit node, got %d nodes", len(lnodes))
+	}
+
+	lpool.SetSystemFootprint(lfootprint)
+	lnodes, _ = estimateRequiredNodes(lpool, nil, nil, ljob, ljob.TaskGroups[0], 6)
+	if len(lnodes) != 6 {
+		t.Fatalf("with system jobs only 1 alloc must fit node, got %d nodes", len(lnodes))
+	}
+
+	lplans := planJob(lpoolSpecs, lsystemJobs[0], 0)
+	if len(lplans) != 1 || lplans[0].Pool != "" || len(lplans[0].Infeasible) != 1 {
+		t.Fatalf("system job must not be planned, got %+v", lplans[0])
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/armon/go-metrics"
+	"github.com/armon/go-metrics/prometheus"
+	"github.com/hashicorp/go-hclog"
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func poolLabels(_poolName string) []metrics.Label {
+	return []metrics.Label{{Name: "pool", Value: _poolName}}
+}
+
+// setupTelemetry fans metrics out to all configured sinks, prometheus metrics are served on their own listener
+func setupTelemetry(_cnf *TelemetryConfig) error {
+	lmetricsConfig := metrics.DefaultConfig(_cnf.Prefix)
+	lmetricsConfig.EnableHostname = false
+	lmetricsConfig.EnableRuntimeMetrics = false
+
+	lsinks := metrics.FanoutSink{}
+
+	if _cnf.StatSiteAddr != "" {
+		lstatsSink, lerr := metrics.NewStatsiteSink(_cnf.StatSiteAddr)
+		if lerr != nil {
+			return fmt.Errorf("can't init statsite sink due: %s", lerr)
+		}
+		lsinks = append(lsinks, lstatsSink)
+	}
+
+	for _, lpromcnf := range _cnf.Prometheus {
+		lregistry := prometheusclient.NewRegistry()
+		lpromSink, lerr := prometheus.NewPrometheusSinkFrom(prometheus.PrometheusOpts{
+			Expiration: max(lpromcnf.Expiration, 0), // отрицательное значение - никогда не удалять, для sink это 0
+			Registerer: lregistry,
+		})
+		if lerr != nil {
+			return fmt.Errorf("can't init prometheus sink due: %s", lerr)
+		}
+
+		llistener, lerr := net.Listen("tcp", lpromcnf.BindAddr)
+		if lerr != nil {
+			return fmt.Errorf("can't listen on %s due: %s", lpromcnf.BindAddr, lerr)
+		}
+
+		lmux := http.NewServeMux()
+		lmux.Handle("/metrics", promhttp.HandlerFor(lregistry, promhttp.HandlerOpts{}))
+
+		go func() {
+			lerr := http.Serve(llistener, lmux)
+			hclog.L().Named("telemetry").Error(fmt.Sprintf("prometheus metrics endpoint stopped due: %s", lerr))
+		}()
+
+		hclog.L().Named("telemetry").Info(fmt.Sprintf("serving prometheus metrics on %s/metrics", llistener.Addr()))
+		lsinks = append(lsinks, lpromSink)
+	}
+
+	if len(lsinks) == 0 {
+		return fmt.Errorf("no any telemetry sinks configured")
+	}
+
+	_, lerr := metrics.NewGlobal(lmetricsConfig, lsinks)
+	return lerr
+}
@@ -22,12 +22,102 @@ type ScalingEvent struct {
 	CtxCancelFn   context.CancelFunc
 }
 
+// RestoredScalingEvents passed to processEvals when scaler becomes leader, Done closed after events accepted
+type RestoredScalingEvents struct {
+	Events map[string]*ScalingEvent
+	Done   chan struct{}
+}
+
+const (
+	ScalingCancelDequeued  = "dequeued"
+	ScalingCancelCancelled = "cancelled"
+	ScalingCancelNotFound  = "notfound"
+)
+
+// ScalingCancelRequest asks processEvals to drop scaling event of chain, Result receives one of ScalingCancel* values
+type ScalingCancelRequest struct {
+	Id     string
+	Result chan string
+}
+
+const (
+	GCRemoveDraining = "draining"
+	GCRemoveNotFound = "notfound"
+	GCRemoveDryRun   = "dryrun"
+	GCRemoveFailed   = "failed"
+)
+
+// GCRemoveResult is result of removal request for one node, Status is one of GCRemove* values
+type GCRemoveResult struct {
+	Status string
+	Err    error
+}
+
+// GCRemoveRequest asks gc to drain nodes of pool and remove them through node provider after drain completes, Result
+// receives result for every requested node
+type GCRemoveRequest struct {
+	Pool  string
+	Nodes []string
+	// пул, убранный перезагрузкой конфига, в PoolSet его уже нет
+	Retired *Pool
+	Result  chan map[string]*GCRemoveResult
+}
+
 type Config struct {
 	PoolConfig     string                    `mapstructure:"poolconfig" hcl:"poolconfig,label"`
+	MaxNodes       int                       `mapstructure:"max_nodes" hcl:"max_nodes"`
 	GC             []*GarbageCollectorConfig `hcl:"gc,block"`
 	Telemetry      []*TelemetryConfig        `hcl:"telemetry,block"`
 	StaleNomadApi  []*StaleApiConfig         `hcl:"stalenomadapi,block"`
 	HungPrevention []*HungPreventionConfig   `hcl:"hungprevention,block"`
+	State          []*StateStoreConfig       `hcl:"state,block"`
+	Leader         []*LeaderElectionConfig   `hcl:"leader,block"`
+	HttpApi        []*HttpApiConfig          `mapstructure:"http" hcl:"http,block"`
+	Nomad          []*NomadClientConfig      `mapstructure:"nomad" hcl:"nomad,block"`
+	Filter         []*FilterConfig           `mapstructure:"filter" hcl:"filter,block"`
+}
+
+// FilterConfig decides which jobs may trigger scaling, empty allow lists allow everything, deny lists win
+type FilterConfig struct {
+	Namespaces        []*NamePattern `mapstructure:"namespaces" hcl:"namespaces"`
+	ExcludeNamespaces []*NamePattern `mapstructure:"exclude_namespaces" hcl:"exclude_namespaces"`
+	Jobs              []*NamePattern `mapstructure:"jobs" hcl:"jobs"`
+	ExcludeJobs       []*NamePattern `mapstructure:"exclude_jobs" hcl:"exclude_jobs"`
+	JobTypes          []string       `mapstructure:"job_types" hcl:"job_types"`
+	OptOutMeta        string         `mapstructure:"optout_meta" hcl:"optout_meta"`
+}
+
+type NomadClientConfig struct {
+	Address         string        `mapstructure:"address" hcl:"address"`
+	Region          string        `mapstructure:"region" hcl:"region"`
+	Namespace       string        `mapstructure:"namespace" hcl:"namespace"`
+	Token           string        `mapstructure:"token" hcl:"token"`
+	TokenFile       string        `mapstructure:"token_file" hcl:"token_file"`
+	TokenFilePeriod time.Duration `mapstructure:"token_file_period" hcl:"token_file_period"`
+	CACert          string        `mapstructure:"ca_cert" hcl:"ca_cert"`
+	ClientCert      string        `mapstructure:"client_cert" hcl:"client_cert"`
+	ClientKey       string        `mapstructure:"client_key" hcl:"client_key"`
+	TLSServerName   string        `mapstructure:"tls_server_name" hcl:"tls_server_name"`
+	TLSSkipVerify   bool          `mapstructure:"tls_skip_verify" hcl:"tls_skip_verify"`
+}
+
+type HttpApiConfig struct {
+	BindAddr string `mapstructure:"bind_addr" hcl:"bind_addr"`
+	Token    string `mapstructure:"token" hcl:"token"`
+}
+
+type LeaderElectionConfig struct {
+	Type      string        `mapstructure:"type" hcl:"type"`
+	Path      string        `mapstructure:"path" hcl:"path"`
+	Namespace string        `mapstructure:"namespace" hcl:"namespace"`
+	TTL       time.Duration `mapstructure:"ttl" hcl:"ttl"`
+}
+
+type StateStoreConfig struct {
+	Type             string        `mapstructure:"type" hcl:"type"`
+	Path             string        `mapstructure:"path" hcl:"path"`
+	Namespace        string        `mapstructure:"namespace" hcl:"namespace"`
+	CheckpointPeriod time.Duration `mapstructure:"checkpoint_period" hcl:"checkpoint_period"`
 }
 
 type HungPreventionConfig struct {
@@ -41,18 +131,42 @@ type StaleApiConfig struct {
 }
 
 type GarbageCollectorConfig struct {
-	CiclesToGc     int              `mapstructure:"cicles_to_gc" hcl:"cicles_to_gc,label"`
-	CiclePeriod    time.Duration    `mapstructure:"cicle_period" hcl:"cicle_period"`
-	AllowedFreexpr *exprtk.GoExprtk `mapstructure:"allowed_freexpr" hcl:"allowed_freexpr,label"`
+	CiclesToGc        int              `mapstructure:"cicles_to_gc" hcl:"cicles_to_gc,label"`
+	CiclePeriod       time.Duration    `mapstructure:"cicle_period" hcl:"cicle_period"`
+	AllowedFreexpr    *exprtk.GoExprtk `mapstructure:"allowed_freexpr" hcl:"allowed_freexpr,label"`
+	RemoveTimeout     time.Duration    `mapstructure:"remove_timeout" hcl:"remove_timeout"`
+	DrainRetiredPools bool             `mapstructure:"drain_retired_pools" hcl:"drain_retired_pools"`
+	// сколько nomad ждет миграции аллокаций с ноды, прежде чем остановить их принудительно, 0 - ждет сколько угодно,
+	// nil только пока не выставлено умолчание
+	DrainDeadline *time.Duration `mapstructure:"drain_deadline" hcl:"drain_deadline"`
+	// аллокации останавливаются сразу, не дожидаясь миграции, drain_deadline тогда не используется
+	DrainForce            bool `mapstructure:"drain_force" hcl:"drain_force"`
+	DrainIgnoreSystemJobs bool `mapstructure:"drain_ignore_system_jobs" hcl:"drain_ignore_system_jobs"`
+	// какие аллокации делают ноду занятой, аллокации остальных job не мешают собрать ноду
+	BusyJobTypes   []string       `mapstructure:"busy_job_types" hcl:"busy_job_types"`
+	BusyNamespaces []*NamePattern `mapstructure:"busy_namespaces" hcl:"busy_namespaces"`
+	IdleNamespaces []*NamePattern `mapstructure:"idle_namespaces" hcl:"idle_namespaces"`
+	IdleMeta       string         `mapstructure:"idle_meta" hcl:"idle_meta"`
+	// переупаковка недогруженных нод: их аллокации переносятся на остальные ноды пула, а сами ноды удаляются
+	Consolidate            bool    `mapstructure:"consolidate" hcl:"consolidate"`
+	ConsolidateMaxNodes    int     `mapstructure:"consolidate_max_nodes" hcl:"consolidate_max_nodes"`
+	ConsolidateUtilization float64 `mapstructure:"consolidate_utilization" hcl:"consolidate_utilization"`
 }
 
 type TelemetryConfig struct {
-	StatSiteAddr string `mapstructure:"statsiteaddr" hcl:"statsiteaddr,label"`
-	Prefix       string `mapstructure:"prefix" hcl:"prefix,label"`
+	StatSiteAddr string              `mapstructure:"statsiteaddr" hcl:"statsiteaddr,label"`
+	Prefix       string              `mapstructure:"prefix" hcl:"prefix,label"`
+	Prometheus   []*PrometheusConfig `mapstructure:"prometheus" hcl:"prometheus,block"`
+}
+
+type PrometheusConfig struct {
+	BindAddr   string        `mapstructure:"bind_addr" hcl:"bind_addr"`
+	Expiration time.Duration `mapstructure:"expiration" hcl:"expiration"`
 }
 
 type Opts struct {
 	Verbose      []bool `short:"v" description:"Verbosity level"`
 	ScaleThreads int    `long:"scalethreads" default:"1" description:"Number of scale threads"`
 	ConfigPath   string `short:"c" long:"configpath" description:"Path to config file"`
+	DryRun       bool   `long:"dry-run" description:"Only log and record what would be done with nodes, never call node providers to change them or drain nodes"`
 }
@@ -80,6 +80,8 @@ func variantToTypes(_v Variant) interface{} {
 		retval = *_v.GetIntValue()
 	case VariantTypeString:
 		retval = *_v.GetStringValue()
+	case VariantTypeFloat:
+		retval = *_v.GetFloatValue()
 	case VariantTypeSlice:
 		lvs := _v.GetSliceValue()
 		retvals := make([]interface{}, 0, len(lvs))
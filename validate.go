@@ -0,0 +1,486 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+	"github.com/tantra35/nomad-ondemand-scaler/nodeprovider"
+	"gopkg.in/yaml.v3"
+)
+
+type ValidationError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+// ValidateCommand is "validate" subcommand, it checks scaler config and pool yaml without starting scaler
+type ValidateCommand struct {
+	opts *Opts
+}
+
+func (c *ValidateCommand) Execute(_args []string) error {
+	setVerbosity(c.opts.Verbose)
+
+	lerrors, lpoolConfig := validateConfigFile(c.opts.ConfigPath)
+	if lpoolConfig != "" {
+		lerrors = append(lerrors, validatePoolsFile(lpoolConfig)...)
+	}
+
+	for _, lerr := range lerrors {
+		fmt.Println(lerr)
+	}
+
+	if len(lerrors) > 0 {
+		return fmt.Errorf("found %d errors", len(lerrors))
+	}
+
+	fmt.Println("config and pools are valid")
+	return nil
+}
+
+// validateConfigFile returns found errors and path to pool yaml from config
+func validateConfigFile(_path string) ([]*ValidationError, string) {
+	lconfigbytes, lerr := os.ReadFile(_path)
+	if lerr != nil {
+		return []*ValidationError{{File: _path, Msg: lerr.Error()}}, ""
+	}
+
+	lconfigast, lerr := hcl.ParseBytes(lconfigbytes)
+	if lerr != nil {
+		return []*ValidationError{{File: _path, Msg: lerr.Error()}}, ""
+	}
+
+	lroot, lok := lconfigast.Node.(*ast.ObjectList)
+	if !lok {
+		return []*ValidationError{{File: _path, Msg: "config root must be object"}}, ""
+	}
+
+	lerrors := validateHclObject(_path, "config", lroot, reflect.TypeOf(Config{}))
+
+	var config Config
+	lerr = configParse(_path, &config) // большинство ошибок уже найдены выше, тут нужен путь до yaml пулов
+	if lerr != nil && len(lerrors) == 0 {
+		lerrors = append(lerrors, &ValidationError{File: _path, Msg: lerr.Error()})
+	}
+
+	if config.PoolConfig == "" {
+		lerrors = append(lerrors, &ValidationError{File: _path, Msg: "poolconfig is required"})
+	}
+
+	return lerrors, config.PoolConfig
+}
+
+func findConfigField(_type reflect.Type, _key string) *reflect.StructField {
+	for li := 0; li < _type.NumField(); li++ {
+		lfield := _type.Field(li)
+
+		lname := strings.Split(lfield.Tag.Get("mapstructure"), ",")[0]
+		if lname == "" {
+			lname = lfield.Name
+		}
+
+		// mapstructure сопоставляет ключи без учета регистра
+		if strings.EqualFold(lname, _key) {
+			return &lfield
+		}
+	}
+
+	return nil
+}
+
+// validateHclObject checks every key of _list against struct _type, block keys are checked recursively, and
+// every attribute is decoded alone, so decoding error points to its line
+func validateHclObject(_file string, _section string, _list *ast.ObjectList, _type reflect.Type) []*ValidationError {
+	lerrors := []*ValidationError{}
+
+	for _, litem := range _list.Items {
+		lline := litem.Pos().Line
+		lkey := strings.Trim(litem.Keys[0].Token.Text, `"`)
+
+		lfield := findConfigField(_type, lkey)
+		if lfield == nil {
+			lerrors = append(lerrors, &ValidationError{File: _file, Line: lline, Msg: fmt.Sprintf("unknown key %q in %s", lkey, _section)})
+			continue
+		}
+
+		lblockType := lfield.Type
+		lisBlock := lblockType.Kind() == reflect.Slice && lblockType.Elem().Kind() == reflect.Ptr && lblockType.Elem().Elem().Kind() == reflect.Struct &&
+			lblockType.Elem() != reflect.TypeOf(&NamePattern{}) // паттерны задаются строками
+		lobject, lisObject := litem.Val.(*ast.ObjectType)
+
+		if lisBlock != lisObject {
+			if lisBlock {
+				lerrors = append(lerrors, &ValidationError{File: _file, Line: lline, Msg: fmt.Sprintf("%q in %s must be block", lkey, _section)})
+			} else {
+				lerrors = append(lerrors, &ValidationError{File: _file, Line: lline, Msg: fmt.Sprintf("%q in %s must be attribute", lkey, _section)})
+			}
+			continue
+		}
+
+		if lisBlock {
+			if len(litem.Keys) > 1 {
+				lerrors = append(lerrors, &ValidationError{File: _file, Line: lline, Msg: fmt.Sprintf("block %q in %s must not have labels", lkey, _section)})
+			}
+
+			lerrors = append(lerrors, validateHclObject(_file, lkey, lobject.List, lblockType.Elem().Elem())...)
+			continue
+		}
+
+		var m map[string]interface{}
+		lerr := hcl.DecodeObject(&m, &ast.ObjectList{Items: []*ast.ObjectItem{litem}})
+		if lerr == nil {
+			var ldecoder *mapstructure.Decoder
+			ldecoder, lerr = mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				DecodeHook:       decodeVariable,
+				Result:           reflect.New(_type).Interface(),
+				WeaklyTypedInput: true,
+			})
+			if lerr == nil {
+				lerr = ldecoder.Decode(m)
+			}
+		}
+
+		if lerr != nil {
+			lerrors = append(lerrors, &ValidationError{File: _file, Line: lline, Msg: fmt.Sprintf("wrong value of %q in %s: %s", lkey, _section, lerr)})
+		}
+	}
+
+	return lerrors
+}
+
+func validatePoolsFile(_path string) []*ValidationError {
+	lfileData, lerr := os.ReadFile(_path)
+	if lerr != nil {
+		return []*ValidationError{{File: _path, Msg: lerr.Error()}}
+	}
+
+	var ldoc yaml.Node
+	lerr = yaml.Unmarshal(lfileData, &ldoc)
+	if lerr != nil {
+		return []*ValidationError{{File: _path, Msg: lerr.Error()}}
+	}
+
+	if len(ldoc.Content) == 0 || ldoc.Content[0].Kind != yaml.SequenceNode {
+		return []*ValidationError{{File: _path, Line: ldoc.Line, Msg: "pools must be list"}}
+	}
+
+	lpoolNodes := ldoc.Content[0].Content
+	lerrors := []*ValidationError{}
+	for _, lpoolNode := range lpoolNodes {
+		lerrors = append(lerrors, validatePoolNode(_path, lpoolNode)...)
+	}
+
+	if len(lerrors) > 0 {
+		return lerrors
+	}
+
+	// структура верна, теперь проверяем то, что можно проверить только после разбора пулов
+	lpoolSpecs, lerr := parsePoolDifinition(_path)
+	if lerr != nil {
+		return []*ValidationError{{File: _path, Msg: lerr.Error()}}
+	}
+
+	lnamesLines := map[string]int{}
+	for li, lpoolSpec := range lpoolSpecs {
+		if lname := lpoolSpec.GetShortName(); lname != "" {
+			if lotherLine, lok := lnamesLines[lname]; lok {
+				lerrors = append(lerrors, &ValidationError{File: _path, Line: lpoolNodes[li].Line, Msg: fmt.Sprintf("pool name %q already used by pool at line %d", lname, lotherLine)})
+			} else {
+				lnamesLines[lname] = lpoolNodes[li].Line
+			}
+		}
+	}
+
+	for li, lpoolSpec := range lpoolSpecs {
+		lline := lpoolNodes[li].Line
+
+		lfallback, _ := lpoolSpec.GetFallback()
+		for _, lfallbackName := range lfallback {
+			if _, lok := lnamesLines[lfallbackName]; !lok {
+				lerrors = append(lerrors, &ValidationError{File: _path, Line: lline, Msg: fmt.Sprintf("unknown fallback pool %q", lfallbackName)})
+			} else if lfallbackName == lpoolSpec.GetShortName() {
+				lerrors = append(lerrors, &ValidationError{File: _path, Line: lline, Msg: "pool can't fall back to itself"})
+			}
+		}
+
+		lres := lpoolSpec.GetResources()
+		if lreserved, lok := lpoolSpec.Attributes["reserved"]; lok {
+			for lresName, lreservedValue := range lreserved.GetMapValue() {
+				lcapacity := map[string]int{"cpu": lres.Cpu, "mem": lres.MemMB, "disk": lres.DiskMB}[lresName]
+				if lreservedValue.GetType() == VariantTypeInt && *lreservedValue.GetIntValue() >= lcapacity {
+					lerrors = append(lerrors, &ValidationError{File: _path, Line: lline, Msg: fmt.Sprintf("reserved %s %d is not less than pool %s %d", lresName, *lreservedValue.GetIntValue(), lresName, lcapacity)})
+				}
+			}
+		}
+
+		if lminNodes, lmaxNodes := lpoolSpec.GetNodeBounds(); lmaxNodes > 0 && lminNodes > lmaxNodes {
+			lerrors = append(lerrors, &ValidationError{File: _path, Line: lline, Msg: fmt.Sprintf("min %d nodes is greater than max %d nodes", lminNodes, lmaxNodes)})
+		}
+
+		lprovider := lpoolSpec.Attributes["provider"].GetMapValue()
+		lproviderName := *lprovider["name"].GetStringValue()
+		lschema, lerr := nodeprovider.GetProviderSchema(lproviderName)
+		if lerr == nil {
+			var lparams interface{}
+			if lparamsVariant, lok := lprovider["params"]; lok {
+				lparams = variantToTypes(lparamsVariant)
+			}
+			lerr = lschema.Validate(lparams)
+		}
+		if lerr != nil {
+			lerrors = append(lerrors, &ValidationError{File: _path, Line: lline, Msg: fmt.Sprintf("wrong provider: %s", lerr)})
+		}
+	}
+
+	for li, lpoolSpec := range lpoolSpecs {
+		// FullName содержит compute class, поэтому считаем его так же, как NewPoolNodeSpec
+		if _, lerr := (&PoolNodeSpec{Attributes: lpoolSpec.Attributes}).ComputeClass(); lerr != nil {
+			lerrors = append(lerrors, &ValidationError{File: _path, Line: lpoolNodes[li].Line, Msg: fmt.Sprintf("can't compute class of pool: %s", lerr)})
+		}
+	}
+
+	for _, lduplicate := range findDuplicatePools(lpoolSpecs) {
+		lerrors = append(lerrors, &ValidationError{File: _path, Line: lpoolNodes[lduplicate.OtherIndex].Line, Msg: fmt.Sprintf("pool is the same as pool at line %d(%s), pools must not overlap", lpoolNodes[lduplicate.Index].Line, lpoolSpecs[lduplicate.OtherIndex].GetFullName())})
+	}
+
+	for _, loverlap := range findPoolOverlaps(lpoolSpecs) {
+		lerrors = append(lerrors, &ValidationError{File: _path, Line: lpoolNodes[loverlap.OtherIndex].Line, Msg: fmt.Sprintf("overlaps with pool at line %d: %s", lpoolNodes[loverlap.Index].Line, loverlap.Msg)})
+	}
+
+	return lerrors
+}
+
+func yamlNodeIs(_node *yaml.Node, _tags ...string) bool {
+	if _node.Kind != yaml.ScalarNode {
+		return false
+	}
+
+	for _, ltag := range _tags {
+		if _node.ShortTag() == ltag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateYamlSize(_path string, _name string, _node *yaml.Node) *ValidationError {
+	if yamlNodeIs(_node, "!!int") {
+		return nil
+	}
+
+	if yamlNodeIs(_node, "!!str") {
+		if _, lerr := humanize.ParseBytes(_node.Value); lerr != nil {
+			return &ValidationError{File: _path, Line: _node.Line, Msg: fmt.Sprintf("wrong size in %s: %s", _name, lerr)}
+		}
+
+		return nil
+	}
+
+	return &ValidationError{File: _path, Line: _node.Line, Msg: fmt.Sprintf("%s must be int(MiB) or size string", _name)}
+}
+
+func validatePoolNode(_path string, _node *yaml.Node) []*ValidationError {
+	if _node.Kind != yaml.MappingNode {
+		return []*ValidationError{{File: _path, Line: _node.Line, Msg: "pool must be map"}}
+	}
+
+	lerrors := []*ValidationError{}
+	addError := func(_line int, _format string, _args ...interface{}) {
+		lerrors = append(lerrors, &ValidationError{File: _path, Line: _line, Msg: fmt.Sprintf(_format, _args...)})
+	}
+
+	lhaveProvider := false
+	for li := 0; li+1 < len(_node.Content); li += 2 {
+		lkey, lvalue := _node.Content[li].Value, _node.Content[li+1]
+
+		switch {
+		case lkey == "cpu":
+			if !yamlNodeIs(lvalue, "!!int") {
+				addError(lvalue.Line, "cpu must be int(MHz)")
+			}
+
+		case lkey == "mem" || lkey == "disk":
+			if lerr := validateYamlSize(_path, lkey, lvalue); lerr != nil {
+				lerrors = append(lerrors, lerr)
+			}
+
+		case lkey == "min" || lkey == "max":
+			if !yamlNodeIs(lvalue, "!!int") || strings.HasPrefix(lvalue.Value, "-") {
+				addError(lvalue.Line, "%s must be not negative int(nodes count)", lkey)
+			}
+
+		case lkey == "cost":
+			if !yamlNodeIs(lvalue, "!!int", "!!float") || strings.HasPrefix(lvalue.Value, "-") {
+				addError(lvalue.Line, "cost must be not negative number(cost of node per hour)")
+			}
+
+		case lkey == "fallback":
+			if lvalue.Kind != yaml.SequenceNode {
+				addError(lvalue.Line, "fallback must be list of pool names")
+				continue
+			}
+
+			for _, lname := range lvalue.Content {
+				if !yamlNodeIs(lname, "!!str") {
+					addError(lname.Line, "fallback pool name must be string")
+				}
+			}
+
+		case lkey == "fallback_after":
+			if !yamlNodeIs(lvalue, "!!str") {
+				addError(lvalue.Line, "fallback_after must be duration string")
+			} else if _, lerr := time.ParseDuration(lvalue.Value); lerr != nil {
+				addError(lvalue.Line, "wrong fallback_after: %s", lerr)
+			}
+
+		case lkey == "warm":
+			var lwarm VariantYamlUnmarshaled
+			if lerr := lvalue.Decode(&lwarm); lerr != nil {
+				addError(lvalue.Line, "wrong warm: %s", lerr)
+			} else if _, lerr := parseWarmWindows(&lwarm); lerr != nil {
+				addError(lvalue.Line, "%s", lerr)
+			}
+
+		case lkey == "gc":
+			var lgc VariantYamlUnmarshaled
+			if lerr := lvalue.Decode(&lgc); lerr != nil {
+				addError(lvalue.Line, "wrong gc: %s", lerr)
+			} else if _, lerr := parsePoolGCConfig(&lgc); lerr != nil {
+				addError(lvalue.Line, "%s", lerr)
+			}
+
+		case lkey == "datacenter" || lkey == "nodeclass" || lkey == "name":
+			if !yamlNodeIs(lvalue, "!!str") {
+				addError(lvalue.Line, "%s must be string", lkey)
+			}
+
+		case lkey == "drivers":
+			if lvalue.Kind != yaml.SequenceNode {
+				addError(lvalue.Line, "drivers must be list")
+				continue
+			}
+
+			for _, ldriver := range lvalue.Content {
+				if !yamlNodeIs(ldriver, "!!str") {
+					addError(ldriver.Line, "driver must be string")
+				}
+			}
+
+		case lkey == "reserved":
+			if lvalue.Kind != yaml.MappingNode {
+				addError(lvalue.Line, "reserved must be map")
+				continue
+			}
+
+			for lj := 0; lj+1 < len(lvalue.Content); lj += 2 {
+				lresName, lresValue := lvalue.Content[lj].Value, lvalue.Content[lj+1]
+				switch lresName {
+				case "cpu":
+					if !yamlNodeIs(lresValue, "!!int") {
+						addError(lresValue.Line, "reserved cpu must be int(MHz)")
+					}
+				case "mem", "disk":
+					if lerr := validateYamlSize(_path, "reserved "+lresName, lresValue); lerr != nil {
+						lerrors = append(lerrors, lerr)
+					}
+				default:
+					addError(lvalue.Content[lj].Line, "unknown key %q in reserved", lresName)
+				}
+			}
+
+		case lkey == "devices":
+			if lvalue.Kind != yaml.SequenceNode {
+				addError(lvalue.Line, "devices must be list")
+				continue
+			}
+
+			for _, ldevice := range lvalue.Content {
+				if ldevice.Kind != yaml.MappingNode {
+					addError(ldevice.Line, "device must be map")
+					continue
+				}
+
+				for lj := 0; lj+1 < len(ldevice.Content); lj += 2 {
+					ldevAttr, ldevValue := ldevice.Content[lj].Value, ldevice.Content[lj+1]
+					switch ldevAttr {
+					case "name", "type", "vendor":
+						if !yamlNodeIs(ldevValue, "!!str") {
+							addError(ldevValue.Line, "device %s must be string", ldevAttr)
+						}
+					case "count":
+						if !yamlNodeIs(ldevValue, "!!int") {
+							addError(ldevValue.Line, "device count must be int")
+						}
+					case "attr":
+						if ldevValue.Kind != yaml.MappingNode {
+							addError(ldevValue.Line, "device attr must be map")
+						}
+					default:
+						addError(ldevice.Content[lj].Line, "unknown key %q in device", ldevAttr)
+					}
+				}
+			}
+
+		case lkey == "provider":
+			lhaveProvider = true
+			if lvalue.Kind != yaml.MappingNode {
+				addError(lvalue.Line, "provider must be map")
+				continue
+			}
+
+			lhaveName := false
+			for lj := 0; lj+1 < len(lvalue.Content); lj += 2 {
+				switch lvalue.Content[lj].Value {
+				case "name":
+					lhaveName = true
+					if !yamlNodeIs(lvalue.Content[lj+1], "!!str") {
+						addError(lvalue.Content[lj+1].Line, "provider name must be string")
+					}
+				case "params":
+				default:
+					addError(lvalue.Content[lj].Line, "unknown key %q in provider", lvalue.Content[lj].Value)
+				}
+			}
+
+			if !lhaveName {
+				addError(lvalue.Line, "provider name is required")
+			}
+
+		case strings.HasPrefix(lkey, "attr."):
+			if !yamlNodeIs(lvalue, "!!str", "!!int", "!!bool") {
+				addError(lvalue.Line, "%s must be string, int or bool", lkey)
+			}
+
+		case strings.HasPrefix(lkey, "meta.") || strings.HasPrefix(lkey, "links."):
+			if !yamlNodeIs(lvalue, "!!str") {
+				addError(lvalue.Line, "%s must be string", lkey)
+			}
+
+		default:
+			addError(_node.Content[li].Line, "unknown key %q in pool", lkey)
+		}
+	}
+
+	if !lhaveProvider {
+		addError(_node.Line, "provider is required")
+	}
+
+	return lerrors
+}
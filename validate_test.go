@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, _name string, _data string) string {
+	lpath := filepath.Join(t.TempDir(), _name)
+	lerr := os.WriteFile(lpath, []byte(_data), 0644)
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	return lpath
+}
+
+func checkValidationErrors(t *testing.T, _errors []*ValidationError, _expected []string) {
+	if len(_errors) != len(_expected) {
+		t.Fatalf("expected %d errors, got: %v", len(_expected), _errors)
+	}
+
+	for li, lexpected := range _expected {
+		if !strings.Contains(_errors[li].Error(), lexpected) {
+			t.Fatalf("error %q must contain %q", _errors[li], lexpected)
+		}
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	lpath := writeTestFile(t, "config.hcl", `poolconfig = "./pools.yml"
+
+gc {
+  cicles_to_gc = 3
+  cicle_period = "1m"
+  allowed_freexpr = "min(totalnodes"
+  unknown_gc_key = 1
+}
+
+http {
+  bind_addr = "127.0.0.1:8080"
+}
+
+unknown_block {
+}
+`)
+
+	lerrors, lpoolConfig := validateConfigFile(lpath)
+	if lpoolConfig != "./pools.yml" {
+		t.Fatalf("wrong pool config: %q", lpoolConfig)
+	}
+
+	checkValidationErrors(t, lerrors, []string{
+		"config.hcl:6: wrong value of \"allowed_freexpr\" in gc",
+		"config.hcl:7: unknown key \"unknown_gc_key\" in gc",
+		"config.hcl:14: unknown key \"unknown_block\" in config",
+	})
+}
+
+func TestValidatePoolsFileStructure(t *testing.T) {
+	lpath := writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: "1000"
+  mem: 1Gib
+  unknown: value
+  reserved:
+    mem: lot
+  provider:
+    name: anynode
+- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  max: -1
+  fallback_after: soon
+  gc:
+    cicles_to_gc: 0
+`)
+
+	checkValidationErrors(t, validatePoolsFile(lpath), []string{
+		"pools.yml:2: cpu must be int",
+		"pools.yml:4: unknown key \"unknown\" in pool",
+		"pools.yml:6: wrong size in reserved mem",
+		"pools.yml:12: max must be not negative int",
+		"pools.yml:13: wrong fallback_after",
+		"pools.yml:15: cicles_to_gc must be positive int",
+		"pools.yml:9: provider is required",
+	})
+}
+
+func TestValidatePoolsFileSemantic(t *testing.T) {
+	lpath := writeTestFile(t, "pools.yml", `- datacenter: dc1
+  cpu: 1000
+  mem: 1Gib
+  reserved:
+    cpu: 2000
+  provider:
+    name: anynode
+  min: 3
+  max: 2
+- datacenter: dc2
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: awsautoscale
+- datacenter: test
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: awsautoscale
+    params:
+      - asg-a
+- datacenter: test
+  cpu: 2000
+  mem: 2Gib
+  provider:
+    name: awsautoscale
+    params:
+      - asg-a
+- name: gpu
+  datacenter: test
+  cpu: 4000
+  mem: 4Gib
+  fallback:
+    - gpu
+    - cpu
+  provider:
+    name: awsautoscale
+    params:
+      - asg-gpu
+- datacenter: dup
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: awsautoscale
+    params:
+      - asg-dup
+- datacenter: dup
+  cpu: 1000
+  mem: 1Gib
+  provider:
+    name: awsautoscale
+    params:
+      - asg-dup
+`)
+
+	checkValidationErrors(t, validatePoolsFile(lpath), []string{
+		"pools.yml:1: reserved cpu 2000 is not less than pool cpu 1000",
+		"pools.yml:1: min 3 nodes is greater than max 2 nodes",
+		"pools.yml:10: wrong provider: params is required",
+		"pools.yml:29: pool can't fall back to itself",
+		"pools.yml:29: unknown fallback pool \"cpu\"",
+		"pools.yml:47: pool is the same as pool at line 40",
+		"pools.yml:22: overlaps with pool at line 15: ",
+	})
+}
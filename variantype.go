@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"reflect"
+	"sort"
 	"strconv"
 
 	"github.com/mitchellh/hashstructure"
@@ -18,6 +19,7 @@ const (
 	VariantTypeString
 	VariantTypeSlice
 	VariantTypeMap
+	VariantTypeFloat
 )
 
 type Variant interface {
@@ -28,6 +30,7 @@ type Variant interface {
 	GetStringValue() *string
 	GetSliceValue() []Variant
 	GetMapValue() map[string]Variant
+	GetFloatValue() *float64
 }
 
 // -----------------------------------------------------------------------------
@@ -63,6 +66,10 @@ func (s *VariantIntValue) GetMapValue() map[string]Variant {
 	return nil
 }
 
+func (s *VariantIntValue) GetFloatValue() *float64 {
+	return nil
+}
+
 func (i *VariantIntValue) Hash() (uint64, error) {
 	s := strconv.Itoa(i.value)
 	h := fnv.New64a()
@@ -103,6 +110,10 @@ func (b *VariantBoolValue) GetMapValue() map[string]Variant {
 	return nil
 }
 
+func (b *VariantBoolValue) GetFloatValue() *float64 {
+	return nil
+}
+
 func (b *VariantBoolValue) Hash() (uint64, error) {
 	s := "false"
 	if b.value {
@@ -146,6 +157,10 @@ func (s *VariantStringValue) GetMapValue() map[string]Variant {
 	return nil
 }
 
+func (s *VariantStringValue) GetFloatValue() *float64 {
+	return nil
+}
+
 func (s *VariantStringValue) Hash() (uint64, error) {
 	h := fnv.New64a()
 	h.Write([]byte(s.value))
@@ -185,6 +200,10 @@ func (s *VariantSliceValue) GetMapValue() map[string]Variant {
 	return nil
 }
 
+func (s *VariantSliceValue) GetFloatValue() *float64 {
+	return nil
+}
+
 func (s *VariantSliceValue) Hash() (uint64, error) {
 	h := fnv.New64a()
 
@@ -232,10 +251,22 @@ func (s *VariantMapValue) GetMapValue() map[string]Variant {
 	return s.value
 }
 
+func (s *VariantMapValue) GetFloatValue() *float64 {
+	return nil
+}
+
 func (s *VariantMapValue) Hash() (uint64, error) {
 	h := fnv.New64a()
 
-	for k, v := range s.value {
+	// порядок обхода map случаен, без сортировки у одинаковых пулов разный compute class
+	keys := make([]string, 0, len(s.value))
+	for k := range s.value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := s.value[k]
 		_, err := h.Write([]byte(k))
 		if err != nil {
 			return 0, err
@@ -251,6 +282,50 @@ func (s *VariantMapValue) Hash() (uint64, error) {
 	return h.Sum64(), nil
 }
 
+// -----------------------------------------------------------------------------
+type VariantFloatValue struct {
+	value float64
+}
+
+func NewVariantFloatValue(_v float64) *VariantFloatValue {
+	return &VariantFloatValue{_v}
+}
+
+func (f *VariantFloatValue) GetType() VariantType {
+	return VariantTypeFloat
+}
+
+func (f *VariantFloatValue) GetIntValue() *int {
+	return nil
+}
+
+func (f *VariantFloatValue) GetBoolValue() *bool {
+	return nil
+}
+
+func (f *VariantFloatValue) GetStringValue() *string {
+	return nil
+}
+
+func (f *VariantFloatValue) GetSliceValue() []Variant {
+	return nil
+}
+
+func (f *VariantFloatValue) GetMapValue() map[string]Variant {
+	return nil
+}
+
+func (f *VariantFloatValue) GetFloatValue() *float64 {
+	return &f.value
+}
+
+func (f *VariantFloatValue) Hash() (uint64, error) {
+	s := strconv.FormatFloat(f.value, 'g', -1, 64)
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64(), nil
+}
+
 // -----------------------------------------------------------------------------
 type VariantYamlUnmarshaled struct {
 	value Variant
@@ -262,6 +337,8 @@ func NewVariantFromAnyType(anytype interface{}) (Variant, error) {
 	switch reflect.TypeOf(anytype).Kind() {
 	case reflect.Int:
 		value = NewVariantIntValue(int(reflect.ValueOf(anytype).Int()))
+	case reflect.Float32, reflect.Float64:
+		value = NewVariantFloatValue(reflect.ValueOf(anytype).Float())
 	case reflect.Bool:
 		value = NewVariantBoolValue(reflect.ValueOf(anytype).Bool())
 	case reflect.String:
@@ -329,6 +406,10 @@ func (s *VariantYamlUnmarshaled) GetMapValue() map[string]Variant {
 	return s.value.GetMapValue()
 }
 
+func (s *VariantYamlUnmarshaled) GetFloatValue() *float64 {
+	return s.value.GetFloatValue()
+}
+
 func (s *VariantYamlUnmarshaled) Hash() (uint64, error) {
 	return s.value.Hash()
 }
@@ -24,3 +24,17 @@ func TestVariantType(t *testing.T) {
 		t.Logf("v: %d", *vv.GetIntValue())
 	}
 }
+
+func TestVariantMapHash(t *testing.T) {
+	lvalue := map[string]Variant{}
+	for i := 0; i < 10; i++ {
+		lvalue[string(rune('a'+i))] = NewVariantIntValue(i)
+	}
+
+	lhash, _ := NewVariantMapValue(lvalue).Hash()
+	for i := 0; i < 10; i++ {
+		if lotherHash, _ := NewVariantMapValue(lvalue).Hash(); lotherHash != lhash {
+			t.Fatalf("hash of the same map must not change, got: %d and %d", lhash, lotherHash)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/cronexpr"
+)
+
+var cWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// WarmWindow is period of time when pool must have at least Idle free nodes. Window is either set by cron
+// expression of its start and its duration, or by weekdays and time of day(To less than From means window ends
+// next day)
+type WarmWindow struct {
+	Idle     int
+	Location *time.Location
+
+	Cron     *cronexpr.Expression
+	Duration time.Duration
+
+	Days map[time.Weekday]bool // nil - every day
+	From time.Duration         // от начала суток
+	To   time.Duration
+}
+
+func parseTimeOfDay(_value string) (time.Duration, error) {
+	lhours, lminutes, lok := strings.Cut(_value, ":")
+	if !lok {
+		return 0, fmt.Errorf("time of day %q must be in HH:MM format", _value)
+	}
+
+	var lh, lm int
+	if _, lerr := fmt.Sscanf(lhours+" "+lminutes, "%d %d", &lh, &lm); lerr != nil || len(lminutes) != 2 || lh < 0 || lm < 0 || lm > 59 || lh > 24 || (lh == 24 && lm != 0) {
+		return 0, fmt.Errorf("wrong time of day %q", _value)
+	}
+
+	return time.Duration(lh)*time.Hour + time.Duration(lm)*time.Minute, nil
+}
+
+func parseWarmWindow(_v Variant) (*WarmWindow, error) {
+	if _v.GetType() != VariantTypeMap {
+		return nil, fmt.Errorf("warm window must be map")
+	}
+
+	lwindow := &WarmWindow{Location: time.UTC, To: 24 * time.Hour}
+	lhaveIdle, lhaveDays := false, false
+	lstrings := map[string]string{}
+
+	for lkey, lvalue := range _v.GetMapValue() {
+		switch lkey {
+		case "idle":
+			if lvalue.GetType() != VariantTypeInt || *lvalue.GetIntValue() < 0 {
+				return nil, fmt.Errorf("idle must be not negative int(nodes count)")
+			}
+			lwindow.Idle = *lvalue.GetIntValue()
+			lhaveIdle = true
+
+		case "days":
+			if lvalue.GetType() != VariantTypeSlice {
+				return nil, fmt.Errorf("days must be list of weekdays")
+			}
+
+			lwindow.Days = map[time.Weekday]bool{}
+			for _, lday := range lvalue.GetSliceValue() {
+				if lday.GetType() != VariantTypeString {
+					return nil, fmt.Errorf("weekday must be string")
+				}
+
+				lweekday, lok := cWeekdays[strings.ToLower(*lday.GetStringValue())]
+				if !lok {
+					return nil, fmt.Errorf("unknown weekday %q, must be one of mon, tue, wed, thu, fri, sat, sun", *lday.GetStringValue())
+				}
+				lwindow.Days[lweekday] = true
+			}
+			lhaveDays = true
+
+		case "cron", "duration", "from", "to", "timezone":
+			if lvalue.GetType() != VariantTypeString {
+				return nil, fmt.Errorf("%s must be string", lkey)
+			}
+			lstrings[lkey] = *lvalue.GetStringValue()
+
+		default:
+			return nil, fmt.Errorf("unknown key %q in warm window", lkey)
+		}
+	}
+
+	if !lhaveIdle {
+		return nil, fmt.Errorf("idle is required in warm window")
+	}
+
+	if ltimezone, lok := lstrings["timezone"]; lok {
+		llocation, lerr := time.LoadLocation(ltimezone)
+		if lerr != nil {
+			return nil, fmt.Errorf("wrong timezone: %s", lerr)
+		}
+		lwindow.Location = llocation
+	}
+
+	if lcron, lok := lstrings["cron"]; lok {
+		if lhaveDays || lstrings["from"] != "" || lstrings["to"] != "" {
+			return nil, fmt.Errorf("cron can't be used with days, from and to")
+		}
+
+		lexpr, lerr := cronexpr.Parse(lcron)
+		if lerr != nil {
+			return nil, fmt.Errorf("wrong cron: %s", lerr)
+		}
+		lwindow.Cron = lexpr
+
+		lduration, lerr := time.ParseDuration(lstrings["duration"])
+		if lerr != nil || lduration <= 0 {
+			return nil, fmt.Errorf("positive duration is required with cron")
+		}
+		lwindow.Duration = lduration
+
+		return lwindow, nil
+	}
+
+	if _, lok := lstrings["duration"]; lok {
+		return nil, fmt.Errorf("duration can be used only with cron")
+	}
+
+	var lerr error
+	if lfrom, lok := lstrings["from"]; lok {
+		if lwindow.From, lerr = parseTimeOfDay(lfrom); lerr != nil {
+			return nil, lerr
+		}
+	}
+
+	if lto, lok := lstrings["to"]; lok {
+		if lwindow.To, lerr = parseTimeOfDay(lto); lerr != nil {
+			return nil, lerr
+		}
+	}
+
+	if lwindow.From == lwindow.To {
+		return nil, fmt.Errorf("from and to must differ")
+	}
+
+	return lwindow, nil
+}
+
+// parseWarmWindows parses "warm" attribute of pool
+func parseWarmWindows(_v Variant) ([]*WarmWindow, error) {
+	if _v.GetType() != VariantTypeSlice {
+		return nil, fmt.Errorf("warm must be list of windows")
+	}
+
+	lwindows := []*WarmWindow{}
+	for li, lwindowVariant := range _v.GetSliceValue() {
+		lwindow, lerr := parseWarmWindow(lwindowVariant)
+		if lerr != nil {
+			return nil, fmt.Errorf("wrong warm window %d: %s", li+1, lerr)
+		}
+		lwindows = append(lwindows, lwindow)
+	}
+
+	return lwindows, nil
+}
+
+func (w *WarmWindow) IsActive(_now time.Time) bool {
+	lnow := _now.In(w.Location)
+
+	if w.Cron != nil {
+		// окно активно, если последний запуск по cron был не раньше чем duration назад
+		lstart := w.Cron.Next(lnow.Add(-w.Duration))
+		return !lstart.IsZero() && !lstart.After(lnow)
+	}
+
+	lyear, lmonth, lday := lnow.Date()
+	ltimeOfDay := lnow.Sub(time.Date(lyear, lmonth, lday, 0, 0, 0, 0, w.Location))
+	lisDay := func(_weekday time.Weekday) bool {
+		return w.Days == nil || w.Days[_weekday]
+	}
+
+	if w.From < w.To {
+		return lisDay(lnow.Weekday()) && ltimeOfDay >= w.From && ltimeOfDay < w.To
+	}
+
+	// окно через полночь, дни задают день начала окна
+	return (lisDay(lnow.Weekday()) && ltimeOfDay >= w.From) || (lisDay((lnow.Weekday()+6)%7) && ltimeOfDay < w.To)
+}
+
+// warmIdleNodes returns free nodes count, which pool must have at _now by its warm windows
+func warmIdleNodes(_windows []*WarmWindow, _now time.Time) int {
+	lidle := 0
+	for _, lwindow := range _windows {
+		if lwindow.IsActive(_now) {
+			lidle = max(lidle, lwindow.Idle)
+		}
+	}
+
+	return lidle
+}
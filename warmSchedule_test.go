@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWarmWindows(t *testing.T) {
+	lpoolSpecs, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", `- datacenter: test
+  cpu: 1000
+  mem: 100
+  warm:
+    - days: [mon, tue, wed, thu, fri]
+      from: "08:30"
+      to: "20:00"
+      timezone: Europe/Berlin
+      idle: 3
+    - days: [fri]
+      from: "22:00"
+      to: "02:00"
+      idle: 1
+    - cron: "0 12 * * sat"
+      duration: 2h
+      idle: 5
+  provider:
+    name: anynode
+`))
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+
+	lwindows, lerr := lpoolSpecs[0].GetWarmWindows()
+	if lerr != nil || len(lwindows) != 3 {
+		t.Fatalf("3 warm windows expected, got %d: %v", len(lwindows), lerr)
+	}
+
+	for _, lcase := range []struct {
+		now  string
+		idle int
+	}{
+		{"2024-01-15T07:30:00Z", 3}, // понедельник 08:30 в Берлине
+		{"2024-01-15T07:29:00Z", 0},
+		{"2024-01-15T19:00:00Z", 0},
+		{"2024-01-19T23:00:00Z", 1}, // пятница
+		{"2024-01-20T01:59:00Z", 1}, // окно пятницы через полночь
+		{"2024-01-20T02:00:00Z", 0},
+		{"2024-01-21T01:00:00Z", 0}, // окно не начиналось в субботу
+		{"2024-01-20T12:00:00Z", 5},
+		{"2024-01-20T13:59:00Z", 5},
+		{"2024-01-20T14:00:00Z", 0},
+	} {
+		lnow, _ := time.Parse(time.RFC3339, lcase.now)
+		if lidle := warmIdleNodes(lwindows, lnow); lidle != lcase.idle {
+			t.Fatalf("at %s %d idle nodes expected, got %d", lcase.now, lcase.idle, lidle)
+		}
+	}
+
+	if lminNodes, _ := lpoolSpecs[0].GetNodeBounds(); lminNodes != 0 {
+		t.Fatalf("warm must not change min nodes, got %d", lminNodes)
+	}
+}
+
+func TestWarmWindowsWrong(t *testing.T) {
+	for _, lwarm := range []string{
+		`[{from: "08:00", to: "20:00"}]`,
+		`[{idle: 1, days: [monday]}]`,
+		`[{idle: 1, from: "8", to: "20:00"}]`,
+		`[{idle: 1, from: "08:00", to: "08:00"}]`,
+		`[{idle: 1, cron: "0 8 * * *"}]`,
+		`[{idle: 1, cron: "0 8 * * *", duration: 1h, days: [mon]}]`,
+		`[{idle: 1, duration: 1h}]`,
+		`[{idle: 1, timezone: Mars/Olympus}]`,
+		`[{idle: -1}]`,
+	} {
+		_, lerr := parsePoolDifinition(writeTestFile(t, "pools.yml", "- datacenter: test\n  warm: "+lwarm+"\n"))
+		if lerr == nil {
+			t.Fatalf("warm %s must be rejected", lwarm)
+		}
+	}
+}